@@ -0,0 +1,162 @@
+// Example: UDP tunnel using the LocalUp Go SDK
+//
+// This example demonstrates how to expose a local UDP service (DNS, a game
+// server, WireGuard, ...) to the internet using LocalUp. It includes a
+// built-in echo server for easy testing.
+//
+// Usage:
+//
+//	go run main.go
+//
+// Environment variables:
+//
+//	LOCALUP_AUTHTOKEN - Your LocalUp authentication token
+//	LOCALUP_RELAY     - Relay server address (default: localhost:5443)
+//	LOCAL_PORT        - Local UDP port to expose (default: starts echo server)
+//	LOCALUP_LOG       - Log level: debug, info, warn, error, none (default: info)
+//
+// Testing with netcat:
+//
+//	nc -u <relay-host> <assigned-port>
+//	Hello, world!    <- type this
+//	[echo] Hello, world!    <- echo server responds
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/localup/localup-go"
+)
+
+func main() {
+	if err := run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context) error {
+	// Get configuration from environment
+	authtoken := os.Getenv("LOCALUP_AUTHTOKEN")
+	if authtoken == "" {
+		return fmt.Errorf("LOCALUP_AUTHTOKEN environment variable is required")
+	}
+
+	relayAddr := os.Getenv("LOCALUP_RELAY")
+	if relayAddr == "" {
+		relayAddr = "localhost:5443"
+	}
+
+	// Check if we should use a custom port or start the built-in echo server
+	var localPort uint16
+	useEchoServer := true
+
+	if portStr := os.Getenv("LOCAL_PORT"); portStr != "" {
+		p, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid LOCAL_PORT: %w", err)
+		}
+		localPort = uint16(p)
+		useEchoServer = false
+	}
+
+	// Start the echo server if no LOCAL_PORT specified
+	if useEchoServer {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+		if err != nil {
+			return fmt.Errorf("failed to start echo server: %w", err)
+		}
+		defer conn.Close()
+
+		localPort = uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+		fmt.Printf("Started UDP echo server on localhost:%d\n", localPort)
+
+		go runEchoServer(ctx, conn)
+	}
+
+	// Create the agent with logging from LOCALUP_LOG env var
+	agent, err := localup.NewAgent(
+		localup.WithAuthtoken(authtoken),
+		localup.WithRelayAddr(relayAddr),
+		localup.WithLogger(localup.LoggerFromEnv()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create agent: %w", err)
+	}
+	defer agent.Close()
+
+	// Create UDP tunnel
+	// Port 0 means auto-assign a public port
+	ln, err := agent.Forward(ctx,
+		localup.WithUpstream(fmt.Sprintf("localhost:%d", localPort)),
+		localup.WithProtocol(localup.ProtocolUDP),
+		localup.WithPort(0), // auto-assign public port
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create tunnel: %w", err)
+	}
+
+	fmt.Println()
+	fmt.Println("UDP Tunnel online!")
+	fmt.Printf("Forwarding from %s to localhost:%d\n", ln.URL(), localPort)
+	fmt.Println()
+	if useEchoServer {
+		fmt.Println("Testing with netcat:")
+		fmt.Println("  nc -u <relay-host> <assigned-port>")
+		fmt.Println("  Type something and press Enter - the echo server will respond!")
+	} else {
+		fmt.Println("Example usage:")
+		fmt.Printf("  nc -u <relay-host> <assigned-port>\n")
+	}
+	fmt.Println()
+	fmt.Println("Press Ctrl+C to stop")
+
+	// Wait for interrupt or tunnel closure
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case <-sigCh:
+		fmt.Println("\nShutting down...")
+	case <-ln.Done():
+		fmt.Println("Tunnel closed")
+	}
+
+	return nil
+}
+
+// runEchoServer runs a simple UDP echo server.
+func runEchoServer(ctx context.Context, conn *net.UDPConn) {
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				log.Printf("Echo server read error: %v", err)
+				continue
+			}
+		}
+
+		log.Printf("Echo server: received %d bytes from %s", n, addr)
+
+		response := fmt.Sprintf("[echo] %s", string(buf[:n]))
+		if _, err := conn.WriteToUDP([]byte(response), addr); err != nil {
+			log.Printf("Echo server write error: %v", err)
+		}
+	}
+}
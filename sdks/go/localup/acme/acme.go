@@ -0,0 +1,490 @@
+// Package acme provides opt-in ACME/Let's Encrypt certificate automation
+// for ProtocolHTTPS tunnels with a custom domain (see localup.WithDomain).
+//
+// A Manager answers the TLSALPN01 challenge itself: the relay routes a
+// challenge connection's "acme-tls/1" ALPN to the agent as an ordinary
+// ProtocolTLS passthrough stream (see Tunnel.handleACMEChallengeStream),
+// and the agent terminates that handshake with the certificate Present
+// hands it, rather than forwarding the connection to the local upstream.
+// Once lego finishes validation, Manager delivers the real keypair back to
+// the relay via Tunnel.SendCertUpdate.
+//
+// Example usage:
+//
+//	mgr, err := acme.NewManager(acme.WithEmail("ops@example.com"))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//
+//	ln, err := agent.Forward(ctx,
+//	    localup.WithProtocol(localup.ProtocolHTTPS),
+//	    localup.WithUpstream("http://localhost:8080"),
+//	    localup.WithDomain("app.example.com"),
+//	    localup.WithACME(mgr),
+//	)
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/registration"
+
+	"github.com/localup/localup-go"
+)
+
+// Tuning defaults for the ACME subsystem.
+const (
+	// DefaultRenewBefore is how long before a certificate's expiry Manager
+	// starts a renewal attempt.
+	DefaultRenewBefore = 30 * 24 * time.Hour
+
+	// DefaultRenewRetryDelay is how long Manager waits before retrying a
+	// failed renewal, rather than waiting all the way until the next
+	// scheduled renewal time.
+	DefaultRenewRetryDelay = 1 * time.Hour
+)
+
+// CertStore persists obtained certificates and the ACME account key/
+// registration between process restarts. The zero-config default is a
+// file-backed store under $XDG_CACHE_HOME/localup (see NewFileCertStore).
+type CertStore interface {
+	// LoadCert returns the cached keypair for domain, or an error
+	// satisfying errors.Is(err, os.ErrNotExist) if none is cached yet.
+	LoadCert(domain string) (certPEM, keyPEM []byte, err error)
+
+	// SaveCert caches a keypair for domain.
+	SaveCert(domain string, certPEM, keyPEM []byte) error
+
+	// LoadAccount returns the persisted ACME account key and registration
+	// resource, or an error satisfying errors.Is(err, os.ErrNotExist) if no
+	// account has been registered yet. reg may be nil even when key isn't,
+	// if a key was saved before registration completed.
+	LoadAccount() (key crypto.PrivateKey, reg *registration.Resource, err error)
+
+	// SaveAccount persists the ACME account key and registration resource.
+	SaveAccount(key crypto.PrivateKey, reg *registration.Resource) error
+}
+
+// Config configures a Manager. The zero value is filled in with defaults by
+// NewManager: CA defaults to Let's Encrypt's production directory,
+// CertStore to a file-backed store under $XDG_CACHE_HOME/localup, and
+// RenewBefore to DefaultRenewBefore.
+type Config struct {
+	// Email is the contact address used when registering the ACME account.
+	// Optional, but strongly recommended by every public CA.
+	Email string
+
+	// CA is the ACME directory URL. Defaults to
+	// lego.LEDirectoryProduction; set to lego.LEDirectoryStaging while
+	// testing to avoid Let's Encrypt's production rate limits.
+	CA string
+
+	// CertStore overrides the default file-backed cert/account cache.
+	CertStore CertStore
+
+	// RenewBefore is how long before expiry a renewal is attempted.
+	RenewBefore time.Duration
+
+	// Logger receives ObtainStarted/Renewed/Failed events. Defaults to a
+	// no-op logger.
+	Logger localup.Logger
+}
+
+// Option configures a Config.
+type Option func(*Config)
+
+// WithEmail sets the ACME account's contact email.
+func WithEmail(email string) Option {
+	return func(c *Config) { c.Email = email }
+}
+
+// WithCA overrides the ACME directory URL, e.g. lego.LEDirectoryStaging.
+func WithCA(directoryURL string) Option {
+	return func(c *Config) { c.CA = directoryURL }
+}
+
+// WithCertStore overrides the default file-backed cert/account cache.
+func WithCertStore(store CertStore) Option {
+	return func(c *Config) { c.CertStore = store }
+}
+
+// WithRenewBefore overrides how long before expiry a renewal is attempted.
+func WithRenewBefore(d time.Duration) Option {
+	return func(c *Config) { c.RenewBefore = d }
+}
+
+// WithLogger sets the logger Manager reports ObtainStarted/Renewed/Failed
+// events to.
+func WithLogger(logger localup.Logger) Option {
+	return func(c *Config) { c.Logger = logger }
+}
+
+// Manager obtains and renews certificates via ACME's TLSALPN01 challenge
+// and satisfies localup.ACMEManager. Create one with NewManager and pass it
+// to localup.WithACME.
+type Manager struct {
+	cfg    Config
+	client *lego.Client
+	user   *acmeUser
+
+	mu         sync.Mutex
+	challenges map[string]*tls.Certificate
+}
+
+// acmeUser implements lego's registration.User.
+type acmeUser struct {
+	email string
+	key   crypto.PrivateKey
+	reg   *registration.Resource
+}
+
+func (u *acmeUser) GetEmail() string                        { return u.email }
+func (u *acmeUser) GetRegistration() *registration.Resource { return u.reg }
+func (u *acmeUser) GetPrivateKey() crypto.PrivateKey        { return u.key }
+
+// NewManager creates a Manager, registering a new ACME account if the
+// configured CertStore doesn't already have one cached.
+func NewManager(opts ...Option) (*Manager, error) {
+	cfg := Config{
+		CA:          lego.LEDirectoryProduction,
+		RenewBefore: DefaultRenewBefore,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.CertStore == nil {
+		store, err := NewFileCertStore("")
+		if err != nil {
+			return nil, fmt.Errorf("acme: default cert store: %w", err)
+		}
+		cfg.CertStore = store
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = &noopLogger{}
+	}
+
+	key, reg, err := cfg.CertStore.LoadAccount()
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("acme: generate account key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("acme: load account: %w", err)
+	}
+
+	user := &acmeUser{email: cfg.Email, key: key, reg: reg}
+
+	legoCfg := lego.NewConfig(user)
+	legoCfg.CADirURL = cfg.CA
+	legoCfg.Certificate.KeyType = certcrypto.EC256
+
+	client, err := lego.NewClient(legoCfg)
+	if err != nil {
+		return nil, fmt.Errorf("acme: new client: %w", err)
+	}
+
+	m := &Manager{
+		cfg:        cfg,
+		client:     client,
+		user:       user,
+		challenges: make(map[string]*tls.Certificate),
+	}
+
+	if err := client.Challenge.SetTLSALPN01Provider(m); err != nil {
+		return nil, fmt.Errorf("acme: set challenge provider: %w", err)
+	}
+
+	if user.reg == nil {
+		reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+		if err != nil {
+			return nil, fmt.Errorf("acme: register account: %w", err)
+		}
+		user.reg = reg
+		if err := cfg.CertStore.SaveAccount(key, reg); err != nil {
+			return nil, fmt.Errorf("acme: save account: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Present implements challenge.Provider: it builds the TLSALPN01 challenge
+// certificate for domain and keeps it available for ChallengeCertificate
+// until CleanUp is called.
+func (m *Manager) Present(domain, _, keyAuth string) error {
+	cert, err := tlsalpn01.ChallengeCert(domain, keyAuth)
+	if err != nil {
+		return fmt.Errorf("acme: build challenge certificate: %w", err)
+	}
+	m.mu.Lock()
+	m.challenges[domain] = cert
+	m.mu.Unlock()
+	return nil
+}
+
+// CleanUp implements challenge.Provider, discarding domain's challenge
+// certificate once the CA has finished validating it.
+func (m *Manager) CleanUp(domain, _, _ string) error {
+	m.mu.Lock()
+	delete(m.challenges, domain)
+	m.mu.Unlock()
+	return nil
+}
+
+// ChallengeCertificate implements localup.ACMEManager.
+func (m *Manager) ChallengeCertificate(domain string) (*tls.Certificate, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cert, ok := m.challenges[domain]
+	return cert, ok
+}
+
+// Start implements localup.ACMEManager: it obtains (or loads a still-fresh
+// cached) certificate for domain, delivers it to the relay, and spawns a
+// background loop that renews it until ctx is done.
+func (m *Manager) Start(ctx context.Context, tunnel *localup.Tunnel, domain string) error {
+	m.cfg.Logger.Info("acme: obtaining certificate", "domain", domain)
+
+	cert, err := m.obtain(domain)
+	if err != nil {
+		m.cfg.Logger.Error("acme: obtain failed", "domain", domain, "error", err)
+		return err
+	}
+	if err := tunnel.SendCertUpdate(domain, cert.Certificate, cert.PrivateKey); err != nil {
+		return fmt.Errorf("acme: send CertUpdate: %w", err)
+	}
+	m.cfg.Logger.Info("acme: certificate ready", "domain", domain)
+
+	go m.renewLoop(ctx, tunnel, domain, cert)
+	return nil
+}
+
+// renewLoop renews cert shortly before it expires, resending it to tunnel
+// each time, until ctx is done.
+func (m *Manager) renewLoop(ctx context.Context, tunnel *localup.Tunnel, domain string, cert *certificate.Resource) {
+	for {
+		notAfter, err := certNotAfter(cert.Certificate)
+		if err != nil {
+			m.cfg.Logger.Error("acme: parse certificate", "domain", domain, "error", err)
+			return
+		}
+
+		wait := time.Until(notAfter.Add(-m.cfg.RenewBefore))
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		renewed, err := m.renew(cert)
+		if err != nil {
+			m.cfg.Logger.Error("acme: renew failed", "domain", domain, "error", err)
+			if err := tunnel.SendCertUpdate(domain, nil, nil); err != nil {
+				m.cfg.Logger.Error("acme: send CertUpdate", "domain", domain, "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(DefaultRenewRetryDelay):
+			}
+			continue
+		}
+
+		cert = renewed
+		if err := tunnel.SendCertUpdate(domain, cert.Certificate, cert.PrivateKey); err != nil {
+			m.cfg.Logger.Error("acme: send CertUpdate", "domain", domain, "error", err)
+		}
+		m.cfg.Logger.Info("acme: certificate renewed", "domain", domain)
+	}
+}
+
+// obtain returns a still-fresh cached certificate for domain, or asks lego
+// to issue a new one.
+func (m *Manager) obtain(domain string) (*certificate.Resource, error) {
+	certPEM, keyPEM, err := m.cfg.CertStore.LoadCert(domain)
+	switch {
+	case err == nil:
+		if fresh, ferr := isFresh(certPEM, m.cfg.RenewBefore); ferr == nil && fresh {
+			return &certificate.Resource{Domain: domain, Certificate: certPEM, PrivateKey: keyPEM}, nil
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("acme: load cached certificate: %w", err)
+	}
+
+	cert, err := m.client.Certificate.Obtain(certificate.ObtainRequest{
+		Domains: []string{domain},
+		Bundle:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("acme: obtain: %w", err)
+	}
+	if err := m.cfg.CertStore.SaveCert(domain, cert.Certificate, cert.PrivateKey); err != nil {
+		m.cfg.Logger.Warn("acme: failed to cache certificate", "domain", domain, "error", err)
+	}
+	return cert, nil
+}
+
+// renew asks lego to renew cert and caches the result.
+func (m *Manager) renew(cert *certificate.Resource) (*certificate.Resource, error) {
+	renewed, err := m.client.Certificate.Renew(*cert, true, false, "")
+	if err != nil {
+		return nil, fmt.Errorf("acme: renew: %w", err)
+	}
+	if err := m.cfg.CertStore.SaveCert(renewed.Domain, renewed.Certificate, renewed.PrivateKey); err != nil {
+		return renewed, fmt.Errorf("acme: cache renewed certificate: %w", err)
+	}
+	return renewed, nil
+}
+
+// certNotAfter parses a PEM-encoded certificate's expiry time.
+func certNotAfter(certPEM []byte) (time.Time, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return time.Time{}, errors.New("acme: no PEM block in certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+// isFresh reports whether certPEM is valid for at least renewBefore longer.
+func isFresh(certPEM []byte, renewBefore time.Duration) (bool, error) {
+	notAfter, err := certNotAfter(certPEM)
+	if err != nil {
+		return false, err
+	}
+	return time.Now().Before(notAfter.Add(-renewBefore)), nil
+}
+
+// noopLogger discards every event; used when Config.Logger isn't set.
+type noopLogger struct{}
+
+func (noopLogger) Debug(string, ...interface{})         {}
+func (noopLogger) Info(string, ...interface{})          {}
+func (noopLogger) Warn(string, ...interface{})          {}
+func (noopLogger) Error(string, ...interface{})         {}
+func (l noopLogger) With(...interface{}) localup.Logger { return l }
+
+// fileCertStore is the default CertStore, persisting certs and the account
+// key/registration as files under a cache directory.
+type fileCertStore struct {
+	dir string
+}
+
+// NewFileCertStore creates a file-backed CertStore rooted at dir. Passing ""
+// uses $XDG_CACHE_HOME/localup, falling back to ~/.cache/localup.
+func NewFileCertStore(dir string) (CertStore, error) {
+	if dir == "" {
+		base := os.Getenv("XDG_CACHE_HOME")
+		if base == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("acme: resolve cache dir: %w", err)
+			}
+			base = filepath.Join(home, ".cache")
+		}
+		dir = filepath.Join(base, "localup")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "certs"), 0o700); err != nil {
+		return nil, fmt.Errorf("acme: create cache dir: %w", err)
+	}
+	return &fileCertStore{dir: dir}, nil
+}
+
+func (s *fileCertStore) certPath(domain string) string {
+	return filepath.Join(s.dir, "certs", domain+".crt")
+}
+
+func (s *fileCertStore) keyPath(domain string) string {
+	return filepath.Join(s.dir, "certs", domain+".key")
+}
+
+func (s *fileCertStore) LoadCert(domain string) ([]byte, []byte, error) {
+	certPEM, err := os.ReadFile(s.certPath(domain))
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(s.keyPath(domain))
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, keyPEM, nil
+}
+
+func (s *fileCertStore) SaveCert(domain string, certPEM, keyPEM []byte) error {
+	if err := os.WriteFile(s.certPath(domain), certPEM, 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(s.keyPath(domain), keyPEM, 0o600)
+}
+
+func (s *fileCertStore) LoadAccount() (crypto.PrivateKey, *registration.Resource, error) {
+	keyPEM, err := os.ReadFile(filepath.Join(s.dir, "account.key"))
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, errors.New("acme: invalid account key PEM")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reg *registration.Resource
+	if regBytes, err := os.ReadFile(filepath.Join(s.dir, "account.json")); err == nil {
+		reg = &registration.Resource{}
+		if err := json.Unmarshal(regBytes, reg); err != nil {
+			return nil, nil, fmt.Errorf("acme: parse account registration: %w", err)
+		}
+	}
+	return key, reg, nil
+}
+
+func (s *fileCertStore) SaveAccount(key crypto.PrivateKey, reg *registration.Resource) error {
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("acme: unsupported account key type %T", key)
+	}
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(s.dir, "account.key"), keyPEM, 0o600); err != nil {
+		return err
+	}
+	if reg == nil {
+		return nil
+	}
+	regBytes, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, "account.json"), regBytes, 0o600)
+}
@@ -25,6 +25,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 )
@@ -35,6 +36,15 @@ type Agent struct {
 	mu        sync.RWMutex
 	tunnels   map[string]*Tunnel
 	transport Transport
+
+	// wonProtocol is the TransportProtocol connect last dialed successfully
+	// when config.transportProtocols is set (see WithProtocolFallback). A
+	// reconnect dials it directly instead of re-racing every protocol, only
+	// falling back to a full race again if it fails.
+	wonProtocol TransportProtocol
+
+	// metrics backs Collector(); see Metrics.
+	metrics *Metrics
 }
 
 // AgentConfig holds the configuration for an Agent.
@@ -74,6 +84,86 @@ type AgentConfig struct {
 	// ReconnectMultiplier is the multiplier for exponential backoff.
 	// Default: 2.0
 	ReconnectMultiplier float64
+
+	// ReconnectMaxElapsed bounds the total wall-clock time a reconnect loop
+	// may run, independent of ReconnectMaxRetries: whichever limit is hit
+	// first ends the loop. 0 means unlimited. Default: 0 (unlimited)
+	ReconnectMaxElapsed time.Duration
+
+	// ReconnectResetInterval is how long a reconnection must stay up before
+	// the attempt counter (and so the backoff delay) resets back to zero.
+	// Without this, a relay that accepts a connection and immediately drops
+	// it again would otherwise collapse the backoff to its initial delay on
+	// every cycle, defeating the point of backing off at all.
+	// Default: 60 seconds
+	ReconnectResetInterval time.Duration
+
+	// OnReconnectAttempt, if set, is called just before each reconnection
+	// attempt's backoff sleep, with the 1-based attempt number and the delay
+	// about to be slept.
+	OnReconnectAttempt func(attempt int, delay time.Duration)
+
+	// OnReconnectSuccess, if set, is called once a reconnection attempt
+	// succeeds, with the 1-based attempt number it succeeded on.
+	OnReconnectSuccess func(attempt int)
+
+	// OnReconnectFailure, if set, is called after each failed reconnection
+	// attempt, with the 1-based attempt number and the error encountered.
+	OnReconnectFailure func(attempt int, err error)
+
+	// transportDialers are tried in order when connecting to the relay, set
+	// by WithTransport/WithTransportFallback. Defaults to
+	// []TransportDialer{QUICTransportDialer}.
+	transportDialers []TransportDialer
+
+	// edgePool holds the multi-edge failover configuration set by
+	// WithEdgePool, if any. When set, connect builds an EdgePool instead of
+	// using transportDialers.
+	edgePool *edgePoolConfig
+
+	// transportProtocols, set by WithTransportProtocol/WithProtocolFallback,
+	// names which TransportProtocol(s) connect dials directly instead of
+	// using transportDialers. A single entry forces that protocol; multiple
+	// entries are raced (see Agent.connectProtocol). Takes priority over
+	// transportDialers when non-empty.
+	transportProtocols []TransportProtocol
+
+	// EnableDatagrams negotiates unreliable QUIC datagrams (RFC 9221) on the
+	// QUIC transport, so ProtocolUDP tunnels and WebTransport-style HTTP/3
+	// sessions can send data without paying for stream ordering and
+	// retransmission. Ignored by WebSocketTransport. Default: false.
+	EnableDatagrams bool
+
+	// Observer, set by WithObserver, receives structured connect/
+	// disconnect/reconnect/stream lifecycle events. Defaults to a no-op
+	// Observer, so call sites never need to nil-check it.
+	Observer Observer
+
+	// QLogDir, set by WithQLogDir, is a directory NewQUICTransport writes a
+	// per-connection qlog trace file to (named "client-<connID>.qlog"), for
+	// diagnosing QUIC-level behavior (loss, congestion control, path MTU)
+	// with a tool like qvis. Empty disables qlog tracing, the default.
+	QLogDir string
+
+	// TLSKeyLogWriter, set by WithTLSKeyLogWriter, receives the TLS session
+	// keys for the QUIC connection in NSS key log format, so a capture taken
+	// with Wireshark (or similar) can be decrypted. Nil disables key
+	// logging, the default; only set this for local debugging, since
+	// anything holding the log file can decrypt the traffic.
+	TLSKeyLogWriter io.Writer
+
+	// SessionCache, set by WithSessionCache, caches TLS session tickets so
+	// NewQUICTransport can resume a connection instead of running a full
+	// handshake, and (with EnableZeroRTT) send 0-RTT data immediately. Nil
+	// disables resumption, the default.
+	SessionCache SessionCache
+
+	// EnableZeroRTT, set by WithZeroRTT, dials with quic.DialEarly and
+	// quic.Config.Allow0RTT instead of quic.Dial, so a reconnect using a
+	// resumed session (see SessionCache) can send data before the handshake
+	// finishes. Has no effect without a SessionCache holding a prior
+	// session's ticket. Default: false.
+	EnableZeroRTT bool
 }
 
 // AgentOption is a function that configures an AgentConfig.
@@ -143,17 +233,142 @@ func WithReconnectBackoff(initialDelay, maxDelay time.Duration, multiplier float
 	}
 }
 
+// WithReconnectMaxElapsed bounds the total wall-clock time a reconnect loop
+// may run before giving up, independent of WithReconnectMaxRetries. 0 means
+// unlimited.
+func WithReconnectMaxElapsed(maxElapsed time.Duration) AgentOption {
+	return func(c *AgentConfig) {
+		c.ReconnectMaxElapsed = maxElapsed
+	}
+}
+
+// WithReconnectResetInterval sets how long a reconnection must stay up
+// before the backoff attempt counter resets to zero. Default: 60 seconds.
+func WithReconnectResetInterval(interval time.Duration) AgentOption {
+	return func(c *AgentConfig) {
+		c.ReconnectResetInterval = interval
+	}
+}
+
+// WithReconnectHooks registers callbacks for reconnection attempts,
+// successes, and failures, e.g. to wire up metrics. Any of the three may be
+// nil.
+func WithReconnectHooks(onAttempt func(attempt int, delay time.Duration), onSuccess func(attempt int), onFailure func(attempt int, err error)) AgentOption {
+	return func(c *AgentConfig) {
+		c.OnReconnectAttempt = onAttempt
+		c.OnReconnectSuccess = onSuccess
+		c.OnReconnectFailure = onFailure
+	}
+}
+
+// WithTransport overrides the transport used to connect to the relay,
+// replacing the default QUICTransportDialer. Use WithTransportFallback
+// instead to probe multiple transports in order.
+func WithTransport(dialer TransportDialer) AgentOption {
+	return func(c *AgentConfig) {
+		c.transportDialers = []TransportDialer{dialer}
+	}
+}
+
+// WithTransportFallback probes each dialer in turn, using the first one that
+// connects successfully and recording the rest's failure reasons via
+// AgentConfig.Logger. For example:
+//
+//	localup.WithTransportFallback(localup.QUICTransportDialer, localup.WebSocketTransportDialer)
+//
+// tries QUIC first and transparently retries over WebSocket if the network
+// blocks QUIC's UDP traffic.
+func WithTransportFallback(dialers ...TransportDialer) AgentOption {
+	return func(c *AgentConfig) {
+		c.transportDialers = dialers
+	}
+}
+
+// WithTransportProtocol forces connect to dial protocol directly on every
+// (re)connect, bypassing transportDialers and any race against other
+// protocols. Use WithProtocolFallback instead to race QUIC against a
+// fallback.
+func WithTransportProtocol(protocol TransportProtocol) AgentOption {
+	return func(c *AgentConfig) {
+		c.transportProtocols = []TransportProtocol{protocol}
+	}
+}
+
+// WithProtocolFallback races a dial of each protocol concurrently and uses
+// whichever succeeds first. The TransportProtocolQUIC dial is cut off after
+// DefaultQUICRaceTimeout, so networks that silently black-hole QUIC's UDP
+// traffic don't have to wait out a full dial timeout before a later entry
+// (e.g. TransportProtocolHTTP2) wins. QUIC gets no priority: a later entry
+// that connects first wins even if the QUIC dial would also have succeeded.
+// Once a protocol wins, subsequent reconnects dial it directly and only
+// re-race if it fails.
+func WithProtocolFallback(protocols ...TransportProtocol) AgentOption {
+	return func(c *AgentConfig) {
+		c.transportProtocols = protocols
+	}
+}
+
+// WithDatagrams enables unreliable QUIC datagrams on the QUIC transport (see
+// AgentConfig.EnableDatagrams). Has no effect on WebSocketTransport, whose
+// SendDatagram/ReceiveDatagram always return ErrDatagramsNotSupported.
+func WithDatagrams(enabled bool) AgentOption {
+	return func(c *AgentConfig) {
+		c.EnableDatagrams = enabled
+	}
+}
+
+// WithQLogDir enables qlog tracing on the QUIC transport, writing one file
+// per connection under dir (see AgentConfig.QLogDir). Has no effect on
+// WebSocketTransport/HTTP2Transport.
+func WithQLogDir(dir string) AgentOption {
+	return func(c *AgentConfig) {
+		c.QLogDir = dir
+	}
+}
+
+// WithTLSKeyLogWriter installs a writer to receive TLS session keys for the
+// QUIC transport in NSS key log format (see AgentConfig.TLSKeyLogWriter).
+// Has no effect on WebSocketTransport/HTTP2Transport, which take their
+// KeyLogWriter from WithTLSConfig instead.
+func WithTLSKeyLogWriter(w io.Writer) AgentOption {
+	return func(c *AgentConfig) {
+		c.TLSKeyLogWriter = w
+	}
+}
+
+// WithSessionCache installs a SessionCache so the QUIC transport can resume
+// a connection across reconnects instead of running a full TLS handshake
+// (see AgentConfig.SessionCache). Use NewSessionCache for an in-memory
+// cache, or FileSessionCache to also survive process restarts.
+func WithSessionCache(cache SessionCache) AgentOption {
+	return func(c *AgentConfig) {
+		c.SessionCache = cache
+	}
+}
+
+// WithZeroRTT enables 0-RTT resumption on the QUIC transport (see
+// AgentConfig.EnableZeroRTT). Only takes effect once a WithSessionCache has
+// a ticket from a prior connection to resume.
+func WithZeroRTT(enabled bool) AgentOption {
+	return func(c *AgentConfig) {
+		c.EnableZeroRTT = enabled
+	}
+}
+
 // NewAgent creates a new LocalUp agent with the given options.
 func NewAgent(opts ...AgentOption) (*Agent, error) {
 	config := &AgentConfig{
-		RelayAddr:             DefaultRelayAddr,
-		Logger:                &noopLogger{},
-		Metadata:              make(map[string]string),
-		Reconnect:             true, // Enabled by default
-		ReconnectMaxRetries:   0,    // Unlimited
-		ReconnectInitialDelay: 1 * time.Second,
-		ReconnectMaxDelay:     30 * time.Second,
-		ReconnectMultiplier:   2.0,
+		RelayAddr:              DefaultRelayAddr,
+		Logger:                 &noopLogger{},
+		Metadata:               make(map[string]string),
+		Reconnect:              true, // Enabled by default
+		ReconnectMaxRetries:    0,    // Unlimited
+		ReconnectInitialDelay:  1 * time.Second,
+		ReconnectMaxDelay:      30 * time.Second,
+		ReconnectMultiplier:    2.0,
+		ReconnectResetInterval: 60 * time.Second,
+		transportDialers:       []TransportDialer{QUICTransportDialer},
+		Observer:               noopObserver{},
 	}
 
 	for _, opt := range opts {
@@ -167,6 +382,7 @@ func NewAgent(opts ...AgentOption) (*Agent, error) {
 	agent := &Agent{
 		config:  config,
 		tunnels: make(map[string]*Tunnel),
+		metrics: newMetrics(),
 	}
 
 	return agent, nil
@@ -208,6 +424,22 @@ func (a *Agent) Forward(ctx context.Context, opts ...TunnelOption) (*Tunnel, err
 	return tunnel, nil
 }
 
+// ForwardIngress is Forward with rules applied via WithIngress, for the
+// common case of exposing several local services through one tunnel: it
+// registers a single HTTP/HTTPS tunnel with the relay and routes each
+// incoming request to the first matching rule's Service by Host header and
+// path, instead of always forwarding to a single WithUpstream target.
+//
+// Example:
+//
+//	ln, err := agent.ForwardIngress(ctx, []localup.IngressRule{
+//	    {Hostname: "api.example.com", Service: "http://localhost:8080"},
+//	    {Service: "http_status:404"}, // catch-all
+//	})
+func (a *Agent) ForwardIngress(ctx context.Context, rules []IngressRule, opts ...TunnelOption) (*Tunnel, error) {
+	return a.Forward(ctx, append(opts, WithIngress(rules...))...)
+}
+
 // Listen creates a tunnel that accepts incoming connections.
 // Unlike Forward, you must manually accept and handle connections.
 //
@@ -271,23 +503,48 @@ func (a *Agent) Close() error {
 	return nil
 }
 
+// Collector returns a Prometheus-compatible MetricsCollector tracking this
+// agent's stream counts, bytes transferred, handshake latency, and
+// reconnect attempts. See Observer for per-event callbacks instead.
+func (a *Agent) Collector() *MetricsCollector {
+	return &MetricsCollector{metrics: a.metrics}
+}
+
 // createTunnel establishes a tunnel connection to the relay.
 func (a *Agent) createTunnel(ctx context.Context, config *TunnelConfig) (*Tunnel, error) {
-	// Discover transport if not already connected
-	if a.transport == nil {
-		transport, err := a.connect(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to connect to relay: %w", err)
+	tunnel := newTunnel(ctx, a, config)
+
+	if config.regionFailover != nil {
+		// Multi-region tunnels manage their own dedicated transport rather
+		// than sharing the agent-level one, since each region requires a
+		// separate connection to probe and potentially migrate between.
+		if err := tunnel.registerWithFailover(ctx); err != nil {
+			return nil, fmt.Errorf("failed to register tunnel: %w", err)
+		}
+	} else {
+		// Discover transport if not already connected
+		if a.transport == nil {
+			transport, err := a.connect(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to relay: %w", err)
+			}
+			a.transport = transport
+		}
+
+		if err := tunnel.register(ctx); err != nil {
+			return nil, fmt.Errorf("failed to register tunnel: %w", err)
 		}
-		a.transport = transport
 	}
 
-	// Create and register the tunnel
-	tunnel := newTunnel(ctx, a, config)
+	a.config.Observer.OnTunnelRegistered(tunnel.ID(), tunnel.URL())
 
-	// Register with the relay
-	if err := tunnel.register(ctx); err != nil {
-		return nil, fmt.Errorf("failed to register tunnel: %w", err)
+	if config.acmeManager != nil {
+		go func() {
+			if err := config.acmeManager.Start(ctx, tunnel, config.Domain); err != nil {
+				a.config.Logger.Error("acme: failed to start certificate management",
+					"domain", config.Domain, "error", err)
+			}
+		}()
 	}
 
 	// Start the tunnel's message handler
@@ -296,15 +553,111 @@ func (a *Agent) createTunnel(ctx context.Context, config *TunnelConfig) (*Tunnel
 	return tunnel, nil
 }
 
-// connect establishes a QUIC connection to the relay server.
+// connect establishes a transport connection to the relay server. If
+// WithEdgePool was used, it builds an EdgePool spanning the configured (or
+// SRV-resolved) edges instead. If WithTransportProtocol/WithProtocolFallback
+// was used, it delegates to connectProtocol. Otherwise it tries each of
+// config.transportDialers in order (see WithTransport and
+// WithTransportFallback), falling through to the next on failure. A
+// successful dial times the handshake into Metrics and notifies
+// Observer.OnConnect; connIndex is always 0 for a single-connection Agent.
+// An EdgePool instead reports each edge's own dial and reconnects against
+// Metrics/Observer itself, numbering connIndex per edge (see edgepool.go),
+// since it is the multi-connection Agent this comment used to say was
+// still to come.
 func (a *Agent) connect(ctx context.Context) (Transport, error) {
-	a.config.Logger.Debug("connecting to relay via QUIC", "addr", a.config.RelayAddr)
+	start := time.Now()
 
-	transport, err := NewQUICTransport(ctx, a.config)
-	if err != nil {
-		return nil, fmt.Errorf("QUIC connection failed: %w", err)
+	if a.config.edgePool != nil {
+		return newEdgePool(ctx, a, a.config.edgePool)
 	}
 
-	a.config.Logger.Debug("connected via QUIC", "addr", a.config.RelayAddr)
-	return transport, nil
+	if len(a.config.transportProtocols) > 0 {
+		transport, err := a.connectProtocol(ctx)
+		if err != nil {
+			return nil, err
+		}
+		a.metrics.recordHandshake(time.Since(start))
+		a.config.Observer.OnConnect(transportProtocolOf(transport), transport.RemoteAddr(), 0)
+		return transport, nil
+	}
+
+	var errs []error
+	for _, dial := range a.config.transportDialers {
+		transport, err := dial(ctx, a.config)
+		if err != nil {
+			a.config.Logger.Warn("transport dial failed, trying next", "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		a.metrics.recordHandshake(time.Since(start))
+		a.config.Observer.OnConnect(transportProtocolOf(transport), transport.RemoteAddr(), 0)
+		return transport, nil
+	}
+	return nil, fmt.Errorf("all transports failed: %v", errs)
+}
+
+// dialProtocol dials the QUIC or HTTP/2 transport directly by name.
+func dialProtocol(ctx context.Context, config *AgentConfig, protocol TransportProtocol) (Transport, error) {
+	switch protocol {
+	case TransportProtocolQUIC:
+		return NewQUICTransport(ctx, config)
+	case TransportProtocolHTTP2:
+		return NewHTTP2Transport(ctx, config)
+	default:
+		return nil, fmt.Errorf("unknown transport protocol: %q", protocol)
+	}
+}
+
+// connectProtocol implements WithTransportProtocol/WithProtocolFallback. If
+// a previous call already settled on a winning protocol, it's tried first so
+// a reconnect doesn't pay for a race it already won once; only on failure
+// does this fall back to racing the full list again. A single configured
+// protocol is just a race of one.
+func (a *Agent) connectProtocol(ctx context.Context) (Transport, error) {
+	protocols := a.config.transportProtocols
+
+	a.mu.RLock()
+	won := a.wonProtocol
+	a.mu.RUnlock()
+	if won != "" {
+		if transport, err := dialProtocol(ctx, a.config, won); err == nil {
+			return transport, nil
+		}
+		a.config.Logger.Warn("previously-winning transport protocol failed, re-negotiating", "protocol", won)
+	}
+
+	type raceResult struct {
+		protocol  TransportProtocol
+		transport Transport
+		err       error
+	}
+	results := make(chan raceResult, len(protocols))
+	for _, protocol := range protocols {
+		go func(protocol TransportProtocol) {
+			dialCtx := ctx
+			if protocol == TransportProtocolQUIC {
+				var cancel context.CancelFunc
+				dialCtx, cancel = context.WithTimeout(ctx, DefaultQUICRaceTimeout)
+				defer cancel()
+			}
+			transport, err := dialProtocol(dialCtx, a.config, protocol)
+			results <- raceResult{protocol: protocol, transport: transport, err: err}
+		}(protocol)
+	}
+
+	var errs []error
+	for range protocols {
+		res := <-results
+		if res.err != nil {
+			a.config.Logger.Warn("transport protocol dial failed", "protocol", res.protocol, "error", res.err)
+			errs = append(errs, res.err)
+			continue
+		}
+		a.mu.Lock()
+		a.wonProtocol = res.protocol
+		a.mu.Unlock()
+		return res.transport, nil
+	}
+	return nil, fmt.Errorf("all transport protocols failed: %v", errs)
 }
@@ -4,20 +4,83 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 )
 
+// IntEncoding selects how integers (and the length prefixes built on top of
+// them) are written on the wire.
+type IntEncoding uint8
+
+const (
+	// FixintEncoding writes every integer in its fixed width, the original
+	// behavior of this package and Rust bincode's legacy default: lengths
+	// go out as an 8-byte u64, u16/u32/u64 as their native width.
+	FixintEncoding IntEncoding = iota
+
+	// VarintEncoding writes integers with bincode 2's default varint
+	// scheme: a value < 251 is one byte; 251/252/253/254 are markers for
+	// a following little-endian u16/u32/u64/u128. Signed integers are
+	// zig-zag encoded first so small negative numbers still cost one
+	// byte. Needed to interop with a Rust peer using bincode 2 defaults.
+	VarintEncoding
+)
+
+// BincodeByteOrder selects the byte order FixintEncoding (and the floats
+// WriteF32/WriteF64 always write in fixed width) use for multi-byte values.
+// VarintEncoding's marker-prefixed trailing bytes are always little-endian,
+// matching bincode, regardless of this setting.
+type BincodeByteOrder uint8
+
+const (
+	// LittleEndianOrder matches this package's original, and most common
+	// Rust bincode, wire format.
+	LittleEndianOrder BincodeByteOrder = iota
+	BigEndianOrder
+)
+
+func (o BincodeByteOrder) binaryOrder() binary.ByteOrder {
+	if o == BigEndianOrder {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// BincodeConfig configures the wire format details of a BincodeEncoder/
+// BincodeDecoder. The zero value (FixintEncoding, LittleEndianOrder, no
+// Limit) reproduces this package's original behavior exactly, so every
+// existing NewBincodeEncoder/NewBincodeDecoder call site is unaffected.
+type BincodeConfig struct {
+	IntEncoding IntEncoding
+	ByteOrder   BincodeByteOrder
+
+	// Limit caps the length a single ReadBytes/ReadString may report,
+	// beyond the unconditional MaxFrameSize/math.MaxInt32 sanity bounds.
+	// 0 means no additional limit.
+	Limit uint64
+}
+
 // BincodeEncoder encodes values in bincode format.
 // This is compatible with Rust's bincode serialization.
 type BincodeEncoder struct {
 	buf *bytes.Buffer
+	cfg BincodeConfig
 }
 
-// NewBincodeEncoder creates a new bincode encoder.
+// NewBincodeEncoder creates a new bincode encoder using FixintEncoding/
+// LittleEndianOrder, this package's original wire format.
 func NewBincodeEncoder() *BincodeEncoder {
+	return NewBincodeEncoderWithConfig(BincodeConfig{})
+}
+
+// NewBincodeEncoderWithConfig creates a bincode encoder using cfg, e.g.
+// BincodeConfig{IntEncoding: VarintEncoding} to interop with a Rust peer
+// built against bincode 2's default configuration.
+func NewBincodeEncoderWithConfig(cfg BincodeConfig) *BincodeEncoder {
 	return &BincodeEncoder{
 		buf: new(bytes.Buffer),
+		cfg: cfg,
 	}
 }
 
@@ -31,32 +94,109 @@ func (e *BincodeEncoder) Reset() {
 	e.buf.Reset()
 }
 
-// WriteU8 writes a uint8.
+// WriteU8 writes a uint8. Bincode never varints 8-bit values, so this is
+// always a single raw byte regardless of IntEncoding.
 func (e *BincodeEncoder) WriteU8(v uint8) {
 	e.buf.WriteByte(v)
 }
 
-// WriteU16 writes a uint16 in little-endian.
+// WriteU16 writes a uint16: fixed-width in FixintEncoding, bincode's
+// marker-prefixed scheme in VarintEncoding.
 func (e *BincodeEncoder) WriteU16(v uint16) {
+	if e.cfg.IntEncoding == VarintEncoding {
+		writeVarintUint(e.buf, uint64(v))
+		return
+	}
 	var buf [2]byte
-	binary.LittleEndian.PutUint16(buf[:], v)
+	e.cfg.ByteOrder.binaryOrder().PutUint16(buf[:], v)
 	e.buf.Write(buf[:])
 }
 
-// WriteU32 writes a uint32 in little-endian.
+// WriteU32 writes a uint32: fixed-width in FixintEncoding, bincode's
+// marker-prefixed scheme in VarintEncoding.
 func (e *BincodeEncoder) WriteU32(v uint32) {
+	if e.cfg.IntEncoding == VarintEncoding {
+		writeVarintUint(e.buf, uint64(v))
+		return
+	}
 	var buf [4]byte
-	binary.LittleEndian.PutUint32(buf[:], v)
+	e.cfg.ByteOrder.binaryOrder().PutUint32(buf[:], v)
 	e.buf.Write(buf[:])
 }
 
-// WriteU64 writes a uint64 in little-endian.
+// WriteU64 writes a uint64: fixed-width in FixintEncoding, bincode's
+// marker-prefixed scheme in VarintEncoding.
 func (e *BincodeEncoder) WriteU64(v uint64) {
+	if e.cfg.IntEncoding == VarintEncoding {
+		writeVarintUint(e.buf, v)
+		return
+	}
+	var buf [8]byte
+	e.cfg.ByteOrder.binaryOrder().PutUint64(buf[:], v)
+	e.buf.Write(buf[:])
+}
+
+// WriteI8 writes an int8 as its raw two's-complement byte; like WriteU8,
+// never varint/zig-zag encoded.
+func (e *BincodeEncoder) WriteI8(v int8) {
+	e.WriteU8(uint8(v))
+}
+
+// WriteI16 writes an int16: fixed-width two's complement in
+// FixintEncoding, zig-zag plus bincode's varint scheme in VarintEncoding.
+func (e *BincodeEncoder) WriteI16(v int16) {
+	if e.cfg.IntEncoding == VarintEncoding {
+		writeVarintUint(e.buf, zigzagEncode(int64(v)))
+		return
+	}
+	e.WriteU16(uint16(v))
+}
+
+// WriteI32 writes an int32: fixed-width two's complement in
+// FixintEncoding, zig-zag plus bincode's varint scheme in VarintEncoding.
+func (e *BincodeEncoder) WriteI32(v int32) {
+	if e.cfg.IntEncoding == VarintEncoding {
+		writeVarintUint(e.buf, zigzagEncode(int64(v)))
+		return
+	}
+	e.WriteU32(uint32(v))
+}
+
+// WriteI64 writes an int64: fixed-width two's complement in
+// FixintEncoding, zig-zag plus bincode's varint scheme in VarintEncoding.
+func (e *BincodeEncoder) WriteI64(v int64) {
+	if e.cfg.IntEncoding == VarintEncoding {
+		writeVarintUint(e.buf, zigzagEncode(v))
+		return
+	}
+	e.WriteU64(uint64(v))
+}
+
+// WriteF32 writes a float32 via math.Float32bits. Bincode never varints
+// floats, so this always writes 4 fixed-width bytes in the configured
+// ByteOrder regardless of IntEncoding.
+func (e *BincodeEncoder) WriteF32(v float32) {
+	var buf [4]byte
+	e.cfg.ByteOrder.binaryOrder().PutUint32(buf[:], math.Float32bits(v))
+	e.buf.Write(buf[:])
+}
+
+// WriteF64 writes a float64 via math.Float64bits. Bincode never varints
+// floats, so this always writes 8 fixed-width bytes in the configured
+// ByteOrder regardless of IntEncoding.
+func (e *BincodeEncoder) WriteF64(v float64) {
 	var buf [8]byte
-	binary.LittleEndian.PutUint64(buf[:], v)
+	e.cfg.ByteOrder.binaryOrder().PutUint64(buf[:], math.Float64bits(v))
 	e.buf.Write(buf[:])
 }
 
+// WriteEnumTag writes a Rust enum discriminant. Bincode represents every
+// enum variant index as a u32 on the wire, so this is just a named WriteU32
+// for call-site clarity at enum encode points.
+func (e *BincodeEncoder) WriteEnumTag(tag uint32) {
+	e.WriteU32(tag)
+}
+
 // WriteBool writes a boolean as a single byte.
 func (e *BincodeEncoder) WriteBool(v bool) {
 	if v {
@@ -68,13 +208,13 @@ func (e *BincodeEncoder) WriteBool(v bool) {
 
 // WriteString writes a string with length prefix.
 func (e *BincodeEncoder) WriteString(s string) {
-	e.WriteU64(uint64(len(s)))
+	e.writeLength(uint64(len(s)))
 	e.buf.WriteString(s)
 }
 
 // WriteBytes writes a byte slice with length prefix.
 func (e *BincodeEncoder) WriteBytes(data []byte) {
-	e.WriteU64(uint64(len(data)))
+	e.writeLength(uint64(len(data)))
 	e.buf.Write(data)
 }
 
@@ -109,60 +249,246 @@ func (e *BincodeEncoder) WriteOptionBytes(v []byte) {
 	}
 }
 
-// WriteVec writes a vector with length prefix.
+// WriteVecLen writes a vector with length prefix.
 func (e *BincodeEncoder) WriteVecLen(length int) {
-	e.WriteU64(uint64(length))
+	e.writeLength(uint64(length))
+}
+
+// writeLength writes a string/bytes/vec length through the encoder's
+// configured IntEncoding. Option tags (always 0 or 1) are not routed
+// through this: both encodings already represent 0/1 as a single byte, so
+// WriteU8 already gives them the same wire bytes in either mode.
+func (e *BincodeEncoder) writeLength(n uint64) {
+	if e.cfg.IntEncoding == VarintEncoding {
+		writeVarintUint(e.buf, n)
+		return
+	}
+	e.WriteU64(n)
+}
+
+// writeVarintUint writes v using bincode's varint scheme: values < 251 fit
+// in one byte; 251/252/253/254 mark a following little-endian u16/u32/u64.
+// u128 (marker 254) is never produced by this encoder since v is a uint64.
+func writeVarintUint(buf *bytes.Buffer, v uint64) {
+	switch {
+	case v < 251:
+		buf.WriteByte(byte(v))
+	case v <= math.MaxUint16:
+		buf.WriteByte(251)
+		var b [2]byte
+		binary.LittleEndian.PutUint16(b[:], uint16(v))
+		buf.Write(b[:])
+	case v <= math.MaxUint32:
+		buf.WriteByte(252)
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(v))
+		buf.Write(b[:])
+	default:
+		buf.WriteByte(253)
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], v)
+		buf.Write(b[:])
+	}
+}
+
+// zigzagEncode maps a signed integer to an unsigned one so small negative
+// magnitudes still fit in the varint scheme's single-byte range, per
+// bincode's (n << 1) ^ (n >> 63).
+func zigzagEncode(n int64) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
+
+// zigzagDecode inverts zigzagEncode.
+func zigzagDecode(u uint64) int64 {
+	return int64(u>>1) ^ -int64(u&1)
 }
 
 // BincodeDecoder decodes values from bincode format.
 type BincodeDecoder struct {
 	r   io.Reader
 	buf []byte
+	cfg BincodeConfig
+
+	// data and pos back an in-memory decode (NewBincodeDecoderBytes): when
+	// data is non-nil, readN returns direct subslices of it instead of
+	// copying through r, so ReadBytes/ReadString don't allocate a second
+	// time on top of whatever buffer data already lives in (e.g. a pooled
+	// frame leased by MessageCodec.DecodeInto).
+	data []byte
+	pos  int
 }
 
-// NewBincodeDecoder creates a new bincode decoder.
+// NewBincodeDecoder creates a new bincode decoder that reads from a
+// stream, using FixintEncoding/LittleEndianOrder, this package's original
+// wire format.
 func NewBincodeDecoder(r io.Reader) *BincodeDecoder {
+	return NewBincodeDecoderWithConfig(r, BincodeConfig{})
+}
+
+// NewBincodeDecoderWithConfig creates a stream-reading bincode decoder
+// using cfg, e.g. BincodeConfig{IntEncoding: VarintEncoding} to interop
+// with a Rust peer built against bincode 2's default configuration.
+func NewBincodeDecoderWithConfig(r io.Reader, cfg BincodeConfig) *BincodeDecoder {
 	return &BincodeDecoder{
 		r:   r,
 		buf: make([]byte, 8),
+		cfg: cfg,
 	}
 }
 
-// NewBincodeDecoderBytes creates a decoder from a byte slice.
+// NewBincodeDecoderBytes creates a decoder that reads directly out of an
+// in-memory byte slice, with no copying into an intermediate reader, using
+// FixintEncoding/LittleEndianOrder.
 func NewBincodeDecoderBytes(data []byte) *BincodeDecoder {
-	return NewBincodeDecoder(bytes.NewReader(data))
+	return NewBincodeDecoderBytesWithConfig(data, BincodeConfig{})
+}
+
+// NewBincodeDecoderBytesWithConfig is NewBincodeDecoderBytes with an
+// explicit BincodeConfig.
+func NewBincodeDecoderBytesWithConfig(data []byte, cfg BincodeConfig) *BincodeDecoder {
+	return &BincodeDecoder{data: data, cfg: cfg}
+}
+
+// readN returns the next n bytes. Decoding from an in-memory slice returns a
+// direct subslice with no copy; decoding from a streaming io.Reader reads
+// into a freshly allocated buffer, since there's nothing to subslice into.
+func (d *BincodeDecoder) readN(n int) ([]byte, error) {
+	if d.data != nil {
+		if d.pos+n > len(d.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := d.data[d.pos : d.pos+n]
+		d.pos += n
+		return b, nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
 }
 
 // ReadU8 reads a uint8.
 func (d *BincodeDecoder) ReadU8() (uint8, error) {
-	if _, err := io.ReadFull(d.r, d.buf[:1]); err != nil {
+	b, err := d.readN(1)
+	if err != nil {
 		return 0, err
 	}
-	return d.buf[0], nil
+	return b[0], nil
 }
 
-// ReadU16 reads a uint16 in little-endian.
+// ReadU16 reads a uint16, mirroring WriteU16's IntEncoding handling.
 func (d *BincodeDecoder) ReadU16() (uint16, error) {
-	if _, err := io.ReadFull(d.r, d.buf[:2]); err != nil {
+	if d.cfg.IntEncoding == VarintEncoding {
+		u, err := readVarintUint(d)
+		if err != nil {
+			return 0, err
+		}
+		return uint16(u), nil
+	}
+	b, err := d.readN(2)
+	if err != nil {
 		return 0, err
 	}
-	return binary.LittleEndian.Uint16(d.buf[:2]), nil
+	return d.cfg.ByteOrder.binaryOrder().Uint16(b), nil
 }
 
-// ReadU32 reads a uint32 in little-endian.
+// ReadU32 reads a uint32, mirroring WriteU32's IntEncoding handling.
 func (d *BincodeDecoder) ReadU32() (uint32, error) {
-	if _, err := io.ReadFull(d.r, d.buf[:4]); err != nil {
+	if d.cfg.IntEncoding == VarintEncoding {
+		u, err := readVarintUint(d)
+		if err != nil {
+			return 0, err
+		}
+		return uint32(u), nil
+	}
+	b, err := d.readN(4)
+	if err != nil {
 		return 0, err
 	}
-	return binary.LittleEndian.Uint32(d.buf[:4]), nil
+	return d.cfg.ByteOrder.binaryOrder().Uint32(b), nil
 }
 
-// ReadU64 reads a uint64 in little-endian.
+// ReadU64 reads a uint64, mirroring WriteU64's IntEncoding handling.
 func (d *BincodeDecoder) ReadU64() (uint64, error) {
-	if _, err := io.ReadFull(d.r, d.buf[:8]); err != nil {
+	if d.cfg.IntEncoding == VarintEncoding {
+		return readVarintUint(d)
+	}
+	b, err := d.readN(8)
+	if err != nil {
 		return 0, err
 	}
-	return binary.LittleEndian.Uint64(d.buf[:8]), nil
+	return d.cfg.ByteOrder.binaryOrder().Uint64(b), nil
+}
+
+// ReadI8 reads an int8 from its raw two's-complement byte.
+func (d *BincodeDecoder) ReadI8() (int8, error) {
+	v, err := d.ReadU8()
+	return int8(v), err
+}
+
+// ReadI16 reads an int16, mirroring WriteI16's IntEncoding handling.
+func (d *BincodeDecoder) ReadI16() (int16, error) {
+	if d.cfg.IntEncoding == VarintEncoding {
+		u, err := readVarintUint(d)
+		if err != nil {
+			return 0, err
+		}
+		return int16(zigzagDecode(u)), nil
+	}
+	v, err := d.ReadU16()
+	return int16(v), err
+}
+
+// ReadI32 reads an int32, mirroring WriteI32's IntEncoding handling.
+func (d *BincodeDecoder) ReadI32() (int32, error) {
+	if d.cfg.IntEncoding == VarintEncoding {
+		u, err := readVarintUint(d)
+		if err != nil {
+			return 0, err
+		}
+		return int32(zigzagDecode(u)), nil
+	}
+	v, err := d.ReadU32()
+	return int32(v), err
+}
+
+// ReadI64 reads an int64, mirroring WriteI64's IntEncoding handling.
+func (d *BincodeDecoder) ReadI64() (int64, error) {
+	if d.cfg.IntEncoding == VarintEncoding {
+		u, err := readVarintUint(d)
+		if err != nil {
+			return 0, err
+		}
+		return zigzagDecode(u), nil
+	}
+	v, err := d.ReadU64()
+	return int64(v), err
+}
+
+// ReadF32 reads a float32 via math.Float32frombits. Like WriteF32, this
+// always reads 4 fixed-width bytes regardless of IntEncoding.
+func (d *BincodeDecoder) ReadF32() (float32, error) {
+	b, err := d.readN(4)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float32frombits(d.cfg.ByteOrder.binaryOrder().Uint32(b)), nil
+}
+
+// ReadF64 reads a float64 via math.Float64frombits. Like WriteF64, this
+// always reads 8 fixed-width bytes regardless of IntEncoding.
+func (d *BincodeDecoder) ReadF64() (float64, error) {
+	b, err := d.readN(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(d.cfg.ByteOrder.binaryOrder().Uint64(b)), nil
+}
+
+// ReadEnumTag reads a Rust enum discriminant; see WriteEnumTag.
+func (d *BincodeDecoder) ReadEnumTag() (uint32, error) {
+	return d.ReadU32()
 }
 
 // ReadBool reads a boolean.
@@ -174,36 +500,36 @@ func (d *BincodeDecoder) ReadBool() (bool, error) {
 	return v != 0, nil
 }
 
-// ReadString reads a length-prefixed string.
+// ReadString reads a length-prefixed string. This always copies (a Go
+// string must own its bytes), unlike ReadBytes.
 func (d *BincodeDecoder) ReadString() (string, error) {
-	length, err := d.ReadU64()
+	length, err := d.readLength()
 	if err != nil {
 		return "", err
 	}
-	if length > math.MaxInt32 {
+	if length > math.MaxInt32 || (d.cfg.Limit != 0 && length > d.cfg.Limit) {
 		return "", errors.New("string too long")
 	}
-	buf := make([]byte, length)
-	if _, err := io.ReadFull(d.r, buf); err != nil {
+	b, err := d.readN(int(length))
+	if err != nil {
 		return "", err
 	}
-	return string(buf), nil
+	return string(b), nil
 }
 
-// ReadBytes reads a length-prefixed byte slice.
+// ReadBytes reads a length-prefixed byte slice. When decoding from an
+// in-memory slice, the returned slice directly aliases it with no extra
+// allocation; callers that need to retain it beyond the decoder's lifetime
+// (or beyond a pooled frame's Release) must copy it themselves.
 func (d *BincodeDecoder) ReadBytes() ([]byte, error) {
-	length, err := d.ReadU64()
+	length, err := d.readLength()
 	if err != nil {
 		return nil, err
 	}
-	if length > MaxFrameSize {
+	if length > MaxFrameSize || (d.cfg.Limit != 0 && length > d.cfg.Limit) {
 		return nil, errors.New("bytes too long")
 	}
-	buf := make([]byte, length)
-	if _, err := io.ReadFull(d.r, buf); err != nil {
-		return nil, err
-	}
-	return buf, nil
+	return d.readN(int(length))
 }
 
 // ReadOptionU16 reads an optional uint16.
@@ -252,5 +578,60 @@ func (d *BincodeDecoder) ReadOptionBytes() ([]byte, error) {
 
 // ReadVecLen reads the length of a vector.
 func (d *BincodeDecoder) ReadVecLen() (uint64, error) {
+	return d.readLength()
+}
+
+// readLength reads a string/bytes/vec length through the decoder's
+// configured IntEncoding; see BincodeEncoder.writeLength.
+func (d *BincodeDecoder) readLength() (uint64, error) {
+	if d.cfg.IntEncoding == VarintEncoding {
+		return readVarintUint(d)
+	}
 	return d.ReadU64()
 }
+
+// readVarintUint reads one bincode varint-encoded value: a marker byte
+// that is either the value itself (< 251) or a length marker for a
+// following little-endian u16/u32/u64/u128. u128 values (marker 254) are
+// only representable here if their top 8 bytes are zero.
+func readVarintUint(d *BincodeDecoder) (uint64, error) {
+	marker, err := d.ReadU8()
+	if err != nil {
+		return 0, err
+	}
+	switch marker {
+	case 251:
+		b, err := d.readN(2)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.LittleEndian.Uint16(b)), nil
+	case 252:
+		b, err := d.readN(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.LittleEndian.Uint32(b)), nil
+	case 253:
+		b, err := d.readN(8)
+		if err != nil {
+			return 0, err
+		}
+		return binary.LittleEndian.Uint64(b), nil
+	case 254:
+		b, err := d.readN(16)
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range b[8:] {
+			if c != 0 {
+				return 0, fmt.Errorf("localup: bincode varint u128 value exceeds 64 bits")
+			}
+		}
+		return binary.LittleEndian.Uint64(b[:8]), nil
+	case 255:
+		return 0, fmt.Errorf("localup: invalid bincode varint marker %d", marker)
+	default:
+		return uint64(marker), nil
+	}
+}
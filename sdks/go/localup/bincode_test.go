@@ -0,0 +1,115 @@
+package localup
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestBincodeVarintEncodingRoundTrip exercises every marker boundary in
+// writeVarintUint/readVarintUint (250 vs. 251, u16/u32/u64 rollover) plus
+// zig-zag encoding of negative values.
+func TestBincodeVarintEncodingRoundTrip(t *testing.T) {
+	values := []uint64{0, 1, 250, 251, 252, 65535, 65536, 4294967295, 4294967296, 1<<63 - 1}
+
+	for _, v := range values {
+		enc := NewBincodeEncoderWithConfig(BincodeConfig{IntEncoding: VarintEncoding})
+		enc.WriteU64(v)
+
+		dec := NewBincodeDecoderBytesWithConfig(enc.Bytes(), BincodeConfig{IntEncoding: VarintEncoding})
+		got, err := dec.ReadU64()
+		if err != nil {
+			t.Fatalf("ReadU64(%d): %v", v, err)
+		}
+		if got != v {
+			t.Fatalf("got %d, want %d", got, v)
+		}
+	}
+
+	for _, v := range []int64{0, -1, 125, -125, 1 << 40, -(1 << 40)} {
+		enc := NewBincodeEncoderWithConfig(BincodeConfig{IntEncoding: VarintEncoding})
+		enc.WriteI64(v)
+
+		dec := NewBincodeDecoderBytesWithConfig(enc.Bytes(), BincodeConfig{IntEncoding: VarintEncoding})
+		got, err := dec.ReadI64()
+		if err != nil {
+			t.Fatalf("ReadI64(%d): %v", v, err)
+		}
+		if got != v {
+			t.Fatalf("got %d, want %d", got, v)
+		}
+	}
+}
+
+// TestBincodeBigEndianOrderRoundTrip confirms BigEndianOrder affects
+// FixintEncoding's multi-byte values (including floats).
+func TestBincodeBigEndianOrderRoundTrip(t *testing.T) {
+	cfg := BincodeConfig{ByteOrder: BigEndianOrder}
+	enc := NewBincodeEncoderWithConfig(cfg)
+	enc.WriteU32(0x01020304)
+	enc.WriteF64(3.5)
+
+	want := []byte{0x01, 0x02, 0x03, 0x04}
+	if got := enc.Bytes()[:4]; string(got) != string(want) {
+		t.Fatalf("got % x, want % x (big-endian)", got, want)
+	}
+
+	dec := NewBincodeDecoderBytesWithConfig(enc.Bytes(), cfg)
+	gotU32, err := dec.ReadU32()
+	if err != nil {
+		t.Fatalf("ReadU32: %v", err)
+	}
+	if gotU32 != 0x01020304 {
+		t.Fatalf("got %#x, want %#x", gotU32, 0x01020304)
+	}
+	gotF64, err := dec.ReadF64()
+	if err != nil {
+		t.Fatalf("ReadF64: %v", err)
+	}
+	if gotF64 != 3.5 {
+		t.Fatalf("got %v, want 3.5", gotF64)
+	}
+}
+
+// TestBincodeConfigLimit confirms Limit caps ReadString/ReadBytes beyond
+// the unconditional MaxFrameSize/math.MaxInt32 bounds.
+func TestBincodeConfigLimit(t *testing.T) {
+	enc := NewBincodeEncoder()
+	enc.WriteString("hello world")
+
+	dec := NewBincodeDecoderBytesWithConfig(enc.Bytes(), BincodeConfig{Limit: 4})
+	if _, err := dec.ReadString(); err == nil {
+		t.Fatal("expected ReadString to fail once the length exceeds Limit")
+	}
+}
+
+// TestMessageCodecWithConfig confirms a MessageCodec built with a non-default
+// BincodeConfig actually threads it through EncodeMessage/DecodeMessage,
+// rather than the config only being reachable by hand-building an encoder.
+func TestMessageCodecWithConfig(t *testing.T) {
+	codec := NewMessageCodecWithConfig(BincodeConfig{IntEncoding: VarintEncoding})
+	msg := &UdpDatagramMessage{StreamID: 1, PeerAddr: "203.0.113.5", PeerPort: 53, Data: []byte{1, 2, 3, 4}}
+
+	data, err := codec.EncodeMessage(msg)
+	if err != nil {
+		t.Fatalf("EncodeMessage: %v", err)
+	}
+
+	got, err := codec.DecodeMessageBytes(data[LengthPrefixSize:])
+	if err != nil {
+		t.Fatalf("DecodeMessageBytes: %v", err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Fatalf("got %#v, want %#v", got, msg)
+	}
+
+	// A VarintEncoding StreamID of 1 fits in bincode's single-byte range,
+	// so the payload must be shorter than the FixintEncoding default's
+	// fixed-width u32 field would produce.
+	defaultData, err := NewMessageCodec().EncodeMessage(msg)
+	if err != nil {
+		t.Fatalf("EncodeMessage (default): %v", err)
+	}
+	if len(data) >= len(defaultData) {
+		t.Fatalf("varint-encoded payload (%d bytes) not shorter than default (%d bytes)", len(data), len(defaultData))
+	}
+}
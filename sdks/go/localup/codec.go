@@ -5,25 +5,72 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 )
 
 // MessageCodec encodes and decodes TunnelMessages.
-type MessageCodec struct{}
+type MessageCodec struct {
+	cfg BincodeConfig
+}
 
-// NewMessageCodec creates a new message codec.
+// NewMessageCodec creates a new message codec using FixintEncoding/
+// LittleEndianOrder, this package's original wire format.
 func NewMessageCodec() *MessageCodec {
-	return &MessageCodec{}
+	return NewMessageCodecWithConfig(BincodeConfig{})
+}
+
+// NewMessageCodecWithConfig creates a message codec using cfg, e.g.
+// BincodeConfig{IntEncoding: VarintEncoding} to interop with a Rust peer
+// built against bincode 2's default configuration. Every TunnelMessage
+// encoded or decoded through this codec uses cfg, so both ends of a tunnel
+// must agree on it; see NewBincodeWireFormatWithConfig/WithWireFormats.
+func NewMessageCodecWithConfig(cfg BincodeConfig) *MessageCodec {
+	return &MessageCodec{cfg: cfg}
 }
 
 // EncodeMessage encodes a TunnelMessage to bytes.
 // Format: [4-byte big-endian length][bincode payload]
 func (c *MessageCodec) EncodeMessage(msg TunnelMessage) ([]byte, error) {
-	enc := NewBincodeEncoder()
+	enc := NewBincodeEncoderWithConfig(c.cfg)
+	if err := c.encodeFields(enc, msg); err != nil {
+		return nil, err
+	}
+
+	payload := enc.Bytes()
+
+	// Prepend length (big-endian)
+	result := make([]byte, LengthPrefixSize+len(payload))
+	binary.BigEndian.PutUint32(result[:LengthPrefixSize], uint32(len(payload)))
+	copy(result[LengthPrefixSize:], payload)
+
+	return result, nil
+}
+
+// EncodeInto writes msg to w as [4-byte big-endian length][bincode payload],
+// like EncodeMessage, but writes the length prefix and the encoder's buffer
+// straight to w instead of concatenating them into an intermediate
+// result := make([]byte, ...) first.
+func (c *MessageCodec) EncodeInto(msg TunnelMessage, w io.Writer) error {
+	enc := NewBincodeEncoderWithConfig(c.cfg)
+	if err := c.encodeFields(enc, msg); err != nil {
+		return err
+	}
+	payload := enc.Bytes()
+
+	var lengthBuf [LengthPrefixSize]byte
+	binary.BigEndian.PutUint32(lengthBuf[:], uint32(len(payload)))
+	if _, err := w.Write(lengthBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
 
-	// Write the enum variant index
+// encodeFields writes the enum variant index and message-specific fields
+// shared by EncodeMessage and EncodeInto.
+func (c *MessageCodec) encodeFields(enc *BincodeEncoder, msg TunnelMessage) error {
 	enc.WriteU32(uint32(msg.MessageType()))
 
-	// Encode the message-specific fields
 	switch m := msg.(type) {
 	case *ConnectMessage:
 		c.encodeConnect(enc, m)
@@ -41,18 +88,35 @@ func (c *MessageCodec) EncodeMessage(msg TunnelMessage) ([]byte, error) {
 		enc.WriteU32(m.StreamID)
 		enc.WriteString(m.RemoteAddr)
 		enc.WriteU16(m.RemotePort)
+		enc.WriteBytes(m.ProxyProtocolV2)
 	case *TcpDataMessage:
 		enc.WriteU32(m.StreamID)
 		enc.WriteBytes(m.Data)
+		enc.WriteBool(m.Compressed)
+		enc.WriteU32(m.OrigLen)
 	case *TcpCloseMessage:
 		enc.WriteU32(m.StreamID)
 	case *TlsConnectMessage:
 		enc.WriteU32(m.StreamID)
 		enc.WriteString(m.SNI)
 		enc.WriteBytes(m.ClientHello)
+		enc.WriteBytes(m.ProxyProtocolV2)
+		enc.WriteVecLen(len(m.ALPNOffers))
+		for _, alpn := range m.ALPNOffers {
+			enc.WriteString(alpn)
+		}
+		enc.WriteString(m.JA3)
+		enc.WriteString(m.JA4)
+		enc.WriteVecLen(len(m.ClientCertChain))
+		for _, cert := range m.ClientCertChain {
+			enc.WriteBytes(cert)
+		}
+		enc.WriteString(m.ClientCertSHA256)
 	case *TlsDataMessage:
 		enc.WriteU32(m.StreamID)
 		enc.WriteBytes(m.Data)
+		enc.WriteBool(m.Compressed)
+		enc.WriteU32(m.OrigLen)
 	case *TlsCloseMessage:
 		enc.WriteU32(m.StreamID)
 	case *HttpRequestMessage:
@@ -63,6 +127,8 @@ func (c *MessageCodec) EncodeMessage(msg TunnelMessage) ([]byte, error) {
 		enc.WriteU32(m.StreamID)
 		enc.WriteBytes(m.Chunk)
 		enc.WriteBool(m.IsFinal)
+		enc.WriteBool(m.Compressed)
+		enc.WriteU32(m.OrigLen)
 	case *HttpStreamConnectMessage:
 		enc.WriteU32(m.StreamID)
 		enc.WriteString(m.Host)
@@ -70,20 +136,81 @@ func (c *MessageCodec) EncodeMessage(msg TunnelMessage) ([]byte, error) {
 	case *HttpStreamDataMessage:
 		enc.WriteU32(m.StreamID)
 		enc.WriteBytes(m.Data)
+		enc.WriteBool(m.Compressed)
+		enc.WriteU32(m.OrigLen)
 	case *HttpStreamCloseMessage:
 		enc.WriteU32(m.StreamID)
+	case *TlsTermConnectMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteString(m.RemoteAddr)
+		enc.WriteU16(m.RemotePort)
+		enc.WriteString(m.SNI)
+		enc.WriteString(m.ALPN)
+		enc.WriteString(m.CipherSuite)
+		enc.WriteString(m.ClientCertSHA256)
+	case *TlsTermDataMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteBytes(m.Data)
+	case *TlsTermCloseMessage:
+		enc.WriteU32(m.StreamID)
+	case *Http3StreamConnectMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteString(m.Host)
+		enc.WriteString(m.ALPN)
+		enc.WriteBytes(m.InitialData)
+	case *Http3StreamDataMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteBytes(m.Data)
+	case *Http3StreamCloseMessage:
+		enc.WriteU32(m.StreamID)
+	case *QuicDatagramMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteBytes(m.Data)
+	case *StreamWindowUpdateMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteU32(m.Delta)
+	case *StreamResetMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteU32(m.ErrorCode)
+	case *UdpBindMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteString(m.RemoteAddr)
+		enc.WriteU16(m.RemotePort)
+	case *UdpDatagramMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteString(m.PeerAddr)
+		enc.WriteU16(m.PeerPort)
+		enc.WriteBytes(m.Data)
+	case *UdpCloseMessage:
+		enc.WriteU32(m.StreamID)
+	case *CertUpdateMessage:
+		enc.WriteString(m.TunnelID)
+		enc.WriteString(m.Domain)
+		enc.WriteOptionBytes(m.CertPEM)
+		enc.WriteOptionBytes(m.KeyPEM)
+	case *HttpRequestHeadersMessage:
+		c.encodeHttpRequestHeaders(enc, m)
+	case *HttpResponseHeadersMessage:
+		c.encodeHttpResponseHeaders(enc, m)
+	case *HttpBodyChunkMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteBytes(m.Data)
+		enc.WriteBool(m.Compressed)
+		enc.WriteU32(m.OrigLen)
+	case *HttpTrailersMessage:
+		enc.WriteU32(m.StreamID)
+		enc.WriteVecLen(len(m.Trailers))
+		for k, v := range m.Trailers {
+			enc.WriteString(k)
+			enc.WriteString(v)
+		}
+	case *HttpEndMessage:
+		enc.WriteU32(m.StreamID)
 	default:
-		return nil, fmt.Errorf("unknown message type: %T", msg)
+		return fmt.Errorf("unknown message type: %T", msg)
 	}
 
-	payload := enc.Bytes()
-
-	// Prepend length (big-endian)
-	result := make([]byte, LengthPrefixSize+len(payload))
-	binary.BigEndian.PutUint32(result[:LengthPrefixSize], uint32(len(payload)))
-	copy(result[LengthPrefixSize:], payload)
-
-	return result, nil
+	return nil
 }
 
 // DecodeMessage decodes a TunnelMessage from a reader.
@@ -109,9 +236,99 @@ func (c *MessageCodec) DecodeMessage(r io.Reader) (TunnelMessage, error) {
 	return c.DecodeMessageBytes(payload)
 }
 
+// framePool holds reusable byte buffers for DecodeInto, keyed loosely by
+// power-of-two size so frames of similar size actually get to reuse each
+// other's backing array instead of constantly reallocating.
+var framePool = sync.Pool{
+	New: func() any { return make([]byte, 0) },
+}
+
+func framePoolSize(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+	return size
+}
+
+func framePoolGet(length int) []byte {
+	buf, _ := framePool.Get().([]byte)
+	if cap(buf) < length {
+		return make([]byte, length, framePoolSize(length))
+	}
+	return buf[:length]
+}
+
+func framePoolPut(buf []byte) {
+	framePool.Put(buf[:0]) //nolint:staticcheck // intentionally reusing the backing array
+}
+
+// PooledFrame is the frame buffer leased by DecodeInto for *TcpDataMessage,
+// *TlsDataMessage, and *HttpStreamDataMessage — the hot data-carrying
+// variants on a busy tunnel, whose Data field is a direct subslice of this
+// buffer (see BincodeDecoder.ReadBytes). Release must be called once the
+// caller is done with that Data, typically right after writing it to the
+// upstream socket, to return the buffer to framePool; Data must not be
+// touched afterward.
+type PooledFrame struct {
+	buf []byte
+}
+
+// Release returns the frame's buffer to framePool.
+func (f *PooledFrame) Release() {
+	if f == nil {
+		return
+	}
+	framePoolPut(f.buf)
+}
+
+// DecodeInto decodes a TunnelMessage from r like DecodeMessage, but leases
+// its payload buffer from framePool instead of allocating a fresh one every
+// call, and — since BincodeDecoder.ReadBytes now returns direct subslices of
+// an in-memory payload rather than copying — hands data-carrying messages'
+// Data field back as a subslice of that same pooled buffer with no
+// additional allocation. The returned PooledFrame is nil for every other
+// message type; their byte fields (e.g. HttpRequestMessage.Body) may still
+// alias the buffer, so it is left to the garbage collector rather than
+// returned to framePool. When non-nil, the caller must call Release once
+// done reading Data.
+func (c *MessageCodec) DecodeInto(r io.Reader) (TunnelMessage, *PooledFrame, error) {
+	var lengthBuf [LengthPrefixSize]byte
+	if _, err := io.ReadFull(r, lengthBuf[:]); err != nil {
+		return nil, nil, fmt.Errorf("failed to read length: %w", err)
+	}
+	length := binary.BigEndian.Uint32(lengthBuf[:])
+
+	if length > MaxFrameSize {
+		return nil, nil, fmt.Errorf("message too large: %d bytes", length)
+	}
+
+	buf := framePoolGet(int(length))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		framePoolPut(buf)
+		return nil, nil, fmt.Errorf("failed to read payload: %w", err)
+	}
+
+	msg, err := c.DecodeMessageBytes(buf)
+	if err != nil {
+		framePoolPut(buf)
+		return nil, nil, err
+	}
+
+	switch msg.(type) {
+	case *TcpDataMessage, *TlsDataMessage, *HttpStreamDataMessage:
+		return msg, &PooledFrame{buf: buf}, nil
+	default:
+		return msg, nil, nil
+	}
+}
+
 // DecodeMessageBytes decodes a TunnelMessage from bytes (without length prefix).
 func (c *MessageCodec) DecodeMessageBytes(data []byte) (TunnelMessage, error) {
-	dec := NewBincodeDecoderBytes(data)
+	dec := NewBincodeDecoderBytesWithConfig(data, c.cfg)
 
 	// Read the enum variant index
 	variant, err := dec.ReadU32()
@@ -186,6 +403,58 @@ func (c *MessageCodec) DecodeMessageBytes(data []byte) (TunnelMessage, error) {
 			return nil, err
 		}
 		return &HttpStreamCloseMessage{StreamID: id}, nil
+	case MessageTypeTlsTermConnect:
+		return c.decodeTlsTermConnect(dec)
+	case MessageTypeTlsTermData:
+		return c.decodeTlsTermData(dec)
+	case MessageTypeTlsTermClose:
+		id, err := dec.ReadU32()
+		if err != nil {
+			return nil, err
+		}
+		return &TlsTermCloseMessage{StreamID: id}, nil
+	case MessageTypeHttp3StreamConnect:
+		return c.decodeHttp3StreamConnect(dec)
+	case MessageTypeHttp3StreamData:
+		return c.decodeHttp3StreamData(dec)
+	case MessageTypeHttp3StreamClose:
+		id, err := dec.ReadU32()
+		if err != nil {
+			return nil, err
+		}
+		return &Http3StreamCloseMessage{StreamID: id}, nil
+	case MessageTypeQuicDatagram:
+		return c.decodeQuicDatagram(dec)
+	case MessageTypeStreamWindowUpdate:
+		return c.decodeStreamWindowUpdate(dec)
+	case MessageTypeStreamReset:
+		return c.decodeStreamReset(dec)
+	case MessageTypeUdpBind:
+		return c.decodeUdpBind(dec)
+	case MessageTypeUdpDatagram:
+		return c.decodeUdpDatagram(dec)
+	case MessageTypeUdpClose:
+		id, err := dec.ReadU32()
+		if err != nil {
+			return nil, err
+		}
+		return &UdpCloseMessage{StreamID: id}, nil
+	case MessageTypeCertUpdate:
+		return c.decodeCertUpdate(dec)
+	case MessageTypeHttpRequestHeaders:
+		return c.decodeHttpRequestHeaders(dec)
+	case MessageTypeHttpResponseHeaders:
+		return c.decodeHttpResponseHeaders(dec)
+	case MessageTypeHttpBodyChunk:
+		return c.decodeHttpBodyChunk(dec)
+	case MessageTypeHttpTrailers:
+		return c.decodeHttpTrailers(dec)
+	case MessageTypeHttpEnd:
+		id, err := dec.ReadU32()
+		if err != nil {
+			return nil, err
+		}
+		return &HttpEndMessage{StreamID: id}, nil
 	default:
 		return nil, fmt.Errorf("unknown message type: %d", variant)
 	}
@@ -223,6 +492,21 @@ func (c *MessageCodec) encodeProtocolSpec(enc *BincodeEncoder, p *ProtocolSpec)
 	case "https":
 		enc.WriteU32(3) // Https variant
 		enc.WriteOptionString(p.Subdomain)
+		enc.WriteString(p.Domain)
+		enc.WriteBool(p.ManagedCert)
+	case "tls-terminated":
+		enc.WriteU32(4) // TlsTerminated variant
+		enc.WriteU16(p.Port)
+		enc.WriteString(p.CertSource)
+		enc.WriteString(p.CertBundleID)
+	case "udp":
+		enc.WriteU32(5) // Udp variant
+		enc.WriteU16(p.Port)
+	}
+
+	enc.WriteVecLen(len(p.Compression))
+	for _, alg := range p.Compression {
+		enc.WriteString(alg)
 	}
 }
 
@@ -245,6 +529,10 @@ func (c *MessageCodec) encodeTunnelConfig(enc *BincodeEncoder, cfg *TunnelConfig
 
 	enc.WriteBool(cfg.EnableCompression)
 	enc.WriteBool(cfg.EnableMultiplexing)
+	enc.WriteBool(cfg.EnableHTTP3)
+	enc.WriteU32(cfg.HTTP3IdleTimeoutSecs)
+	enc.WriteU32(cfg.MaxConcurrentStreams)
+	enc.WriteBool(cfg.EnableHeaderCompression)
 }
 
 // encodeExitNodeConfig encodes an exit node configuration.
@@ -280,6 +568,8 @@ func (c *MessageCodec) encodeConnected(enc *BincodeEncoder, m *ConnectedMessage)
 		enc.WriteString(ep.URL)
 		enc.WriteU16(ep.Port)
 	}
+	enc.WriteString(m.ChosenCompression)
+	enc.WriteBool(m.HeaderCompressionEnabled)
 }
 
 // encodeHttpRequest encodes an HttpRequestMessage.
@@ -296,6 +586,9 @@ func (c *MessageCodec) encodeHttpRequest(enc *BincodeEncoder, m *HttpRequestMess
 	}
 
 	enc.WriteOptionBytes(m.Body)
+	enc.WriteBool(m.Compressed)
+	enc.WriteU32(m.OrigLen)
+	enc.WriteOptionBytes(m.HeaderBlock)
 }
 
 // encodeHttpResponse encodes an HttpResponseMessage.
@@ -311,6 +604,40 @@ func (c *MessageCodec) encodeHttpResponse(enc *BincodeEncoder, m *HttpResponseMe
 	}
 
 	enc.WriteOptionBytes(m.Body)
+	enc.WriteBool(m.Compressed)
+	enc.WriteU32(m.OrigLen)
+	enc.WriteOptionBytes(m.HeaderBlock)
+}
+
+// encodeHttpRequestHeaders encodes an HttpRequestHeadersMessage.
+func (c *MessageCodec) encodeHttpRequestHeaders(enc *BincodeEncoder, m *HttpRequestHeadersMessage) {
+	enc.WriteU32(m.StreamID)
+	enc.WriteString(m.Method)
+	enc.WriteString(m.URI)
+
+	enc.WriteVecLen(len(m.Headers))
+	for k, v := range m.Headers {
+		enc.WriteString(k)
+		enc.WriteString(v)
+	}
+
+	enc.WriteI64(m.ContentLength)
+	enc.WriteOptionBytes(m.HeaderBlock)
+}
+
+// encodeHttpResponseHeaders encodes an HttpResponseHeadersMessage.
+func (c *MessageCodec) encodeHttpResponseHeaders(enc *BincodeEncoder, m *HttpResponseHeadersMessage) {
+	enc.WriteU32(m.StreamID)
+	enc.WriteU16(m.Status)
+
+	enc.WriteVecLen(len(m.Headers))
+	for k, v := range m.Headers {
+		enc.WriteString(k)
+		enc.WriteString(v)
+	}
+
+	enc.WriteI64(m.ContentLength)
+	enc.WriteOptionBytes(m.HeaderBlock)
 }
 
 // decodeConnect decodes a ConnectMessage.
@@ -377,6 +704,28 @@ func (c *MessageCodec) decodeProtocolSpec(dec *BincodeDecoder) (*ProtocolSpec, e
 	case 3: // Https
 		spec.Type = "https"
 		spec.Subdomain, err = dec.ReadOptionString()
+		if err != nil {
+			return nil, err
+		}
+		spec.Domain, err = dec.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		spec.ManagedCert, err = dec.ReadBool()
+	case 4: // TlsTerminated
+		spec.Type = "tls-terminated"
+		spec.Port, err = dec.ReadU16()
+		if err != nil {
+			return nil, err
+		}
+		spec.CertSource, err = dec.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		spec.CertBundleID, err = dec.ReadString()
+	case 5: // Udp
+		spec.Type = "udp"
+		spec.Port, err = dec.ReadU16()
 	default:
 		return nil, fmt.Errorf("unknown protocol variant: %d", variant)
 	}
@@ -384,6 +733,21 @@ func (c *MessageCodec) decodeProtocolSpec(dec *BincodeDecoder) (*ProtocolSpec, e
 	if err != nil {
 		return nil, err
 	}
+
+	compressionCount, err := dec.ReadVecLen()
+	if err != nil {
+		return nil, err
+	}
+	if compressionCount > 0 {
+		spec.Compression = make([]string, compressionCount)
+		for i := range spec.Compression {
+			spec.Compression[i], err = dec.ReadString()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return spec, nil
 }
 
@@ -432,16 +796,36 @@ func (c *MessageCodec) decodeTunnelConfig(dec *BincodeDecoder) (*TunnelConfigMsg
 	if err != nil {
 		return nil, err
 	}
+	enableHTTP3, err := dec.ReadBool()
+	if err != nil {
+		return nil, err
+	}
+	http3IdleTimeoutSecs, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	maxConcurrentStreams, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	enableHeaderCompression, err := dec.ReadBool()
+	if err != nil {
+		return nil, err
+	}
 
 	return &TunnelConfigMsg{
-		LocalHost:          localHost,
-		LocalPort:          localPort,
-		LocalHTTPS:         localHTTPS,
-		ExitNode:           *exitNode,
-		Failover:           failover,
-		IPAllowlist:        ipAllowlist,
-		EnableCompression:  enableCompression,
-		EnableMultiplexing: enableMultiplexing,
+		LocalHost:               localHost,
+		LocalPort:               localPort,
+		LocalHTTPS:              localHTTPS,
+		ExitNode:                *exitNode,
+		Failover:                failover,
+		IPAllowlist:             ipAllowlist,
+		EnableCompression:       enableCompression,
+		EnableMultiplexing:      enableMultiplexing,
+		EnableHTTP3:             enableHTTP3,
+		HTTP3IdleTimeoutSecs:    http3IdleTimeoutSecs,
+		MaxConcurrentStreams:    maxConcurrentStreams,
+		EnableHeaderCompression: enableHeaderCompression,
 	}, nil
 }
 
@@ -534,9 +918,20 @@ func (c *MessageCodec) decodeConnected(dec *BincodeDecoder) (*ConnectedMessage,
 		}
 	}
 
+	chosenCompression, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	headerCompressionEnabled, err := dec.ReadBool()
+	if err != nil {
+		return nil, err
+	}
+
 	return &ConnectedMessage{
-		TunnelID:  tunnelID,
-		Endpoints: endpoints,
+		TunnelID:                 tunnelID,
+		Endpoints:                endpoints,
+		ChosenCompression:        chosenCompression,
+		HeaderCompressionEnabled: headerCompressionEnabled,
 	}, nil
 }
 
@@ -554,10 +949,15 @@ func (c *MessageCodec) decodeTcpConnect(dec *BincodeDecoder) (*TcpConnectMessage
 	if err != nil {
 		return nil, err
 	}
+	proxyProtocolV2, err := dec.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
 	return &TcpConnectMessage{
-		StreamID:   streamID,
-		RemoteAddr: remoteAddr,
-		RemotePort: remotePort,
+		StreamID:        streamID,
+		RemoteAddr:      remoteAddr,
+		RemotePort:      remotePort,
+		ProxyProtocolV2: proxyProtocolV2,
 	}, nil
 }
 
@@ -571,9 +971,19 @@ func (c *MessageCodec) decodeTcpData(dec *BincodeDecoder) (*TcpDataMessage, erro
 	if err != nil {
 		return nil, err
 	}
+	compressed, err := dec.ReadBool()
+	if err != nil {
+		return nil, err
+	}
+	origLen, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
 	return &TcpDataMessage{
-		StreamID: streamID,
-		Data:     data,
+		StreamID:   streamID,
+		Data:       data,
+		Compressed: compressed,
+		OrigLen:    origLen,
 	}, nil
 }
 
@@ -591,10 +1001,60 @@ func (c *MessageCodec) decodeTlsConnect(dec *BincodeDecoder) (*TlsConnectMessage
 	if err != nil {
 		return nil, err
 	}
+	proxyProtocolV2, err := dec.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	alpnCount, err := dec.ReadVecLen()
+	if err != nil {
+		return nil, err
+	}
+	var alpnOffers []string
+	if alpnCount > 0 {
+		alpnOffers = make([]string, alpnCount)
+		for i := range alpnOffers {
+			alpnOffers[i], err = dec.ReadString()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	ja3, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	ja4, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	certCount, err := dec.ReadVecLen()
+	if err != nil {
+		return nil, err
+	}
+	var clientCertChain [][]byte
+	if certCount > 0 {
+		clientCertChain = make([][]byte, certCount)
+		for i := range clientCertChain {
+			clientCertChain[i], err = dec.ReadBytes()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	clientCertSHA256, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
 	return &TlsConnectMessage{
-		StreamID:    streamID,
-		SNI:         sni,
-		ClientHello: clientHello,
+		StreamID:         streamID,
+		SNI:              sni,
+		ClientHello:      clientHello,
+		ProxyProtocolV2:  proxyProtocolV2,
+		ALPNOffers:       alpnOffers,
+		JA3:              ja3,
+		JA4:              ja4,
+		ClientCertChain:  clientCertChain,
+		ClientCertSHA256: clientCertSHA256,
 	}, nil
 }
 
@@ -608,9 +1068,19 @@ func (c *MessageCodec) decodeTlsData(dec *BincodeDecoder) (*TlsDataMessage, erro
 	if err != nil {
 		return nil, err
 	}
+	compressed, err := dec.ReadBool()
+	if err != nil {
+		return nil, err
+	}
+	origLen, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
 	return &TlsDataMessage{
-		StreamID: streamID,
-		Data:     data,
+		StreamID:   streamID,
+		Data:       data,
+		Compressed: compressed,
+		OrigLen:    origLen,
 	}, nil
 }
 
@@ -650,13 +1120,28 @@ func (c *MessageCodec) decodeHttpRequest(dec *BincodeDecoder) (*HttpRequestMessa
 	if err != nil {
 		return nil, err
 	}
+	compressed, err := dec.ReadBool()
+	if err != nil {
+		return nil, err
+	}
+	origLen, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	headerBlock, err := dec.ReadOptionBytes()
+	if err != nil {
+		return nil, err
+	}
 
 	return &HttpRequestMessage{
-		StreamID: streamID,
-		Method:   method,
-		URI:      uri,
-		Headers:  headers,
-		Body:     body,
+		StreamID:    streamID,
+		Method:      method,
+		URI:         uri,
+		Headers:     headers,
+		Body:        body,
+		Compressed:  compressed,
+		OrigLen:     origLen,
+		HeaderBlock: headerBlock,
 	}, nil
 }
 
@@ -692,12 +1177,27 @@ func (c *MessageCodec) decodeHttpResponse(dec *BincodeDecoder) (*HttpResponseMes
 	if err != nil {
 		return nil, err
 	}
+	compressed, err := dec.ReadBool()
+	if err != nil {
+		return nil, err
+	}
+	origLen, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	headerBlock, err := dec.ReadOptionBytes()
+	if err != nil {
+		return nil, err
+	}
 
 	return &HttpResponseMessage{
-		StreamID: streamID,
-		Status:   status,
-		Headers:  headers,
-		Body:     body,
+		StreamID:    streamID,
+		Status:      status,
+		Headers:     headers,
+		Body:        body,
+		Compressed:  compressed,
+		OrigLen:     origLen,
+		HeaderBlock: headerBlock,
 	}, nil
 }
 
@@ -715,10 +1215,20 @@ func (c *MessageCodec) decodeHttpChunk(dec *BincodeDecoder) (*HttpChunkMessage,
 	if err != nil {
 		return nil, err
 	}
-	return &HttpChunkMessage{
-		StreamID: streamID,
-		Chunk:    chunk,
-		IsFinal:  isFinal,
+	compressed, err := dec.ReadBool()
+	if err != nil {
+		return nil, err
+	}
+	origLen, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	return &HttpChunkMessage{
+		StreamID:   streamID,
+		Chunk:      chunk,
+		IsFinal:    isFinal,
+		Compressed: compressed,
+		OrigLen:    origLen,
 	}, nil
 }
 
@@ -753,11 +1263,355 @@ func (c *MessageCodec) decodeHttpStreamData(dec *BincodeDecoder) (*HttpStreamDat
 	if err != nil {
 		return nil, err
 	}
+	compressed, err := dec.ReadBool()
+	if err != nil {
+		return nil, err
+	}
+	origLen, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
 	return &HttpStreamDataMessage{
+		StreamID:   streamID,
+		Data:       data,
+		Compressed: compressed,
+		OrigLen:    origLen,
+	}, nil
+}
+
+// decodeTlsTermConnect decodes a TlsTermConnectMessage.
+func (c *MessageCodec) decodeTlsTermConnect(dec *BincodeDecoder) (*TlsTermConnectMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	remoteAddr, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	remotePort, err := dec.ReadU16()
+	if err != nil {
+		return nil, err
+	}
+	sni, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	alpn, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	cipherSuite, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	clientCertSHA256, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	return &TlsTermConnectMessage{
+		StreamID:         streamID,
+		RemoteAddr:       remoteAddr,
+		RemotePort:       remotePort,
+		SNI:              sni,
+		ALPN:             alpn,
+		CipherSuite:      cipherSuite,
+		ClientCertSHA256: clientCertSHA256,
+	}, nil
+}
+
+// decodeTlsTermData decodes a TlsTermDataMessage.
+func (c *MessageCodec) decodeTlsTermData(dec *BincodeDecoder) (*TlsTermDataMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	data, err := dec.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &TlsTermDataMessage{
 		StreamID: streamID,
 		Data:     data,
 	}, nil
 }
 
+// decodeHttp3StreamConnect decodes an Http3StreamConnectMessage.
+func (c *MessageCodec) decodeHttp3StreamConnect(dec *BincodeDecoder) (*Http3StreamConnectMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	host, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	alpn, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	initialData, err := dec.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &Http3StreamConnectMessage{
+		StreamID:    streamID,
+		Host:        host,
+		ALPN:        alpn,
+		InitialData: initialData,
+	}, nil
+}
+
+// decodeHttp3StreamData decodes an Http3StreamDataMessage.
+func (c *MessageCodec) decodeHttp3StreamData(dec *BincodeDecoder) (*Http3StreamDataMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	data, err := dec.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &Http3StreamDataMessage{
+		StreamID: streamID,
+		Data:     data,
+	}, nil
+}
+
+// decodeQuicDatagram decodes a QuicDatagramMessage.
+func (c *MessageCodec) decodeQuicDatagram(dec *BincodeDecoder) (*QuicDatagramMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	data, err := dec.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &QuicDatagramMessage{
+		StreamID: streamID,
+		Data:     data,
+	}, nil
+}
+
+// decodeStreamWindowUpdate decodes a StreamWindowUpdateMessage.
+func (c *MessageCodec) decodeStreamWindowUpdate(dec *BincodeDecoder) (*StreamWindowUpdateMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	delta, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	return &StreamWindowUpdateMessage{StreamID: streamID, Delta: delta}, nil
+}
+
+// decodeStreamReset decodes a StreamResetMessage.
+func (c *MessageCodec) decodeStreamReset(dec *BincodeDecoder) (*StreamResetMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	errorCode, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	return &StreamResetMessage{StreamID: streamID, ErrorCode: errorCode}, nil
+}
+
+// decodeUdpBind decodes a UdpBindMessage.
+func (c *MessageCodec) decodeUdpBind(dec *BincodeDecoder) (*UdpBindMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	remoteAddr, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	remotePort, err := dec.ReadU16()
+	if err != nil {
+		return nil, err
+	}
+	return &UdpBindMessage{StreamID: streamID, RemoteAddr: remoteAddr, RemotePort: remotePort}, nil
+}
+
+// decodeUdpDatagram decodes a UdpDatagramMessage.
+func (c *MessageCodec) decodeUdpDatagram(dec *BincodeDecoder) (*UdpDatagramMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	peerAddr, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	peerPort, err := dec.ReadU16()
+	if err != nil {
+		return nil, err
+	}
+	data, err := dec.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &UdpDatagramMessage{StreamID: streamID, PeerAddr: peerAddr, PeerPort: peerPort, Data: data}, nil
+}
+
+// decodeCertUpdate decodes a CertUpdateMessage.
+func (c *MessageCodec) decodeCertUpdate(dec *BincodeDecoder) (*CertUpdateMessage, error) {
+	tunnelID, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	domain, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	certPEM, err := dec.ReadOptionBytes()
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := dec.ReadOptionBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &CertUpdateMessage{TunnelID: tunnelID, Domain: domain, CertPEM: certPEM, KeyPEM: keyPEM}, nil
+}
+
+// decodeHttpRequestHeaders decodes an HttpRequestHeadersMessage.
+func (c *MessageCodec) decodeHttpRequestHeaders(dec *BincodeDecoder) (*HttpRequestHeadersMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	method, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	uri, err := dec.ReadString()
+	if err != nil {
+		return nil, err
+	}
+
+	headerCount, err := dec.ReadVecLen()
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, headerCount)
+	for i := uint64(0); i < headerCount; i++ {
+		key, err := dec.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := dec.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		headers[key] = value
+	}
+
+	contentLength, err := dec.ReadI64()
+	if err != nil {
+		return nil, err
+	}
+	headerBlock, err := dec.ReadOptionBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &HttpRequestHeadersMessage{
+		StreamID: streamID, Method: method, URI: uri, Headers: headers,
+		ContentLength: contentLength, HeaderBlock: headerBlock,
+	}, nil
+}
+
+// decodeHttpResponseHeaders decodes an HttpResponseHeadersMessage.
+func (c *MessageCodec) decodeHttpResponseHeaders(dec *BincodeDecoder) (*HttpResponseHeadersMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	status, err := dec.ReadU16()
+	if err != nil {
+		return nil, err
+	}
+
+	headerCount, err := dec.ReadVecLen()
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, headerCount)
+	for i := uint64(0); i < headerCount; i++ {
+		key, err := dec.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := dec.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		headers[key] = value
+	}
+
+	contentLength, err := dec.ReadI64()
+	if err != nil {
+		return nil, err
+	}
+	headerBlock, err := dec.ReadOptionBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &HttpResponseHeadersMessage{
+		StreamID: streamID, Status: status, Headers: headers,
+		ContentLength: contentLength, HeaderBlock: headerBlock,
+	}, nil
+}
+
+// decodeHttpBodyChunk decodes an HttpBodyChunkMessage.
+func (c *MessageCodec) decodeHttpBodyChunk(dec *BincodeDecoder) (*HttpBodyChunkMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	data, err := dec.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := dec.ReadBool()
+	if err != nil {
+		return nil, err
+	}
+	origLen, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	return &HttpBodyChunkMessage{StreamID: streamID, Data: data, Compressed: compressed, OrigLen: origLen}, nil
+}
+
+// decodeHttpTrailers decodes an HttpTrailersMessage.
+func (c *MessageCodec) decodeHttpTrailers(dec *BincodeDecoder) (*HttpTrailersMessage, error) {
+	streamID, err := dec.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	count, err := dec.ReadVecLen()
+	if err != nil {
+		return nil, err
+	}
+	trailers := make(map[string]string, count)
+	for i := uint64(0); i < count; i++ {
+		key, err := dec.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := dec.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		trailers[key] = value
+	}
+	return &HttpTrailersMessage{StreamID: streamID, Trailers: trailers}, nil
+}
+
 // ErrConnectionClosed is returned when the connection is closed.
 var ErrConnectionClosed = errors.New("connection closed")
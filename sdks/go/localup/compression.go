@@ -0,0 +1,229 @@
+package localup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionAlgorithm identifies a data-frame compression algorithm
+// negotiated between a tunnel client and the relay.
+type CompressionAlgorithm string
+
+const (
+	CompressionNone   CompressionAlgorithm = "none"
+	CompressionZstd   CompressionAlgorithm = "zstd"
+	CompressionSnappy CompressionAlgorithm = "snappy"
+	CompressionGzip   CompressionAlgorithm = "gzip"
+)
+
+// supportedCompressionAlgorithms lists the algorithms this SDK can encode,
+// in preference order. It's advertised in ProtocolSpec.Compression so the
+// relay can pick the strongest algorithm both sides support.
+var supportedCompressionAlgorithms = []string{
+	string(CompressionZstd),
+	string(CompressionSnappy),
+	string(CompressionGzip),
+}
+
+// Minimum frame size below which compressing isn't worth the CPU cost,
+// roughly matching the break-even sizes CompressionBreakEven measures for
+// each algorithm's per-frame overhead.
+const (
+	minCompressSizeZstd   = 256
+	minCompressSizeSnappy = 128
+	minCompressSizeGzip   = 512
+)
+
+func minCompressSize(alg CompressionAlgorithm) int {
+	switch alg {
+	case CompressionZstd:
+		return minCompressSizeZstd
+	case CompressionSnappy:
+		return minCompressSizeSnappy
+	case CompressionGzip:
+		return minCompressSizeGzip
+	default:
+		return 0
+	}
+}
+
+var (
+	zstdEncoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+	zstdDecoderOnce sync.Once
+	zstdDecoder     *zstd.Decoder
+)
+
+// getZstdEncoder/getZstdDecoder share a single zstd encoder/decoder across
+// every stream of every tunnel in the process, so its setup cost is paid
+// once. Each EncodeAll/DecodeAll call still handles one frame on its own:
+// no dictionary or history is carried from one frame to the next.
+func getZstdEncoder() *zstd.Encoder {
+	zstdEncoderOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	})
+	return zstdEncoder
+}
+
+func getZstdDecoder() *zstd.Decoder {
+	zstdDecoderOnce.Do(func() {
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+	return zstdDecoder
+}
+
+func compressBytes(alg CompressionAlgorithm, data []byte) ([]byte, error) {
+	switch alg {
+	case CompressionZstd:
+		return getZstdEncoder().EncodeAll(data, nil), nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm: %s", alg)
+	}
+}
+
+// decompressFrame reverses compressBytes.
+func decompressFrame(alg CompressionAlgorithm, data []byte, origLen uint32) ([]byte, error) {
+	switch alg {
+	case CompressionZstd:
+		return getZstdDecoder().DecodeAll(data, make([]byte, 0, origLen))
+	case CompressionSnappy:
+		return snappy.Decode(make([]byte, 0, origLen), data)
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		var buf bytes.Buffer
+		buf.Grow(int(origLen))
+		if _, err := buf.ReadFrom(r); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm: %s", alg)
+	}
+}
+
+// compressionWindowSize is the number of recent frames averaged by
+// compressionStats before it will auto-disable compression.
+const compressionWindowSize = 20
+
+// compressionRatioFloor is the rolling-average compressedLen/origLen ratio
+// above which compression is considered not to be paying for itself.
+const compressionRatioFloor = 0.9
+
+// compressionProbeInterval is how often (in frames) a disabled stream still
+// attempts compression, so it can recover once traffic becomes compressible
+// again instead of being disabled for the tunnel's entire lifetime.
+const compressionProbeInterval = 32
+
+// compressionStats is a per-stream sliding-window benchmark: it tracks
+// recent compression ratios and auto-disables compression once the
+// algorithm stops shrinking frames enough to be worth the CPU cost.
+type compressionStats struct {
+	mu         sync.Mutex
+	window     []float64
+	frameCount uint64
+}
+
+func newCompressionStats() *compressionStats {
+	return &compressionStats{}
+}
+
+func (s *compressionStats) record(origLen, compressedLen int) {
+	if origLen == 0 {
+		return
+	}
+	ratio := float64(compressedLen) / float64(origLen)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.window = append(s.window, ratio)
+	if len(s.window) > compressionWindowSize {
+		s.window = s.window[1:]
+	}
+}
+
+// shouldAttempt reports whether the caller should try compressing the next
+// frame. Once disabled() has tripped, it still lets through one frame every
+// compressionProbeInterval so the rolling window keeps getting fresh data
+// and compression can resume if the traffic shape changes.
+func (s *compressionStats) shouldAttempt() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frameCount++
+	if !s.disabledLocked() {
+		return true
+	}
+	return s.frameCount%compressionProbeInterval == 0
+}
+
+// disabled reports whether the rolling average ratio has crossed
+// compressionRatioFloor over a full window, meaning frames have stopped
+// shrinking enough to justify compressing.
+func (s *compressionStats) disabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.disabledLocked()
+}
+
+func (s *compressionStats) disabledLocked() bool {
+	if len(s.window) < compressionWindowSize {
+		return false
+	}
+
+	var sum float64
+	for _, r := range s.window {
+		sum += r
+	}
+	return sum/float64(len(s.window)) > compressionRatioFloor
+}
+
+// benchmarkCandidateSizes are the payload sizes CompressionBreakEven tries,
+// smallest first.
+var benchmarkCandidateSizes = []int{32, 64, 128, 256, 512, 1024, 2048, 4096}
+
+// CompressionBreakEven measures the smallest of benchmarkCandidateSizes at
+// which alg actually shrinks a representative payload, useful for tuning
+// minCompressSize to a deployment's real traffic shape.
+func CompressionBreakEven(alg CompressionAlgorithm) int {
+	sample := benchmarkSample(benchmarkCandidateSizes[len(benchmarkCandidateSizes)-1])
+
+	for _, size := range benchmarkCandidateSizes {
+		out, err := compressBytes(alg, sample[:size])
+		if err == nil && len(out) < size {
+			return size
+		}
+	}
+	return benchmarkCandidateSizes[len(benchmarkCandidateSizes)-1]
+}
+
+// benchmarkSample returns deterministic, moderately-compressible sample
+// data representative of typical TCP/HTTP payloads (repeating text, not
+// already-compressed binary).
+func benchmarkSample(n int) []byte {
+	const pattern = "the quick brown fox jumps over the lazy dog 0123456789 "
+	buf := make([]byte, n)
+	for i := range buf {
+		buf[i] = pattern[i%len(pattern)]
+	}
+	return buf
+}
@@ -0,0 +1,73 @@
+package localup
+
+import "testing"
+
+func TestCompressDecompressRoundTrip(t *testing.T) {
+	algs := []CompressionAlgorithm{CompressionZstd, CompressionSnappy, CompressionGzip}
+	sample := benchmarkSample(4096)
+
+	for _, alg := range algs {
+		t.Run(string(alg), func(t *testing.T) {
+			compressed, err := compressBytes(alg, sample)
+			if err != nil {
+				t.Fatalf("compressBytes: %v", err)
+			}
+
+			got, err := decompressFrame(alg, compressed, uint32(len(sample)))
+			if err != nil {
+				t.Fatalf("decompressFrame: %v", err)
+			}
+			if string(got) != string(sample) {
+				t.Fatalf("round trip mismatch: got %d bytes, want %d", len(got), len(sample))
+			}
+		})
+	}
+}
+
+func TestCompressionBreakEven(t *testing.T) {
+	for _, alg := range []CompressionAlgorithm{CompressionZstd, CompressionSnappy, CompressionGzip} {
+		t.Run(string(alg), func(t *testing.T) {
+			size := CompressionBreakEven(alg)
+			largest := benchmarkCandidateSizes[len(benchmarkCandidateSizes)-1]
+			if size < benchmarkCandidateSizes[0] || size > largest {
+				t.Fatalf("CompressionBreakEven(%s) = %d, want a value in %v", alg, size, benchmarkCandidateSizes)
+			}
+		})
+	}
+}
+
+// BenchmarkCompress and BenchmarkDecompress report allocs/op for each
+// algorithm at a representative frame size, the real testing.B counterpart
+// CompressionBreakEven's own harness doesn't provide.
+func BenchmarkCompress(b *testing.B) {
+	sample := benchmarkSample(4096)
+	for _, alg := range []CompressionAlgorithm{CompressionZstd, CompressionSnappy, CompressionGzip} {
+		b.Run(string(alg), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := compressBytes(alg, sample); err != nil {
+					b.Fatalf("compressBytes: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	sample := benchmarkSample(4096)
+	for _, alg := range []CompressionAlgorithm{CompressionZstd, CompressionSnappy, CompressionGzip} {
+		compressed, err := compressBytes(alg, sample)
+		if err != nil {
+			b.Fatalf("compressBytes: %v", err)
+		}
+
+		b.Run(string(alg), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := decompressFrame(alg, compressed, uint32(len(sample))); err != nil {
+					b.Fatalf("decompressFrame: %v", err)
+				}
+			}
+		})
+	}
+}
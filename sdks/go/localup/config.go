@@ -1,6 +1,8 @@
 package localup
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"net/url"
 	"strings"
@@ -32,13 +34,118 @@ type TunnelConfig struct {
 
 	// Metadata contains optional key-value pairs for this tunnel.
 	Metadata map[string]string
+
+	// TLSCertBundleID selects a user-uploaded certificate bundle for
+	// ProtocolTLSTerminated tunnels, instead of the relay's wildcard cert.
+	// Set via WithTLSTermination.
+	TLSCertBundleID string
+
+	// EnableHTTP3 requests HTTP/3 passthrough for HTTP/HTTPS tunnels
+	// instead of downgrading QUIC connections at the edge to HTTP/1.1.
+	EnableHTTP3 bool
+
+	// EnableCompression advertises this SDK's supported compression
+	// algorithms to the relay; the relay picks the strongest one both
+	// sides support and returns it in ConnectedMessage.ChosenCompression.
+	EnableCompression bool
+
+	// EnableHeaderCompression requests HPACK-style header compression (see
+	// hpack.go) for HTTP/HTTPS tunnels. The relay acks support in
+	// ConnectedMessage.HeaderCompressionEnabled; until both sides agree,
+	// headers travel uncompressed.
+	EnableHeaderCompression bool
+
+	// PROXYProtocolVersion, when 1 or 2, makes the local forwarder prepend
+	// a PROXY protocol header to the local TCP connection before bridging
+	// bytes (TCP/TLS tunnels only), so upstream software that already
+	// supports PROXY protocol (Postgres, Redis, nginx, HAProxy) sees the
+	// real client address. 0 means disabled. Set via WithPROXYProtocol.
+	PROXYProtocolVersion int
+
+	// regionFailover holds the multi-region failover configuration set by
+	// WithMultiRegionFailover, if any.
+	regionFailover *regionFailoverConfig
+
+	// wireFormats lists the WireFormats this tunnel will negotiate with the
+	// relay, most preferred first, set by WithWireFormats. Empty means
+	// bincode only, with no pre-handshake (the original, relay-compatible
+	// behavior).
+	wireFormats []WireFormat
+
+	// Domain is a custom domain to request for this ProtocolHTTPS tunnel
+	// instead of an auto-assigned subdomain, e.g. "app.example.com". Set
+	// via WithDomain; pair it with WithACME unless Domain's certificate is
+	// already provisioned out of band.
+	Domain string
+
+	// acmeManager drives automatic certificate issuance/renewal for
+	// Domain, set by WithACME. nil means Domain (if set) must already have
+	// a cert provisioned some other way.
+	acmeManager ACMEManager
+
+	// Ingress routes an HTTP/HTTPS tunnel's requests to one of several local
+	// services by Host header and path, instead of always forwarding to
+	// Upstream. Set via WithIngress; when non-empty it takes precedence over
+	// Upstream for matched requests. See IngressRule for rule semantics.
+	Ingress []IngressRule
+
+	// Handler serves this tunnel's traffic in-process instead of forwarding
+	// to Upstream/Port, e.g. an http.Handler or a custom connection handler
+	// with no local listener at all. Set via WithHandler; when set, it takes
+	// precedence over Upstream/Ingress for the protocols it covers.
+	Handler *Handler
+
+	// middleware wraps every HTTP/HTTPS request's forward/Handler call, set
+	// by WithMiddleware. Does not apply to TCP/TLS streams; see
+	// connMiddleware for those.
+	middleware []Middleware
+
+	// connMiddleware wraps every TCP/TLS/TLS-terminated passthrough stream's
+	// dial/Handler.Conn call, set by WithConnMiddleware.
+	connMiddleware []ConnMiddleware
+
+	// StreamWindowSize overrides DefaultStreamWindowSize for this tunnel's
+	// per-stream and connection-level send windows (see flowcontrol.go).
+	// Set via WithTunnelStreamWindowSize. 0 means DefaultStreamWindowSize.
+	StreamWindowSize uint32
+
+	// MaxConcurrentStreams caps how many data streams (see Tunnel.streams)
+	// this tunnel services at once; acceptStreams closes any further
+	// stream the relay opens past this point outright, the same guard
+	// WithEdgeMaxConcurrentStreams applies to outbound streams on an
+	// EdgePool. It's also advertised to the relay in TunnelConfigMsg, so a
+	// cooperating relay avoids opening streams past this point in the
+	// first place. Set via WithTunnelMaxConcurrentStreams; 0 means
+	// DefaultMaxConcurrentStreams.
+	MaxConcurrentStreams uint32
+}
+
+// ACMEManager is implemented by acme.Manager (see the acme sub-package) and
+// plugged into a ProtocolHTTPS tunnel via WithACME. It's defined here,
+// rather than TunnelConfig simply holding an *acme.Manager, so this package
+// doesn't import the acme package (which imports this one for Tunnel and
+// Logger).
+type ACMEManager interface {
+	// Start begins obtaining, and then keeping renewed, a certificate for
+	// domain in the background once tunnel has finished registering,
+	// delivering results via tunnel.SendCertUpdate.
+	Start(ctx context.Context, tunnel *Tunnel, domain string) error
+
+	// ChallengeCertificate returns the in-progress TLS-ALPN-01 challenge
+	// certificate for domain, if one is currently being answered. Used by
+	// Tunnel to answer "acme-tls/1" connections the relay routes back to
+	// this agent.
+	ChallengeCertificate(domain string) (*tls.Certificate, bool)
 }
 
 // TunnelOption is a function that configures a TunnelConfig.
 type TunnelOption func(*TunnelConfig)
 
 // WithUpstream sets the upstream address to forward traffic to.
-// Format: "http://localhost:8080" or just "localhost:8080"
+// Format: "http://localhost:8080", "udp://localhost:5353", or just
+// "localhost:8080". A "udp://" scheme also sets Protocol to ProtocolUDP, the
+// same way "https://" sets LocalHTTPS; pass WithProtocol explicitly after
+// this option to override it.
 func WithUpstream(addr string) TunnelOption {
 	return func(c *TunnelConfig) {
 		c.Upstream = addr
@@ -47,6 +154,11 @@ func WithUpstream(addr string) TunnelOption {
 		if strings.HasPrefix(addr, "https://") {
 			c.LocalHTTPS = true
 		}
+
+		// Detect if upstream is UDP
+		if strings.HasPrefix(addr, "udp://") {
+			c.Protocol = ProtocolUDP
+		}
 	}
 }
 
@@ -100,6 +212,67 @@ func WithURL(urlStr string) TunnelOption {
 	}
 }
 
+// WithTLSTermination configures a ProtocolTLSTerminated tunnel: the relay
+// terminates TLS on behalf of the local upstream, which receives plain TCP.
+// certBundleID optionally selects a user-uploaded certificate bundle instead
+// of the relay's wildcard cert; pass "" to use the wildcard cert.
+func WithTLSTermination(certBundleID string) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.Protocol = ProtocolTLSTerminated
+		c.TLSCertBundleID = certBundleID
+	}
+}
+
+// WithHTTP3 enables HTTP/3 passthrough for HTTP/HTTPS tunnels: when a
+// client-hello at the edge negotiates HTTP/3 via Alt-Svc/ALPN, the relay
+// forwards QUIC streams and datagrams through the tunnel instead of
+// downgrading to HTTP/1.1.
+func WithHTTP3(enabled bool) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.EnableHTTP3 = enabled
+	}
+}
+
+// WithCompression enables negotiated payload compression for TCP, TLS, and
+// HTTP stream data frames. The relay picks the strongest algorithm both
+// sides support; if it picks none, frames go over the wire uncompressed.
+func WithCompression(enabled bool) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.EnableCompression = enabled
+	}
+}
+
+// WithHeaderCompression enables HPACK-style compression of HTTP
+// request/response headers. The relay picks whether to honor it; if it
+// doesn't understand the scheme, headers fall back to the plain encoding.
+func WithHeaderCompression(enabled bool) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.EnableHeaderCompression = enabled
+	}
+}
+
+// WithWireFormats makes the tunnel negotiate its wire format with the relay
+// instead of assuming bincode: it sends a small pre-handshake magic,
+// version, and the name of each format in formats (most preferred first)
+// before the Connect message, and uses whichever one the relay chooses. Pass
+// NewBincodeWireFormat() first to keep it as the fallback/preference.
+func WithWireFormats(formats ...WireFormat) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.wireFormats = formats
+	}
+}
+
+// WithPROXYProtocol makes the local forwarder prepend a PROXY protocol
+// header (version 1 or 2) to the local TCP connection before bridging
+// bytes, for TCP/TLS tunnels. If the relay already sent a precomputed
+// header on the connect message, that header is forwarded verbatim instead
+// of building a new one.
+func WithPROXYProtocol(version int) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.PROXYProtocolVersion = version
+	}
+}
+
 // WithLocalHTTPS indicates that the local upstream uses HTTPS.
 func WithLocalHTTPS(enabled bool) TunnelOption {
 	return func(c *TunnelConfig) {
@@ -107,6 +280,70 @@ func WithLocalHTTPS(enabled bool) TunnelOption {
 	}
 }
 
+// WithDomain requests a custom domain for a ProtocolHTTPS tunnel instead of
+// an auto-assigned subdomain, e.g. WithDomain("app.example.com"). Pair it
+// with WithACME to have this SDK obtain and renew the domain's certificate
+// automatically, or omit WithACME if the relay already has one provisioned
+// for it out of band.
+func WithDomain(domain string) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.Domain = domain
+	}
+}
+
+// WithACME enables automatic ACME certificate issuance and renewal for the
+// domain set by WithDomain, using manager (typically an *acme.Manager from
+// the acme sub-package). The tunnel hands manager the running *Tunnel once
+// registered so it can answer TLS-ALPN-01 challenges and deliver obtained
+// certs back to the relay via Tunnel.SendCertUpdate.
+func WithACME(manager ACMEManager) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.acmeManager = manager
+	}
+}
+
+// WithIngress configures rule-based routing for an HTTP/HTTPS tunnel: each
+// incoming request is matched against rules in order by Host header and URL
+// path, and forwarded to the first match's Service, in the style of
+// cloudflared's ingress rules. The final rule must be a catch-all (empty
+// Hostname and Path); Validate rejects a config that omits one.
+func WithIngress(rules ...IngressRule) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.Ingress = rules
+	}
+}
+
+// WithHandler registers a Handler to serve this tunnel's traffic in-process,
+// in place of WithUpstream/WithPort: no local port is ever dialed. handler.Conn
+// serves TCP/TLS/TLS-terminated passthrough streams and handler.HTTP serves
+// HTTP/HTTPS requests; leave either field nil if the tunnel's protocol never
+// needs it.
+func WithHandler(handler Handler) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.Handler = &handler
+	}
+}
+
+// WithMiddleware registers ordered Middleware around every HTTP/HTTPS
+// request's forward/Handler call, e.g. for header injection, request
+// logging, rate limiting, or response rewriting. Middleware run in
+// registration order; repeated calls append rather than replace.
+func WithMiddleware(mw ...Middleware) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.middleware = append(c.middleware, mw...)
+	}
+}
+
+// WithConnMiddleware registers ordered ConnMiddleware around every TCP/TLS/
+// TLS-terminated passthrough stream's dial/Handler.Conn call, the L4
+// equivalent of WithMiddleware. Middleware run in registration order;
+// repeated calls append rather than replace.
+func WithConnMiddleware(mw ...ConnMiddleware) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.connMiddleware = append(c.connMiddleware, mw...)
+	}
+}
+
 // WithTunnelMetadata sets metadata for this specific tunnel.
 func WithTunnelMetadata(metadata map[string]string) TunnelOption {
 	return func(c *TunnelConfig) {
@@ -114,10 +351,33 @@ func WithTunnelMetadata(metadata map[string]string) TunnelOption {
 	}
 }
 
+// WithTunnelStreamWindowSize overrides the default 64KiB per-stream (and
+// connection-level) send window used by copyToStream/
+// copyHttpStreamToRemote/copyTlsStreamToRemote to bound in-flight bytes
+// per logical stream, so a slow remote consumer can't grow memory use
+// without bound and one noisy stream can't starve its siblings. See
+// flowcontrol.go.
+func WithTunnelStreamWindowSize(size uint32) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.StreamWindowSize = size
+	}
+}
+
+// WithTunnelMaxConcurrentStreams overrides DefaultMaxConcurrentStreams for
+// this tunnel: acceptStreams closes outright any data stream the relay
+// opens past this count, and the configured value is advertised to the
+// relay in TunnelConfigMsg so it can avoid opening them in the first
+// place. See TunnelConfig.MaxConcurrentStreams.
+func WithTunnelMaxConcurrentStreams(n uint32) TunnelOption {
+	return func(c *TunnelConfig) {
+		c.MaxConcurrentStreams = n
+	}
+}
+
 // Validate checks if the tunnel configuration is valid.
 func (c *TunnelConfig) Validate() error {
 	switch c.Protocol {
-	case ProtocolTCP, ProtocolTLS:
+	case ProtocolTCP, ProtocolTLS, ProtocolTLSTerminated, ProtocolUDP:
 		// Port-based protocols - upstream is optional for Listen mode
 	case ProtocolHTTP, ProtocolHTTPS:
 		// HTTP-based protocols - upstream is required for Forward mode
@@ -128,6 +388,23 @@ func (c *TunnelConfig) Validate() error {
 		return errors.New("unknown protocol: " + string(c.Protocol))
 	}
 
+	switch c.PROXYProtocolVersion {
+	case 0, 1, 2:
+	default:
+		return errors.New("PROXY protocol version must be 1 or 2")
+	}
+
+	if c.Domain != "" && c.Protocol != ProtocolHTTPS {
+		return errors.New("WithDomain is only valid for https tunnels")
+	}
+	if c.acmeManager != nil && c.Domain == "" {
+		return errors.New("WithACME requires WithDomain")
+	}
+
+	if err := validateIngress(c.Ingress); err != nil {
+		return err
+	}
+
 	return nil
 }
 
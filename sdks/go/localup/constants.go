@@ -17,6 +17,12 @@ const (
 	// DefaultQUICPort is the default port for QUIC connections.
 	DefaultQUICPort = 4443
 
+	// DefaultWebSocketPort is the default port for the WebSocketTransport
+	// fallback. It deliberately matches ordinary HTTPS (443) rather than
+	// DefaultQUICPort, since the whole point of the fallback is to blend in
+	// with traffic that corporate proxies and hotel Wi-Fi already allow.
+	DefaultWebSocketPort = 443
+
 	// DefaultHTTPSPort is the default port for HTTPS/H2 connections.
 	DefaultHTTPSPort = 443
 
@@ -25,6 +31,14 @@ const (
 
 	// ControlStreamID is the stream ID reserved for control messages.
 	ControlStreamID = 0
+
+	// MaxDatagramFrameSize bounds how large an encoded UdpDatagramMessage or
+	// QuicDatagramMessage may be before Transport.SendDatagram is attempted,
+	// since QUIC datagrams must fit in a single packet with no fragmentation
+	// (RFC 9221). Chosen well under the common 1200-byte safe QUIC payload
+	// size to leave room for the bincode envelope; anything larger falls
+	// back to the reliable stream path instead.
+	MaxDatagramFrameSize = 1100
 )
 
 // Frame header constants
@@ -43,6 +57,53 @@ const (
 	FrameTypeData         uint8 = 1
 	FrameTypeClose        uint8 = 2
 	FrameTypeWindowUpdate uint8 = 3
+
+	// FrameTypeHeaders carries an HPACK-compressed header block (see
+	// HeaderFrameCodec in hpackframes.go) for a logical stream. A block too
+	// large for one frame continues in FrameTypeContinuation frames; the
+	// last frame of the block is flagged FrameFlagFin.
+	FrameTypeHeaders uint8 = 4
+
+	// FrameTypeContinuation carries the continuation of a header block
+	// started by a FrameTypeHeaders frame. See FrameTypeHeaders.
+	FrameTypeContinuation uint8 = 5
+)
+
+// ConnectionWindowStreamID is a reserved stream ID used only in the
+// stream_id field of FrameTypeWindowUpdate frames to mean "refill the
+// connection-level window" rather than any single logical stream's window.
+// It mirrors ControlStreamID's use of 0 for the same purpose, but a
+// WebSocketTransport can't reuse 0 for this since stream 0 there is the
+// tunnel's real control stream, not a reserved sentinel.
+const ConnectionWindowStreamID uint32 = 0xFFFFFFFF
+
+// Multiplexing defaults.
+const (
+	// DefaultStreamWindowSize is the initial flow-control window, in bytes,
+	// granted to each multiplexed stream and to the connection as a whole.
+	// Matches HTTP/2's default initial window (RFC 7540 6.9.2).
+	DefaultStreamWindowSize = 65535
+
+	// DefaultMaxConcurrentStreams bounds how many multiplexed streams an
+	// EdgePool/Tunnel keeps open at once; see WithEdgeMaxConcurrentStreams.
+	DefaultMaxConcurrentStreams = 128
+)
+
+// TLS session resumption defaults (see SessionCache).
+const (
+	// DefaultSessionCacheCapacity bounds how many resumption tickets
+	// NewSessionCache's in-memory SessionCache keeps, evicting least-
+	// recently-used once full. One entry per relay/edge address is typical.
+	DefaultSessionCacheCapacity = 64
+)
+
+// HTTP header compression defaults (see hpack.go).
+const (
+	// DefaultHPACKDynamicTableSize is the maximum size, in bytes, of the
+	// HPACK dynamic table built up while encoding/decoding a single
+	// HttpRequestMessage/HttpResponseMessage header block. Matches RFC
+	// 7541's default SETTINGS_HEADER_TABLE_SIZE.
+	DefaultHPACKDynamicTableSize = 4096
 )
 
 // Frame flags
@@ -67,6 +128,16 @@ const (
 
 	// ProtocolHTTPS creates an HTTPS tunnel with TLS termination at the relay.
 	ProtocolHTTPS Protocol = "https"
+
+	// ProtocolTLSTerminated creates a TCP tunnel where the relay terminates
+	// TLS on behalf of the local service: the edge speaks TLS to clients and
+	// plain TCP to the upstream. Unlike ProtocolTLS (SNI passthrough), the
+	// relay holds the certificate and the local app sees decrypted bytes.
+	ProtocolTLSTerminated Protocol = "tls-terminated"
+
+	// ProtocolUDP creates a UDP tunnel with port-based routing, for DNS,
+	// QUIC, WireGuard, and other datagram traffic.
+	ProtocolUDP Protocol = "udp"
 )
 
 // Well-known endpoints
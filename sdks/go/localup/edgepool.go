@@ -0,0 +1,736 @@
+package localup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default tuning for the multi-edge EdgePool. These mirror the timeouts
+// used elsewhere in the package (DefaultPingInterval, DefaultPingTimeout).
+const (
+	// DefaultEdgePingInterval is how often EdgePool sends a keepalive Ping
+	// down each edge's dedicated health-check stream.
+	DefaultEdgePingInterval = 10 * time.Second
+
+	// DefaultEdgePingTimeout bounds how long EdgePool waits for the
+	// matching Pong before counting a ping as failed.
+	DefaultEdgePingTimeout = 5 * time.Second
+
+	// DefaultEdgeMaxPingFailures is how many consecutive keepalive failures
+	// mark an edge unhealthy and hand it off to the background reconnector.
+	DefaultEdgeMaxPingFailures = 3
+
+	// DefaultEdgeReconnectInitialDelay and DefaultEdgeReconnectMaxDelay
+	// bound the full-jitter backoff (see fullJitterBackoff) the background
+	// reconnector uses while an edge is down.
+	DefaultEdgeReconnectInitialDelay = 1 * time.Second
+	DefaultEdgeReconnectMaxDelay     = 30 * time.Second
+
+	// edgeSRVService and edgeSRVProto name the DNS SRV record EdgePool
+	// looks up against the relay host when WithEdgePool is given no
+	// explicit edges, e.g. "_localup-edge._udp.relay.localup.io".
+	edgeSRVService = "localup-edge"
+	edgeSRVProto   = "udp"
+)
+
+// EdgePoolOption configures the multi-edge failover subsystem enabled by
+// WithEdgePool.
+type EdgePoolOption func(*edgePoolConfig)
+
+// WithEdgePingInterval sets how often each edge's health is checked.
+func WithEdgePingInterval(interval time.Duration) EdgePoolOption {
+	return func(c *edgePoolConfig) {
+		c.pingInterval = interval
+	}
+}
+
+// WithEdgeMaxPingFailures sets how many consecutive failed keepalives mark
+// an edge unhealthy.
+func WithEdgeMaxPingFailures(n int) EdgePoolOption {
+	return func(c *edgePoolConfig) {
+		c.maxPingFailures = n
+	}
+}
+
+// WithEdgeResolver overrides defaultEdgeResolver for discovering edge
+// addresses when WithEdgePool/WithConnections isn't given an explicit edge
+// list, e.g. to resolve against a control-plane API instead of DNS.
+func WithEdgeResolver(resolver EdgeResolver) EdgePoolOption {
+	return func(c *edgePoolConfig) {
+		c.resolver = resolver
+	}
+}
+
+// WithEdgeMaxConcurrentStreams bounds how many streams OpenStream will place
+// on a single edge connection before round-robin prefers a less-loaded one,
+// the per-connection counterpart to DefaultMaxConcurrentStreams.
+func WithEdgeMaxConcurrentStreams(n int) EdgePoolOption {
+	return func(c *edgePoolConfig) {
+		c.maxConcurrentStreams = n
+	}
+}
+
+// edgePoolConfig holds the tuning knobs for an EdgePool, built from
+// WithEdgePool's or WithConnections' options.
+type edgePoolConfig struct {
+	edges                []string
+	connections          int
+	resolver             EdgeResolver
+	pingInterval         time.Duration
+	maxPingFailures      int
+	maxConcurrentStreams int
+}
+
+// WithEdgePool configures the agent to maintain a concurrent transport to
+// each of edges (host:port, e.g. "edge-a.localup.io:4443") instead of a
+// single relay connection. New tunnels register over every healthy edge
+// (see Tunnel.registerPool), and once registered traffic keeps flowing over the
+// other healthy edges if one drops: a background reconnector re-dials a
+// failed edge with full-jitter backoff while the rest keep serving, so a
+// rolling relay restart never causes tunnel downtime (the same pattern
+// cloudflared uses with 4 concurrent edge connections per tunnel).
+//
+// If edges is empty, EdgePool resolves the set of edges via defaultEdgeResolver
+// (or the EdgeResolver installed with WithEdgeResolver) at connect time, so a
+// relay operator can grow or shrink the edge fleet without redeploying
+// agents.
+func WithEdgePool(edges []string, opts ...EdgePoolOption) AgentOption {
+	cfg := &edgePoolConfig{
+		edges:           edges,
+		pingInterval:    DefaultEdgePingInterval,
+		maxPingFailures: DefaultEdgeMaxPingFailures,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(c *AgentConfig) {
+		c.edgePool = cfg
+	}
+}
+
+// WithConnections configures the agent to maintain n concurrent connections
+// to the relay for high availability, the same EdgePool machinery
+// WithEdgePool uses, except the edge addresses come from resolution instead
+// of being named explicitly: defaultEdgeResolver (DNS SRV, falling back to a
+// plain A/AAAA lookup of RelayAddr) unless overridden with WithEdgeResolver.
+// If resolution returns fewer than n distinct addresses, the pool cycles
+// through them to make up the count, so e.g. a relay with no SRV record
+// still gets n connections to its single resolved address — the same fixed
+// pool size cloudflared maintains per tunnel.
+//
+// Tunnel registration is replicated across every connection in the pool
+// (see Tunnel.registerPool and EdgePool.OpenControlStreams): each edge runs
+// its own AcceptStream loop fanned into the same queue (see
+// EdgePool.acceptLoop), but the relay only associates a tunnel ID with an
+// edge once it's seen a Connect over that edge's control stream, so
+// registering on only one would leave the others unable to receive a
+// stream.
+func WithConnections(n int) AgentOption {
+	return func(c *AgentConfig) {
+		if c.edgePool == nil {
+			c.edgePool = &edgePoolConfig{
+				pingInterval:    DefaultEdgePingInterval,
+				maxPingFailures: DefaultEdgeMaxPingFailures,
+			}
+		}
+		c.edgePool.connections = n
+	}
+}
+
+// EdgeResolver resolves the set of edge addresses EdgePool dials when
+// WithEdgePool/WithConnections isn't given an explicit edge list. Implement
+// it to plug in discovery other than DNS (e.g. a control-plane API) in place
+// of defaultEdgeResolver, and install it with WithEdgeResolver.
+type EdgeResolver interface {
+	ResolveEdges(ctx context.Context, relayAddr string) ([]string, error)
+}
+
+// defaultEdgeResolver is the EdgeResolver used unless WithEdgeResolver
+// overrides it: the DNS SRV record "_localup-edge._udp.<relay host>",
+// falling back to a plain A/AAAA lookup of the relay host itself (paired
+// with the relay's own port) for deployments that don't publish one.
+type defaultEdgeResolver struct{}
+
+func (defaultEdgeResolver) ResolveEdges(ctx context.Context, relayAddr string) ([]string, error) {
+	edges, srvErr := resolveEdgesSRV(relayAddr)
+	if srvErr == nil && len(edges) > 0 {
+		return edges, nil
+	}
+
+	host, port, err := net.SplitHostPort(relayAddr)
+	if err != nil {
+		host, port = relayAddr, fmt.Sprintf("%d", DefaultQUICPort)
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		if srvErr != nil {
+			return nil, fmt.Errorf("SRV lookup failed (%v) and A/AAAA lookup failed: %w", srvErr, err)
+		}
+		return nil, err
+	}
+
+	resolved := make([]string, 0, len(addrs))
+	for _, ip := range addrs {
+		resolved = append(resolved, net.JoinHostPort(ip, port))
+	}
+	return resolved, nil
+}
+
+// expandEdges returns exactly n edge addresses, cycling through edges
+// (repeating addresses) if resolution returned fewer than n, or truncating
+// if it returned more, so WithConnections(n) always opens exactly n
+// connections regardless of how many distinct edges were resolved.
+func expandEdges(edges []string, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = edges[i%len(edges)]
+	}
+	return out
+}
+
+// edgeConn holds one edge's transport and health-check state. transport,
+// healthy and failures are guarded by mu, since the edge's accept,
+// keepalive and reconnect goroutines and OpenStream callers all reach them
+// from different goroutines.
+type edgeConn struct {
+	addr string
+
+	// index identifies this edge for Observer.OnConnect/Metrics, stable for
+	// the lifetime of the pool even across reconnects (see reconnectEdge).
+	index int
+
+	mu        sync.Mutex
+	transport Transport
+	healthy   bool
+	failures  int
+
+	// inflight counts streams opened via this conn that haven't been
+	// closed yet, so OpenStream's round-robin can route around an edge
+	// that's hit WithEdgeMaxConcurrentStreams.
+	inflight atomic.Int32
+}
+
+func (c *edgeConn) get() (Transport, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.transport, c.healthy
+}
+
+// acceptResult carries a stream accepted from one edge, or the error that
+// ended that edge's accept loop, into EdgePool's fan-in channel.
+type acceptResult struct {
+	stream Stream
+	err    error
+}
+
+// datagramResult carries a datagram received on one edge into EdgePool's
+// fan-in channel for ReceiveDatagram.
+type datagramResult struct {
+	data []byte
+	err  error
+}
+
+// EdgePool maintains N concurrent transports to different relay edges,
+// health-checking each with periodic Pings and fanning their accepted
+// streams into a single stream. It implements Transport so it can be
+// dropped in wherever Agent uses a single transport (see Agent.connect).
+type EdgePool struct {
+	agent *Agent
+	cfg   *edgePoolConfig
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	conns   map[string]*edgeConn
+	rrIndex atomic.Uint64
+
+	accepted  chan acceptResult
+	datagrams chan datagramResult
+}
+
+// newEdgePool resolves cfg's edges (explicit, or via DNS SRV against the
+// agent's relay host), dials a transport to each, and starts each edge's
+// accept-fan-in and keepalive/reconnect goroutines.
+func newEdgePool(ctx context.Context, agent *Agent, cfg *edgePoolConfig) (*EdgePool, error) {
+	edges := cfg.edges
+	if len(edges) == 0 {
+		resolver := cfg.resolver
+		if resolver == nil {
+			resolver = defaultEdgeResolver{}
+		}
+		resolved, err := resolver.ResolveEdges(ctx, agent.config.RelayAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve edges: %w", err)
+		}
+		edges = resolved
+	}
+	if len(edges) == 0 {
+		return nil, errors.New("edge pool configured with no edges")
+	}
+	if cfg.connections > 0 {
+		edges = expandEdges(edges, cfg.connections)
+	}
+
+	poolCtx, cancel := context.WithCancel(ctx)
+	p := &EdgePool{
+		agent:     agent,
+		cfg:       cfg,
+		ctx:       poolCtx,
+		cancel:    cancel,
+		conns:     make(map[string]*edgeConn, len(edges)),
+		accepted:  make(chan acceptResult, len(edges)),
+		datagrams: make(chan datagramResult, len(edges)),
+	}
+
+	var dialErrs []error
+	for i, addr := range edges {
+		conn := &edgeConn{addr: addr, index: i}
+		p.conns[fmt.Sprintf("%d:%s", i, addr)] = conn
+
+		start := time.Now()
+		transport, err := p.dialEdge(ctx, addr)
+		if err != nil {
+			agent.config.Logger.Warn("edge dial failed, will retry in background", "edge", addr, "error", err)
+			dialErrs = append(dialErrs, err)
+			go p.reconnectEdge(conn)
+			continue
+		}
+		agent.metrics.recordHandshake(time.Since(start))
+		agent.config.Observer.OnConnect(TransportProtocolQUIC, addr, i)
+
+		conn.mu.Lock()
+		conn.transport = transport
+		conn.healthy = true
+		conn.mu.Unlock()
+		go p.acceptLoop(conn)
+		go p.keepaliveLoop(conn)
+		go p.datagramLoop(conn)
+	}
+
+	if len(dialErrs) == len(edges) {
+		cancel()
+		return nil, fmt.Errorf("all edges failed to dial: %v", dialErrs)
+	}
+
+	return p, nil
+}
+
+// dialEdge opens a transport to a single edge address, overriding the
+// agent's configured RelayAddr for the duration of the dial.
+func (p *EdgePool) dialEdge(ctx context.Context, addr string) (Transport, error) {
+	config := *p.agent.config
+	config.RelayAddr = addr
+	return NewQUICTransport(ctx, &config)
+}
+
+// resolveEdgesSRV looks up the relay's advertised edge fleet via the DNS
+// SRV record "_localup-edge._udp.<relay host>".
+func resolveEdgesSRV(relayAddr string) ([]string, error) {
+	host, _, err := net.SplitHostPort(relayAddr)
+	if err != nil {
+		host = relayAddr
+	}
+
+	_, srvs, err := net.LookupSRV(edgeSRVService, edgeSRVProto, host)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		target := strings.TrimSuffix(srv.Target, ".")
+		edges = append(edges, net.JoinHostPort(target, fmt.Sprintf("%d", srv.Port)))
+	}
+	return edges, nil
+}
+
+// acceptLoop forwards streams accepted on conn's transport into the pool's
+// fan-in channel until the transport errors, at which point it marks the
+// edge unhealthy and hands it to the background reconnector.
+func (p *EdgePool) acceptLoop(conn *edgeConn) {
+	for {
+		transport, _ := conn.get()
+		stream, err := transport.AcceptStream(p.ctx)
+		if err != nil {
+			select {
+			case <-p.ctx.Done():
+				return
+			default:
+			}
+			p.agent.config.Logger.Warn("edge accept failed, reconnecting", "edge", conn.addr, "error", err)
+			p.markUnhealthy(conn)
+			p.agent.config.Observer.OnDisconnect(fmt.Sprintf("edge %d (%s) stream accept failed", conn.index, conn.addr), err)
+			go p.reconnectEdge(conn)
+			return
+		}
+
+		select {
+		case p.accepted <- acceptResult{stream: stream}:
+		case <-p.ctx.Done():
+			stream.Close()
+			return
+		}
+	}
+}
+
+// datagramLoop forwards datagrams received on conn's transport into the
+// pool's fan-in channel until the transport errors or doesn't support
+// datagrams at all, in which case it simply stops (acceptLoop and
+// keepaliveLoop are still what detect and repair a dead edge).
+func (p *EdgePool) datagramLoop(conn *edgeConn) {
+	for {
+		transport, _ := conn.get()
+		data, err := transport.ReceiveDatagram(p.ctx)
+		if err != nil {
+			if errors.Is(err, ErrDatagramsNotSupported) {
+				return
+			}
+			select {
+			case <-p.ctx.Done():
+				return
+			default:
+			}
+			return
+		}
+
+		select {
+		case p.datagrams <- datagramResult{data: data}:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// keepaliveLoop periodically pings conn's transport over a dedicated
+// stream, marking the edge unhealthy and handing it to the background
+// reconnector after cfg.maxPingFailures consecutive failures.
+func (p *EdgePool) keepaliveLoop(conn *edgeConn) {
+	ticker := time.NewTicker(p.cfg.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		transport, healthy := conn.get()
+		if !healthy {
+			return
+		}
+
+		if err := p.ping(transport); err != nil {
+			conn.mu.Lock()
+			conn.failures++
+			failures := conn.failures
+			conn.mu.Unlock()
+
+			p.agent.config.Logger.Warn("edge keepalive failed", "edge", conn.addr, "failures", failures, "error", err)
+			if failures >= p.cfg.maxPingFailures {
+				p.markUnhealthy(conn)
+				transport.Close()
+				p.agent.config.Observer.OnDisconnect(fmt.Sprintf("edge %d (%s) keepalive failed", conn.index, conn.addr), err)
+				go p.reconnectEdge(conn)
+				return
+			}
+			continue
+		}
+
+		conn.mu.Lock()
+		conn.failures = 0
+		conn.mu.Unlock()
+	}
+}
+
+// ping sends a Ping on a short-lived stream and waits for the matching
+// Pong, the same probe region_failover.go's regionProber uses.
+func (p *EdgePool) ping(transport Transport) error {
+	ctx, cancel := context.WithTimeout(p.ctx, DefaultEdgePingTimeout)
+	defer cancel()
+
+	stream, err := transport.OpenStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	codec := NewMessageCodec()
+	ping := &PingMessage{Timestamp: uint64(time.Now().UnixNano())}
+	data, err := codec.EncodeMessage(ping)
+	if err != nil {
+		return err
+	}
+	if _, err := stream.Write(data); err != nil {
+		return err
+	}
+
+	msg, err := codec.DecodeMessage(stream)
+	if err != nil {
+		return err
+	}
+	if _, ok := msg.(*PongMessage); !ok {
+		return fmt.Errorf("unexpected keepalive response: %T", msg)
+	}
+	return nil
+}
+
+// markUnhealthy flips conn out of the round-robin rotation.
+func (p *EdgePool) markUnhealthy(conn *edgeConn) {
+	conn.mu.Lock()
+	conn.healthy = false
+	conn.mu.Unlock()
+}
+
+// reconnectEdge redials conn with full-jitter backoff until it succeeds or
+// the pool is closed, then restarts its accept and keepalive loops.
+func (p *EdgePool) reconnectEdge(conn *edgeConn) {
+	for attempt := 1; ; attempt++ {
+		delay := fullJitterBackoff(attempt, DefaultEdgeReconnectInitialDelay, DefaultEdgeReconnectMaxDelay, 2.0)
+		p.agent.metrics.recordReconnectAttempt()
+		p.agent.config.Observer.OnReconnecting(attempt, delay)
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		start := time.Now()
+		transport, err := p.dialEdge(p.ctx, conn.addr)
+		if err != nil {
+			p.agent.config.Logger.Warn("edge reconnect failed", "edge", conn.addr, "attempt", attempt, "error", err)
+			continue
+		}
+		p.agent.metrics.recordHandshake(time.Since(start))
+		p.agent.config.Observer.OnConnect(TransportProtocolQUIC, conn.addr, conn.index)
+
+		conn.mu.Lock()
+		conn.transport = transport
+		conn.healthy = true
+		conn.failures = 0
+		conn.mu.Unlock()
+
+		p.agent.config.Logger.Info("edge reconnected", "edge", conn.addr, "attempt", attempt)
+		go p.acceptLoop(conn)
+		go p.keepaliveLoop(conn)
+		go p.datagramLoop(conn)
+		return
+	}
+}
+
+// healthyConns returns the currently healthy edge connections.
+func (p *EdgePool) healthyConns() []*edgeConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	healthy := make([]*edgeConn, 0, len(p.conns))
+	for _, conn := range p.conns {
+		if _, ok := conn.get(); ok {
+			healthy = append(healthy, conn)
+		}
+	}
+	return healthy
+}
+
+// OpenControlStreams opens one stream on every currently healthy edge, for
+// Tunnel.registerPool to register the tunnel against each of them (see
+// WithConnections) instead of just whichever edge OpenStream's round-robin
+// would have picked. It's all-or-nothing on the dial: if any healthy edge
+// fails to open a stream, every stream already opened is closed and the
+// error returned, since a tunnel registered on a subset of edges would
+// violate WithConnections' registered-on-every-edge contract silently.
+func (p *EdgePool) OpenControlStreams(ctx context.Context) ([]Stream, error) {
+	healthy := p.healthyConns()
+	if len(healthy) == 0 {
+		return nil, errors.New("edge pool: no healthy edges")
+	}
+
+	streams := make([]Stream, 0, len(healthy))
+	for _, conn := range healthy {
+		transport, ok := conn.get()
+		if !ok {
+			continue
+		}
+		stream, err := transport.OpenStream(ctx)
+		if err != nil {
+			for _, s := range streams {
+				s.Close()
+			}
+			return nil, fmt.Errorf("edge pool: open control stream on %s: %w", conn.addr, err)
+		}
+		streams = append(streams, stream)
+	}
+	if len(streams) == 0 {
+		return nil, errors.New("edge pool: no healthy edges")
+	}
+	return streams, nil
+}
+
+// OpenStream round-robins a new stream across the currently healthy edges,
+// preferring one under its WithEdgeMaxConcurrentStreams cap; if every
+// healthy edge is at the cap it opens on the last edge it checked anyway rather
+// than block, since the cap is a load-balancing preference, not a hard
+// admission limit.
+func (p *EdgePool) OpenStream(ctx context.Context) (Stream, error) {
+	healthy := p.healthyConns()
+	if len(healthy) == 0 {
+		return nil, errors.New("edge pool: no healthy edges")
+	}
+
+	maxStreams := p.cfg.maxConcurrentStreams
+	if maxStreams <= 0 {
+		maxStreams = DefaultMaxConcurrentStreams
+	}
+
+	start := int(p.rrIndex.Add(1))
+	conn := healthy[start%len(healthy)]
+	for i := 1; i < len(healthy) && int(conn.inflight.Load()) >= maxStreams; i++ {
+		conn = healthy[(start+i)%len(healthy)]
+	}
+
+	transport, _ := conn.get()
+	stream, err := transport.OpenStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn.inflight.Add(1)
+	return &countedStream{Stream: stream, conn: conn}, nil
+}
+
+// countedStream decrements its edge's inflight counter exactly once, on the
+// first Close, so OpenStream's MaxConcurrentStreams guard tracks streams
+// that are actually still open.
+type countedStream struct {
+	Stream
+	conn      *edgeConn
+	closeOnce sync.Once
+}
+
+func (s *countedStream) Close() error {
+	s.closeOnce.Do(func() { s.conn.inflight.Add(-1) })
+	return s.Stream.Close()
+}
+
+// AcceptStream returns the next stream accepted on any healthy edge.
+func (p *EdgePool) AcceptStream(ctx context.Context) (Stream, error) {
+	select {
+	case result, ok := <-p.accepted:
+		if !ok {
+			return nil, errors.New("edge pool: closed")
+		}
+		if result.err != nil {
+			return nil, result.err
+		}
+		return result.stream, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.ctx.Done():
+		return nil, errors.New("edge pool: closed")
+	}
+}
+
+// SendDatagram round-robins a datagram across the currently healthy edges
+// that support one, skipping over edges that return ErrDatagramsNotSupported
+// until one accepts it or every healthy edge has been tried.
+func (p *EdgePool) SendDatagram(data []byte) error {
+	healthy := p.healthyConns()
+	if len(healthy) == 0 {
+		return errors.New("edge pool: no healthy edges")
+	}
+
+	start := int(p.rrIndex.Add(1))
+	var lastErr error
+	for i := 0; i < len(healthy); i++ {
+		conn := healthy[(start+i)%len(healthy)]
+		transport, _ := conn.get()
+		err := transport.SendDatagram(data)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !errors.Is(err, ErrDatagramsNotSupported) {
+			return err
+		}
+	}
+	return lastErr
+}
+
+// ReceiveDatagram returns the next datagram received on any healthy edge. If
+// no edge negotiated datagram support, every edge's datagramLoop exits
+// immediately and this simply blocks until ctx is done.
+func (p *EdgePool) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	select {
+	case result, ok := <-p.datagrams:
+		if !ok {
+			return nil, errors.New("edge pool: closed")
+		}
+		return result.data, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.ctx.Done():
+		return nil, errors.New("edge pool: closed")
+	}
+}
+
+// Close tears down every edge's transport and stops all background
+// goroutines.
+func (p *EdgePool) Close() error {
+	p.cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for _, conn := range p.conns {
+		conn.mu.Lock()
+		if conn.transport != nil {
+			if err := conn.transport.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		conn.mu.Unlock()
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("errors closing edge pool: %v", errs)
+	}
+	return nil
+}
+
+// LocalAddr returns a summary of the pool's local addresses.
+func (p *EdgePool) LocalAddr() string {
+	return p.summarizeAddrs(func(c *edgeConn) string {
+		if t, ok := c.get(); ok {
+			return t.LocalAddr()
+		}
+		return ""
+	})
+}
+
+// RemoteAddr returns a summary of the pool's edge addresses.
+func (p *EdgePool) RemoteAddr() string {
+	return p.summarizeAddrs(func(c *edgeConn) string {
+		return c.addr
+	})
+}
+
+func (p *EdgePool) summarizeAddrs(addr func(*edgeConn) string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	addrs := make([]string, 0, len(p.conns))
+	for _, conn := range p.conns {
+		if a := addr(conn); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return fmt.Sprintf("edgepool(%v)", addrs)
+}
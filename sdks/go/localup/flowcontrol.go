@@ -0,0 +1,164 @@
+package localup
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrStreamFlowControlClosed is returned by a blocked
+// copyToStream/copyHttpStreamToRemote/copyTlsStreamToRemote write once the
+// tunnel (or that stream) tears down while waiting for send window.
+var ErrStreamFlowControlClosed = errors.New("localup: stream flow control closed")
+
+// streamFlowControl bounds in-flight bytes for a Tunnel's
+// copyToStream/copyHttpStreamToRemote/copyTlsStreamToRemote helpers (see
+// TunnelConfig.StreamWindowSize): each StreamID gets its own send window,
+// plus there's one connection-level send window shared by every stream on
+// the tunnel, HTTP/2-style. It's applied directly to the codec-level
+// *DataMessage loop, since these helpers each get a dedicated transport
+// Stream per logical connection rather than sharing one.
+//
+// A stream's window is depleted as data is sent and refilled by
+// StreamWindowUpdateMessages the peer sends back as it consumes data (see
+// Tunnel.maybeGrantWindow); the connection-level window works the same way
+// with StreamID ControlStreamID. Both the sender and receiver side of a
+// given StreamID call open/release, so whichever direction finishes first
+// doesn't tear down state the other still needs.
+type streamFlowControl struct {
+	initialWindow uint32
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	closed   bool
+	connSend uint32
+
+	sendWindows map[uint32]uint32
+	refs        map[uint32]int
+
+	connRecvConsumed uint32
+	recvConsumed     map[uint32]uint32
+}
+
+func newStreamFlowControl(windowSize uint32) *streamFlowControl {
+	if windowSize == 0 {
+		windowSize = DefaultStreamWindowSize
+	}
+	fc := &streamFlowControl{
+		initialWindow: windowSize,
+		connSend:      windowSize,
+		sendWindows:   make(map[uint32]uint32),
+		refs:          make(map[uint32]int),
+		recvConsumed:  make(map[uint32]uint32),
+	}
+	fc.cond = sync.NewCond(&fc.mu)
+	return fc
+}
+
+// open registers streamID for flow control, granting it a fresh send
+// window the first time it's called for that StreamID, and bumps a
+// refcount so a later release from either the sender or receiver side
+// doesn't tear down the window out from under the other.
+func (fc *streamFlowControl) open(streamID uint32) {
+	fc.mu.Lock()
+	if _, ok := fc.sendWindows[streamID]; !ok {
+		fc.sendWindows[streamID] = fc.initialWindow
+	}
+	fc.refs[streamID]++
+	fc.mu.Unlock()
+}
+
+// release drops one reference to streamID's flow-control state, removing
+// it once both the sender and receiver side have released it and waking
+// any acquireSend blocked on it so it can observe the stream is gone.
+func (fc *streamFlowControl) release(streamID uint32) {
+	fc.mu.Lock()
+	fc.refs[streamID]--
+	if fc.refs[streamID] <= 0 {
+		delete(fc.refs, streamID)
+		delete(fc.sendWindows, streamID)
+		delete(fc.recvConsumed, streamID)
+	}
+	fc.cond.Broadcast()
+	fc.mu.Unlock()
+}
+
+// closeAll unblocks every pending acquireSend, e.g. when the tunnel itself
+// closes.
+func (fc *streamFlowControl) closeAll() {
+	fc.mu.Lock()
+	fc.closed = true
+	fc.cond.Broadcast()
+	fc.mu.Unlock()
+}
+
+// acquireSend blocks until at least 1 byte of window is available for
+// streamID in both its own send window and the connection-level one, then
+// reserves up to n bytes from both and returns the amount granted.
+func (fc *streamFlowControl) acquireSend(streamID uint32, n uint32) (uint32, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	for {
+		if fc.closed {
+			return 0, ErrStreamFlowControlClosed
+		}
+		streamWin, ok := fc.sendWindows[streamID]
+		if !ok {
+			return 0, ErrStreamFlowControlClosed
+		}
+		avail := streamWin
+		if fc.connSend < avail {
+			avail = fc.connSend
+		}
+		if avail > 0 {
+			grant := n
+			if grant > avail {
+				grant = avail
+			}
+			fc.sendWindows[streamID] = streamWin - grant
+			fc.connSend -= grant
+			return grant, nil
+		}
+		fc.cond.Wait()
+	}
+}
+
+// grantSend applies a StreamWindowUpdateMessage received from the peer:
+// streamID == ControlStreamID refills the connection-level window, any
+// other value refills that stream's window.
+func (fc *streamFlowControl) grantSend(streamID uint32, delta uint32) {
+	fc.mu.Lock()
+	if streamID == ControlStreamID {
+		fc.connSend += delta
+	} else if _, ok := fc.sendWindows[streamID]; ok {
+		fc.sendWindows[streamID] += delta
+	}
+	fc.cond.Broadcast()
+	fc.mu.Unlock()
+}
+
+// recordConsumed tracks n more received-and-consumed bytes for streamID and
+// returns the StreamWindowUpdateMessage deltas to send back to the peer,
+// for the stream and/or the connection as a whole, once either tally
+// crosses half the initial window, HTTP/2-style. A zero return means no
+// WindowUpdate is due yet.
+func (fc *streamFlowControl) recordConsumed(streamID uint32, n uint32) (streamDelta, connDelta uint32) {
+	threshold := fc.initialWindow / 2
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.recvConsumed[streamID] += n
+	if fc.recvConsumed[streamID] >= threshold {
+		streamDelta = fc.recvConsumed[streamID]
+		fc.recvConsumed[streamID] = 0
+	}
+
+	fc.connRecvConsumed += n
+	if fc.connRecvConsumed >= threshold {
+		connDelta = fc.connRecvConsumed
+		fc.connRecvConsumed = 0
+	}
+
+	return streamDelta, connDelta
+}
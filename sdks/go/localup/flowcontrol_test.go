@@ -0,0 +1,175 @@
+package localup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamFlowControlAcquireSendCapsAtWindow(t *testing.T) {
+	fc := newStreamFlowControl(100)
+	fc.open(1)
+
+	got, err := fc.acquireSend(1, 150)
+	if err != nil {
+		t.Fatalf("acquireSend: %v", err)
+	}
+	if got != 100 {
+		t.Fatalf("got %d, want 100 (capped at the initial window)", got)
+	}
+
+	// Both the stream and connection windows are now empty; neither alone
+	// is enough to grant more until both are refilled.
+	fc.grantSend(1, 10)
+	fc.grantSend(ControlStreamID, 10)
+	got, err = fc.acquireSend(1, 50)
+	if err != nil {
+		t.Fatalf("acquireSend after grant: %v", err)
+	}
+	if got != 10 {
+		t.Fatalf("got %d, want 10 (only the granted delta)", got)
+	}
+}
+
+func TestStreamFlowControlConnWindowSharedAcrossStreams(t *testing.T) {
+	fc := newStreamFlowControl(100)
+	fc.open(1)
+	fc.open(2)
+
+	// Drain the shared connection window via stream 1.
+	if _, err := fc.acquireSend(1, 100); err != nil {
+		t.Fatalf("acquireSend(1): %v", err)
+	}
+
+	// Stream 2 still has its own full per-stream window, but the
+	// connection-level window is now empty, so it should get nothing until
+	// the connection window (ControlStreamID) is refilled.
+	done := make(chan struct{})
+	go func() {
+		fc.acquireSend(2, 50)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("acquireSend(2) returned before the connection window was refilled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	fc.grantSend(ControlStreamID, 50)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("acquireSend(2) never unblocked after the connection window was refilled")
+	}
+}
+
+func TestStreamFlowControlGrantUnblocksAcquireSend(t *testing.T) {
+	fc := newStreamFlowControl(10)
+	fc.open(1)
+
+	if _, err := fc.acquireSend(1, 10); err != nil {
+		t.Fatalf("acquireSend: %v", err)
+	}
+
+	result := make(chan uint32, 1)
+	go func() {
+		got, err := fc.acquireSend(1, 5)
+		if err != nil {
+			t.Errorf("acquireSend: %v", err)
+			return
+		}
+		result <- got
+	}()
+
+	select {
+	case <-result:
+		t.Fatal("acquireSend returned before the stream window was refilled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	fc.grantSend(1, 5)
+	fc.grantSend(ControlStreamID, 5)
+
+	select {
+	case got := <-result:
+		if got != 5 {
+			t.Fatalf("got %d, want 5", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquireSend never unblocked after grantSend")
+	}
+}
+
+func TestStreamFlowControlCloseAllUnblocksAcquireSend(t *testing.T) {
+	fc := newStreamFlowControl(10)
+	fc.open(1)
+	if _, err := fc.acquireSend(1, 10); err != nil {
+		t.Fatalf("acquireSend: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := fc.acquireSend(1, 1)
+		errCh <- err
+	}()
+
+	select {
+	case <-errCh:
+		t.Fatal("acquireSend returned before closeAll")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	fc.closeAll()
+
+	select {
+	case err := <-errCh:
+		if err != ErrStreamFlowControlClosed {
+			t.Fatalf("got error %v, want ErrStreamFlowControlClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquireSend never unblocked after closeAll")
+	}
+}
+
+func TestStreamFlowControlReleaseIsRefCounted(t *testing.T) {
+	fc := newStreamFlowControl(100)
+	fc.open(1)
+	fc.open(1) // sender and receiver side both hold a reference
+
+	fc.release(1)
+	// One reference remains, so the window must still be live.
+	if _, err := fc.acquireSend(1, 10); err != nil {
+		t.Fatalf("acquireSend after one release: %v", err)
+	}
+
+	fc.release(1)
+	// Last reference dropped: acquireSend on a now-unknown stream fails.
+	if _, err := fc.acquireSend(1, 10); err != ErrStreamFlowControlClosed {
+		t.Fatalf("got error %v, want ErrStreamFlowControlClosed", err)
+	}
+}
+
+func TestStreamFlowControlRecordConsumed(t *testing.T) {
+	fc := newStreamFlowControl(100) // threshold = 50
+
+	streamDelta, connDelta := fc.recordConsumed(1, 30)
+	if streamDelta != 0 || connDelta != 0 {
+		t.Fatalf("got (%d, %d), want (0, 0) below threshold", streamDelta, connDelta)
+	}
+
+	streamDelta, connDelta = fc.recordConsumed(1, 30)
+	if streamDelta != 60 {
+		t.Fatalf("got streamDelta %d, want 60 once the 50-byte threshold is crossed", streamDelta)
+	}
+	if connDelta != 60 {
+		t.Fatalf("got connDelta %d, want 60 (the same bytes also cross the connection threshold)", connDelta)
+	}
+
+	// Both tallies reset to 0 once they cross the threshold and are
+	// reported, so the next small read reports nothing again.
+	streamDelta, connDelta = fc.recordConsumed(1, 10)
+	if streamDelta != 0 || connDelta != 0 {
+		t.Fatalf("got (%d, %d), want (0, 0) right after a threshold reset", streamDelta, connDelta)
+	}
+}
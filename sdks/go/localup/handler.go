@@ -0,0 +1,226 @@
+package localup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ConnHandler serves a single TCP, TLS, or TLS-terminated passthrough
+// stream as a net.Conn, in place of dialing a local address. Implementations
+// do not need to close conn; serveConnHandler closes it once Serve returns.
+type ConnHandler interface {
+	Serve(conn net.Conn) error
+}
+
+// ConnHandlerFunc adapts an ordinary function to a ConnHandler.
+type ConnHandlerFunc func(conn net.Conn) error
+
+// Serve calls f(conn).
+func (f ConnHandlerFunc) Serve(conn net.Conn) error { return f(conn) }
+
+// Handler lets a Go program serve a tunnel's traffic directly in-process
+// instead of forwarding to a local address: Conn handles TCP/TLS/
+// TLS-terminated passthrough streams, and HTTP handles HTTP/HTTPS requests
+// (buffered and streaming alike), mirroring the embedded-listener pattern
+// other tunneling libraries offer. Set via WithHandler in place of
+// WithUpstream/WithPort; either field may be left nil if the tunnel's
+// protocol never needs it.
+type Handler struct {
+	Conn ConnHandler
+	HTTP http.Handler
+}
+
+// serveConnHandler bridges a tunnel Stream to handler over an in-process
+// net.Conn pair, using the same net.Pipe bridging handleACMEChallengeStream
+// uses to adapt a Stream for code that expects a net.Conn: copyIn/copyOut
+// pump bytes between stream and one end of the pipe while handler.Serve runs
+// against the other end, in place of dialing a local address.
+// copyIn is responsible for writing any preamble (e.g. a PROXY protocol
+// header or replayed ClientHello) to local itself before pumping stream
+// data, the same way handleACMEChallengeStream replays connect.ClientHello
+// from inside its copy goroutine rather than synchronously before it:
+// net.Pipe's Write blocks until handler.Serve (the other end's reader) has
+// started, so it can only happen concurrently with Serve, never before it.
+func (t *Tunnel) serveConnHandler(stream Stream, streamID uint32, handler ConnHandler, copyIn, copyOut func(net.Conn)) {
+	local, remote := net.Pipe()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyIn(local)
+	}()
+	go func() {
+		defer wg.Done()
+		copyOut(local)
+	}()
+
+	if err := handler.Serve(remote); err != nil {
+		t.agent.config.Logger.Warn("conn handler returned error", "streamID", streamID, "error", err)
+	}
+	remote.Close()
+	local.Close()
+
+	wg.Wait()
+}
+
+// defaultTCPDialHandler is the base ConnHandler for a TCP passthrough stream
+// when no Handler.Conn is configured but ConnMiddleware still needs
+// something to wrap: it dials LocalHost:LocalPort and pipes conn<->local,
+// writing its own PROXY protocol header directly to the dialed connection
+// rather than relying on serveConnHandler's copyIn preamble.
+func (t *Tunnel) defaultTCPDialHandler(remoteAddr string, remotePort uint16, proxyProtocolV2 []byte) ConnHandler {
+	return ConnHandlerFunc(func(conn net.Conn) error {
+		localAddr := net.JoinHostPort(t.config.LocalHost(), fmt.Sprintf("%d", t.config.LocalPort()))
+		local, err := net.DialTimeout("tcp", localAddr, DefaultConnectTimeout)
+		if err != nil {
+			return err
+		}
+		defer local.Close()
+
+		if err := t.writePROXYHeader(local, remoteAddr, remotePort, proxyProtocolV2); err != nil {
+			return err
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); io.Copy(local, conn) }()
+		go func() { defer wg.Done(); io.Copy(conn, local) }()
+		wg.Wait()
+		return nil
+	})
+}
+
+// defaultTLSDialHandler is the base ConnHandler for a TLS (SNI passthrough)
+// stream when no Handler.Conn is configured but ConnMiddleware still needs
+// something to wrap: it dials LocalHost:LocalPort, replays clientHello, and
+// pipes conn<->local the same way defaultTCPDialHandler does for TCP.
+func (t *Tunnel) defaultTLSDialHandler(clientHello []byte, proxyProtocolV2 []byte) ConnHandler {
+	return ConnHandlerFunc(func(conn net.Conn) error {
+		localAddr := net.JoinHostPort(t.config.LocalHost(), fmt.Sprintf("%d", t.config.LocalPort()))
+		local, err := net.DialTimeout("tcp", localAddr, DefaultConnectTimeout)
+		if err != nil {
+			return err
+		}
+		defer local.Close()
+
+		// TlsConnectMessage carries no RemoteAddr/RemotePort (SNI-passthrough
+		// never decrypts the connection), so only a relay-precomputed header
+		// can be forwarded here.
+		if err := t.writePROXYHeader(local, "", 0, proxyProtocolV2); err != nil {
+			return err
+		}
+		if _, err := local.Write(clientHello); err != nil {
+			return err
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); io.Copy(local, conn) }()
+		go func() { defer wg.Done(); io.Copy(conn, local) }()
+		wg.Wait()
+		return nil
+	})
+}
+
+// headersFromHTTPHeader flattens an http.Header down to the map[string]string
+// wire messages carry, taking each key's first value, the same convention
+// httpForwarder.forward uses for an upstream *http.Response's headers.
+func headersFromHTTPHeader(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for k, v := range h {
+		if len(v) > 0 {
+			headers[k] = v[0]
+		}
+	}
+	return headers
+}
+
+// httpHandlerResponseWriter implements http.ResponseWriter for a buffered
+// handleHTTPRequest call: it records the handler's response so it can be
+// packed into a single HttpResponseMessage, mirroring how httpForwarder.
+// forward receives a complete *http.Response to convert rather than
+// streaming it.
+type httpHandlerResponseWriter struct {
+	header      http.Header
+	statusCode  int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func newHTTPHandlerResponseWriter() *httpHandlerResponseWriter {
+	return &httpHandlerResponseWriter{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (w *httpHandlerResponseWriter) Header() http.Header { return w.header }
+
+func (w *httpHandlerResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.statusCode = statusCode
+}
+
+func (w *httpHandlerResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
+
+// tunnelStreamResponseWriter implements http.ResponseWriter for a streaming
+// HTTP request served by Handler.HTTP: the first WriteHeader/Write call
+// locks in and sends an HttpResponseHeadersMessage, and every subsequent
+// Write goes out immediately as its own HttpBodyChunkMessage, so a handler
+// streaming SSE or chunked output behaves the same in-process as it would
+// behind a real net/http.Server.
+type tunnelStreamResponseWriter struct {
+	t           *Tunnel
+	stream      Stream
+	streamID    uint32
+	header      http.Header
+	statusCode  int
+	wroteHeader bool
+	err         error
+}
+
+func (w *tunnelStreamResponseWriter) Header() http.Header { return w.header }
+
+func (w *tunnelStreamResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.statusCode = statusCode
+
+	headers := headersFromHTTPHeader(w.header)
+	msg := &HttpResponseHeadersMessage{StreamID: w.streamID, Status: uint16(w.statusCode), Headers: headers, ContentLength: -1}
+	if w.t.getHeaderCompression() && len(msg.Headers) > 0 {
+		msg.HeaderBlock = CompressHeaders(msg.Headers)
+		msg.Headers = nil
+	}
+	if err := w.t.encodeDataMessage(w.stream, msg); err != nil {
+		w.err = err
+	}
+}
+
+func (w *tunnelStreamResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	msg := w.t.buildHttpBodyChunkMessage(w.streamID, b)
+	if err := w.t.encodeDataMessage(w.stream, msg); err != nil {
+		w.err = err
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush is a no-op: every Write already goes out as its own frame.
+func (w *tunnelStreamResponseWriter) Flush() {}
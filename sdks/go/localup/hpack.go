@@ -0,0 +1,422 @@
+package localup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// HPACK-style header compression (RFC 7541) for HttpRequestMessage and
+// HttpResponseMessage. It reuses the part of the spec that pays off without a
+// connection-wide dynamic table shared between peers: the 61-entry static
+// table (Appendix A), plus a dynamic table that starts empty and is built up
+// while encoding or decoding a single header block.
+//
+// Each HttpRequestMessage/HttpResponseMessage gets its own fresh dynamic
+// table rather than one shared for the life of the tunnel, because those
+// messages travel on independent per-request Stream objects handled
+// concurrently (see handleHTTPRequest) — a connection-wide table requires a
+// strict total order between every encode and the bytes actually hitting the
+// wire, which this transport doesn't provide. Since headers arrive as a
+// map, a name occurs at most once per block, so within one block the
+// dynamic table never yields an index hit: CompressHeaders compresses
+// through the static table alone. This is a known, accepted scope
+// limit, not an oversight: cross-request header reuse (e.g. a repeated
+// user-agent or cookie value across many requests on the same tunnel) is
+// not compressed by CompressHeaders/DecompressHeaders. A tunnel that needs
+// that instead wants the connection-scoped table HeaderFrameCodec provides
+// (see hpackframes.go), which only raw-framed transports (currently
+// WebSocketTransport) use today.
+//
+// Huffman coding (RFC 7541 Appendix B) is not implemented: literal strings
+// are always written with H=0 ("not Huffman-coded"). A decoder that hits
+// H=1 returns an error rather than risk silently misinterpreting the bytes.
+
+// hpackEntry is a single header table entry (static or dynamic).
+type hpackEntry struct {
+	Name  string
+	Value string
+}
+
+// hpackStaticTable is RFC 7541 Appendix A, 1-indexed in the spec; index 0
+// here is static table index 1.
+var hpackStaticTable = []hpackEntry{
+	{":authority", ""},
+	{":method", "GET"},
+	{":method", "POST"},
+	{":path", "/"},
+	{":path", "/index.html"},
+	{":scheme", "http"},
+	{":scheme", "https"},
+	{":status", "200"},
+	{":status", "204"},
+	{":status", "206"},
+	{":status", "304"},
+	{":status", "400"},
+	{":status", "404"},
+	{":status", "500"},
+	{"accept-charset", ""},
+	{"accept-encoding", "gzip, deflate"},
+	{"accept-language", ""},
+	{"accept-ranges", ""},
+	{"accept", ""},
+	{"access-control-allow-origin", ""},
+	{"age", ""},
+	{"allow", ""},
+	{"authorization", ""},
+	{"cache-control", ""},
+	{"content-disposition", ""},
+	{"content-encoding", ""},
+	{"content-language", ""},
+	{"content-length", ""},
+	{"content-location", ""},
+	{"content-range", ""},
+	{"content-type", ""},
+	{"cookie", ""},
+	{"date", ""},
+	{"etag", ""},
+	{"expect", ""},
+	{"expires", ""},
+	{"from", ""},
+	{"host", ""},
+	{"if-match", ""},
+	{"if-modified-since", ""},
+	{"if-none-match", ""},
+	{"if-range", ""},
+	{"if-unmodified-since", ""},
+	{"last-modified", ""},
+	{"link", ""},
+	{"location", ""},
+	{"max-forwards", ""},
+	{"proxy-authenticate", ""},
+	{"proxy-authorization", ""},
+	{"range", ""},
+	{"referer", ""},
+	{"refresh", ""},
+	{"retry-after", ""},
+	{"server", ""},
+	{"set-cookie", ""},
+	{"strict-transport-security", ""},
+	{"transfer-encoding", ""},
+	{"user-agent", ""},
+	{"vary", ""},
+	{"via", ""},
+	{"www-authenticate", ""},
+}
+
+// hpackEntrySize is RFC 7541 4.1's per-entry accounting: name/value octets
+// plus a fixed 32-byte overhead, used to enforce the dynamic table's max size.
+func hpackEntrySize(name, value string) uint32 {
+	return uint32(len(name)+len(value)) + 32
+}
+
+// hpackDynamicTable is a per-block dynamic table; entries[0] is the most
+// recently added, matching RFC 7541's "index 1 is newest" ordering.
+type hpackDynamicTable struct {
+	maxSize uint32
+	size    uint32
+	entries []hpackEntry
+}
+
+func newHPACKDynamicTable(maxSize uint32) *hpackDynamicTable {
+	return &hpackDynamicTable{maxSize: maxSize}
+}
+
+func (t *hpackDynamicTable) add(name, value string) {
+	entrySize := hpackEntrySize(name, value)
+	t.entries = append([]hpackEntry{{Name: name, Value: value}}, t.entries...)
+	t.size += entrySize
+	for t.size > t.maxSize && len(t.entries) > 0 {
+		last := t.entries[len(t.entries)-1]
+		t.entries = t.entries[:len(t.entries)-1]
+		t.size -= hpackEntrySize(last.Name, last.Value)
+	}
+}
+
+func (t *hpackDynamicTable) setMaxSize(maxSize uint32) {
+	t.maxSize = maxSize
+	for t.size > t.maxSize && len(t.entries) > 0 {
+		last := t.entries[len(t.entries)-1]
+		t.entries = t.entries[:len(t.entries)-1]
+		t.size -= hpackEntrySize(last.Name, last.Value)
+	}
+}
+
+// get returns the entry at a 1-based dynamic table index.
+func (t *hpackDynamicTable) get(index int) (hpackEntry, bool) {
+	if index < 1 || index > len(t.entries) {
+		return hpackEntry{}, false
+	}
+	return t.entries[index-1], true
+}
+
+// hpackLookup resolves a combined static+dynamic index, where 1..len(static)
+// addresses the static table and the rest addresses the dynamic table.
+func hpackLookup(dynamic *hpackDynamicTable, index int) (hpackEntry, bool) {
+	if index >= 1 && index <= len(hpackStaticTable) {
+		return hpackStaticTable[index-1], true
+	}
+	return dynamic.get(index - len(hpackStaticTable))
+}
+
+// hpackFindIndex looks for name+value (or just name) across the static table
+// then the dynamic table, preferring an exact value match.
+func hpackFindIndex(dynamic *hpackDynamicTable, name, value string) (exactIdx int, nameIdx int) {
+	for i, e := range hpackStaticTable {
+		if e.Name == name {
+			if nameIdx == 0 {
+				nameIdx = i + 1
+			}
+			if e.Value == value {
+				return i + 1, nameIdx
+			}
+		}
+	}
+	base := len(hpackStaticTable)
+	for i, e := range dynamic.entries {
+		if e.Name == name {
+			if nameIdx == 0 {
+				nameIdx = base + i + 1
+			}
+			if e.Value == value {
+				return base + i + 1, nameIdx
+			}
+		}
+	}
+	return 0, nameIdx
+}
+
+// hpackWriteInt encodes value with an N-bit prefix (RFC 7541 5.1); flags are
+// the already-shifted high bits identifying the instruction (e.g. 0x80 for
+// an indexed header field).
+func hpackWriteInt(buf *bytes.Buffer, prefixBits uint, flags byte, value uint64) {
+	maxPrefix := uint64(1)<<prefixBits - 1
+	if value < maxPrefix {
+		buf.WriteByte(flags | byte(value))
+		return
+	}
+	buf.WriteByte(flags | byte(maxPrefix))
+	value -= maxPrefix
+	for value >= 128 {
+		buf.WriteByte(byte(value%128) | 0x80)
+		value /= 128
+	}
+	buf.WriteByte(byte(value))
+}
+
+// hpackReadInt decodes an N-bit-prefixed integer, returning the value and the
+// flag bits that preceded the prefix.
+func hpackReadInt(r *bytes.Reader, prefixBits uint) (uint64, byte, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	maxPrefix := byte(1)<<prefixBits - 1
+	flags := first &^ maxPrefix
+	value := uint64(first & maxPrefix)
+	if value < uint64(maxPrefix) {
+		return value, flags, nil
+	}
+	var shift uint
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		value += uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return value, flags, nil
+}
+
+// hpackWriteString writes a literal string with H=0 (not Huffman-coded).
+func hpackWriteString(buf *bytes.Buffer, s string) {
+	hpackWriteInt(buf, 7, 0x00, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+// hpackReadString reads a literal string, rejecting Huffman-coded ones.
+func hpackReadString(r *bytes.Reader) (string, error) {
+	n, flags, err := hpackReadInt(r, 7)
+	if err != nil {
+		return "", err
+	}
+	if flags&0x80 != 0 {
+		return "", fmt.Errorf("hpack: huffman-coded strings are not supported")
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// HPACKEncoder encodes header blocks against its own dynamic table, which
+// starts empty and persists across EncodeHeaders calls on the same encoder.
+type HPACKEncoder struct {
+	dynamic *hpackDynamicTable
+}
+
+// newHPACKEncoder returns an encoder with an empty dynamic table capped at
+// maxDynamicSize bytes.
+func newHPACKEncoder(maxDynamicSize uint32) *HPACKEncoder {
+	return &HPACKEncoder{dynamic: newHPACKDynamicTable(maxDynamicSize)}
+}
+
+// EncodeHeaders encodes headers into an HPACK block. Headers are visited in
+// sorted name order so that, given the same input, the dynamic table is
+// populated in a deterministic order — required for the dynamic-table
+// indexes referenced later in the same block to mean the same thing on
+// decode.
+func (e *HPACKEncoder) EncodeHeaders(headers map[string]string) []byte {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		value := headers[name]
+		exactIdx, nameIdx := hpackFindIndex(e.dynamic, name, value)
+		if exactIdx != 0 {
+			hpackWriteInt(buf, 7, 0x80, uint64(exactIdx)) // Indexed Header Field
+			continue
+		}
+		if nameIdx != 0 {
+			hpackWriteInt(buf, 6, 0x40, uint64(nameIdx)) // Literal w/ Incremental Indexing, indexed name
+		} else {
+			buf.WriteByte(0x40) // Literal w/ Incremental Indexing, new name
+			hpackWriteString(buf, name)
+		}
+		hpackWriteString(buf, value)
+		e.dynamic.add(name, value)
+	}
+	return buf.Bytes()
+}
+
+// HPACKDecoder decodes header blocks against its own dynamic table, which
+// starts empty and persists across DecodeHeaders calls on the same decoder.
+type HPACKDecoder struct {
+	dynamic *hpackDynamicTable
+}
+
+// newHPACKDecoder returns a decoder with an empty dynamic table capped at
+// maxDynamicSize bytes.
+func newHPACKDecoder(maxDynamicSize uint32) *HPACKDecoder {
+	return &HPACKDecoder{dynamic: newHPACKDynamicTable(maxDynamicSize)}
+}
+
+// DecodeHeaders decodes an HPACK block back into a headers map.
+func (d *HPACKDecoder) DecodeHeaders(data []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		name, value, skip, err := d.decodeField(r)
+		if err != nil {
+			return nil, err
+		}
+		if !skip {
+			headers[name] = value
+		}
+	}
+	return headers, nil
+}
+
+// decodeField decodes one HPACK instruction; skip is true for instructions
+// that don't themselves carry a header field (a dynamic table size update).
+func (d *HPACKDecoder) decodeField(r *bytes.Reader) (name, value string, skip bool, err error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return "", "", false, err
+	}
+	if err := r.UnreadByte(); err != nil {
+		return "", "", false, err
+	}
+
+	switch {
+	case first&0x80 != 0: // Indexed Header Field
+		idx, _, err := hpackReadInt(r, 7)
+		if err != nil {
+			return "", "", false, err
+		}
+		e, ok := hpackLookup(d.dynamic, int(idx))
+		if !ok {
+			return "", "", false, fmt.Errorf("hpack: invalid header index %d", idx)
+		}
+		return e.Name, e.Value, false, nil
+
+	case first&0xC0 == 0x40: // Literal Header Field with Incremental Indexing
+		idx, _, err := hpackReadInt(r, 6)
+		if err != nil {
+			return "", "", false, err
+		}
+		if idx == 0 {
+			name, err = hpackReadString(r)
+		} else {
+			e, ok := hpackLookup(d.dynamic, int(idx))
+			if !ok {
+				return "", "", false, fmt.Errorf("hpack: invalid header name index %d", idx)
+			}
+			name = e.Name
+		}
+		if err != nil {
+			return "", "", false, err
+		}
+		value, err = hpackReadString(r)
+		if err != nil {
+			return "", "", false, err
+		}
+		d.dynamic.add(name, value)
+		return name, value, false, nil
+
+	case first&0xF0 == 0x00, first&0xF0 == 0x10: // Literal without/never indexed
+		idx, _, err := hpackReadInt(r, 4)
+		if err != nil {
+			return "", "", false, err
+		}
+		if idx == 0 {
+			name, err = hpackReadString(r)
+		} else {
+			e, ok := hpackLookup(d.dynamic, int(idx))
+			if !ok {
+				return "", "", false, fmt.Errorf("hpack: invalid header name index %d", idx)
+			}
+			name = e.Name
+		}
+		if err != nil {
+			return "", "", false, err
+		}
+		value, err = hpackReadString(r)
+		if err != nil {
+			return "", "", false, err
+		}
+		return name, value, false, nil
+
+	case first&0xE0 == 0x20: // Dynamic Table Size Update
+		newSize, _, err := hpackReadInt(r, 5)
+		if err != nil {
+			return "", "", false, err
+		}
+		d.dynamic.setMaxSize(uint32(newSize))
+		return "", "", true, nil
+
+	default:
+		return "", "", false, fmt.Errorf("hpack: unknown header field representation 0x%02x", first)
+	}
+}
+
+// CompressHeaders HPACK-encodes headers for the wire, using a fresh
+// DefaultHPACKDynamicTableSize-capped table.
+func CompressHeaders(headers map[string]string) []byte {
+	return newHPACKEncoder(DefaultHPACKDynamicTableSize).EncodeHeaders(headers)
+}
+
+// DecompressHeaders reverses CompressHeaders.
+func DecompressHeaders(block []byte) (map[string]string, error) {
+	return newHPACKDecoder(DefaultHPACKDynamicTableSize).DecodeHeaders(block)
+}
@@ -0,0 +1,93 @@
+package localup
+
+import "testing"
+
+func TestHPACKRoundTrip(t *testing.T) {
+	cases := []map[string]string{
+		{},
+		{":method": "GET", ":path": "/", ":scheme": "https", ":authority": "example.com"},
+		{
+			":status":      "200",
+			"content-type": "application/json",
+			"x-request-id": "abc-123",
+			"x-custom":     "a value with spaces and punctuation!?",
+		},
+	}
+
+	for i, headers := range cases {
+		block := CompressHeaders(headers)
+		got, err := DecompressHeaders(block)
+		if err != nil {
+			t.Fatalf("case %d: DecompressHeaders: %v", i, err)
+		}
+		if len(got) != len(headers) {
+			t.Fatalf("case %d: got %d headers, want %d (%v)", i, len(got), len(headers), got)
+		}
+		for name, want := range headers {
+			if got[name] != want {
+				t.Errorf("case %d: header %q = %q, want %q", i, name, got[name], want)
+			}
+		}
+	}
+}
+
+// TestHPACKStaticTableHit exercises an indexed header field referencing the
+// static table (RFC 7541 Appendix A) rather than a literal.
+func TestHPACKStaticTableHit(t *testing.T) {
+	headers := map[string]string{":method": "GET", ":status": "200"}
+	block := CompressHeaders(headers)
+	if len(block) == 0 {
+		t.Fatal("expected non-empty encoded block")
+	}
+
+	got, err := DecompressHeaders(block)
+	if err != nil {
+		t.Fatalf("DecompressHeaders: %v", err)
+	}
+	if got[":method"] != "GET" || got[":status"] != "200" {
+		t.Fatalf("got %v, want %v", got, headers)
+	}
+}
+
+// TestHPACKDynamicTableAcrossBlocks encodes a name/value pair in one block,
+// then repeats it in a second block on the same encoder/decoder pair, and
+// confirms the second block reuses the dynamic table entry the first added
+// rather than just round-tripping via the static table alone.
+func TestHPACKDynamicTableAcrossBlocks(t *testing.T) {
+	enc := newHPACKEncoder(DefaultHPACKDynamicTableSize)
+	first := enc.EncodeHeaders(map[string]string{"x-trace-id": "deadbeef"})
+	second := enc.EncodeHeaders(map[string]string{"x-trace-id": "deadbeef"})
+
+	dec := newHPACKDecoder(DefaultHPACKDynamicTableSize)
+	got1, err := dec.DecodeHeaders(first)
+	if err != nil {
+		t.Fatalf("DecodeHeaders(first): %v", err)
+	}
+	if got1["x-trace-id"] != "deadbeef" {
+		t.Fatalf("first block: got %v", got1)
+	}
+
+	got2, err := dec.DecodeHeaders(second)
+	if err != nil {
+		t.Fatalf("DecodeHeaders(second): %v", err)
+	}
+	if got2["x-trace-id"] != "deadbeef" {
+		t.Fatalf("second block: got %v", got2)
+	}
+	// The second block should be shorter: it can reference the dynamic
+	// table entry the first block's new-name literal just added instead of
+	// re-sending the name and value in full.
+	if len(second) >= len(first) {
+		t.Errorf("expected repeated header to shrink via dynamic table reuse: first=%d second=%d", len(first), len(second))
+	}
+}
+
+func TestHPACKUnsupportedHuffmanRejected(t *testing.T) {
+	// 0x40 = Literal Header Field with Incremental Indexing, new name;
+	// the following name/value strings set H=1 (Huffman-coded), which
+	// hpack.go deliberately doesn't implement (see hpack.go's doc comment).
+	block := []byte{0x40, 0x81, 'x'}
+	if _, err := DecompressHeaders(block); err == nil {
+		t.Fatal("expected error decoding a Huffman-coded string, got nil")
+	}
+}
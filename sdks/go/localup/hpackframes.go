@@ -0,0 +1,93 @@
+package localup
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// HeaderFrameCodec is a per-connection HPACK (RFC 7541, via
+// golang.org/x/net/http2/hpack) encoder/decoder pair for the
+// FrameTypeHeaders/FrameTypeContinuation frames a raw-framed transport
+// (currently WebSocketTransport) uses to carry header-heavy HTTP metadata.
+//
+// This is deliberately not the same design as hpack.go's CompressHeaders/
+// DecompressHeaders, which resets its dynamic table per HttpRequestMessage/
+// HttpResponseMessage because those messages travel on independent
+// concurrently-handled Streams with no guaranteed order between them. A
+// HeaderFrameCodec's dynamic table instead lives for the life of the
+// underlying connection: every frame it emits passes through that
+// connection's single writeMu-serialized writer, so encode order and wire
+// order always match, and the peer's decoder sees frames in that same
+// order. That ordering guarantee is what makes a long-lived, shared
+// dynamic table safe here, and it's what captures cross-request header
+// reuse the per-message table can't.
+type HeaderFrameCodec struct {
+	mu     sync.Mutex
+	encBuf bytes.Buffer
+	enc    *hpack.Encoder
+	dec    *hpack.Decoder
+}
+
+// NewHeaderFrameCodec creates a HeaderFrameCodec with DefaultHPACKDynamicTableSize.
+func NewHeaderFrameCodec() *HeaderFrameCodec {
+	c := &HeaderFrameCodec{}
+	c.enc = hpack.NewEncoder(&c.encBuf)
+	c.enc.SetMaxDynamicTableSize(DefaultHPACKDynamicTableSize)
+	c.dec = hpack.NewDecoder(DefaultHPACKDynamicTableSize, nil)
+	return c
+}
+
+// EncodeHeaderFrames HPACK-encodes fields against the codec's dynamic
+// table and splits the result into frame payloads no larger than
+// MaxFrameSize. The caller sends frames[0] as FrameTypeHeaders and the rest
+// as FrameTypeContinuation, flagging the last one FrameFlagFin.
+func (c *HeaderFrameCodec) EncodeHeaderFrames(fields []hpack.HeaderField) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.encBuf.Reset()
+	for _, f := range fields {
+		if err := c.enc.WriteField(f); err != nil {
+			return nil, fmt.Errorf("localup: hpack encode: %w", err)
+		}
+	}
+	block := c.encBuf.Bytes()
+
+	var frames [][]byte
+	for {
+		n := len(block)
+		if n > MaxFrameSize {
+			n = MaxFrameSize
+		}
+		chunk := make([]byte, n)
+		copy(chunk, block[:n])
+		frames = append(frames, chunk)
+		block = block[n:]
+		if len(block) == 0 {
+			break
+		}
+	}
+	return frames, nil
+}
+
+// DecodeHeaderFrames reassembles the fragments written by
+// EncodeHeaderFrames (a FrameTypeHeaders frame followed by any
+// FrameTypeContinuation frames) and HPACK-decodes them against the codec's
+// dynamic table.
+func (c *HeaderFrameCodec) DecodeHeaderFrames(fragments [][]byte) ([]hpack.HeaderField, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var block []byte
+	for _, f := range fragments {
+		block = append(block, f...)
+	}
+	fields, err := c.dec.DecodeFull(block)
+	if err != nil {
+		return nil, fmt.Errorf("localup: hpack decode: %w", err)
+	}
+	return fields, nil
+}
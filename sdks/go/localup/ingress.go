@@ -0,0 +1,379 @@
+package localup
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// IngressRule selects an upstream service for an incoming HTTP/HTTPS request
+// by Host header and URL path, in the style of cloudflared's ingress rules:
+// rules are matched in order and the first match wins, so a tunnel serving
+// multiple local services needs only one WithIngress call instead of one
+// tunnel per service.
+type IngressRule struct {
+	// Hostname matches the request's Host header exactly. Empty matches any
+	// host, which is what the required catch-all final rule normally uses.
+	Hostname string
+
+	// Path is a regular expression matched against the request URI. Empty
+	// matches any path.
+	Path string
+
+	// Service is where a matching request is forwarded:
+	//   - "http://host:port" or "https://host:port" for an HTTP(S) upstream
+	//   - "tcp://host:port" for a raw TCP upstream (HTTP stream passthrough)
+	//   - "unix:/path/to.sock" for a local Unix domain socket
+	//   - "http_status:404" (or any status code) to reply without dialing
+	//     anything, e.g. to explicitly reject requests that fall through to
+	//     a hostname with nothing behind it
+	//   - "hello_world" for the built-in test service (see helloWorldBody),
+	//     useful for smoke-testing ingress routing before a real local
+	//     service is wired up
+	Service string
+
+	// OriginRequest overrides how this rule's requests are made to Service.
+	OriginRequest OriginRequestConfig
+}
+
+// OriginRequestConfig customizes the outbound request a matched IngressRule
+// makes to its Service, mirroring cloudflared's per-rule originRequest
+// overrides.
+type OriginRequestConfig struct {
+	// ConnectTimeout bounds dialing Service. 0 means DefaultConnectTimeout.
+	ConnectTimeout time.Duration
+
+	// NoTLSVerify skips TLS certificate verification when Service is https://.
+	NoTLSVerify bool
+
+	// HTTP2Origin sets the upstream http.Transport's ForceAttemptHTTP2, so
+	// an https:// Service negotiates HTTP/2 through ALPN. Plaintext http://
+	// and unix: Services still use HTTP/1.1; prior-knowledge h2c is not
+	// attempted.
+	HTTP2Origin bool
+
+	// CAPool is a path to a PEM file of CA certificates trusted for
+	// verifying Service's certificate, instead of the system pool. Ignored
+	// if NoTLSVerify is set.
+	CAPool string
+
+	// HTTPHostHeader overrides the Host header sent to Service instead of
+	// forwarding the original request's Host header.
+	HTTPHostHeader string
+
+	// ProxyType routes requests to Service through an upstream proxy
+	// instead of dialing it directly: "" for a direct connection,
+	// "http_connect" to tunnel through an HTTP CONNECT proxy, or "socks5"
+	// to tunnel through a SOCKS5 proxy. ProxyAddress is required whenever
+	// ProxyType is set. Ignored for "tcp://" Service values, which are raw
+	// passthrough and never go through an *http.Client, and for "unix:"
+	// Service values, which always dial the socket directly.
+	ProxyType string
+
+	// ProxyAddress is the "host:port" of the proxy named by ProxyType.
+	ProxyAddress string
+}
+
+// httpStatusSentinelPrefix marks an IngressRule.Service that replies with a
+// fixed status instead of forwarding anywhere, e.g. "http_status:404".
+const httpStatusSentinelPrefix = "http_status:"
+
+// helloWorldService marks an IngressRule.Service that replies with the
+// built-in hello_world test page instead of forwarding anywhere, mirroring
+// cloudflared's same-named test origin.
+const helloWorldService = "hello_world"
+
+// helloWorldBody is the fixed body returned by a "hello_world" IngressRule.
+const helloWorldBody = "<!DOCTYPE html><html><body>Hello from localup's built-in hello_world ingress service!</body></html>"
+
+// ErrNoIngressMatch is returned when no IngressRule, including the
+// catch-all, matches a request. Normal configurations can't hit this since
+// Validate requires the final rule to be a catch-all.
+var ErrNoIngressMatch = errors.New("no ingress rule matched")
+
+// validateIngress checks that every rule's Path compiles and that, when
+// Ingress is non-empty, its final rule is a catch-all (Hostname == "" and
+// Path == ""), matching cloudflared's ingress semantics: a config whose last
+// rule could still fail to match would silently 404 requests a user expects
+// routed somewhere.
+func validateIngress(rules []IngressRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	for i, rule := range rules {
+		if rule.Path != "" {
+			if _, err := regexp.Compile(rule.Path); err != nil {
+				return fmt.Errorf("ingress rule %d: invalid path pattern %q: %w", i, rule.Path, err)
+			}
+		}
+		if rule.Service == "" {
+			return fmt.Errorf("ingress rule %d: service is required", i)
+		}
+	}
+	last := rules[len(rules)-1]
+	if last.Hostname != "" || last.Path != "" {
+		return errors.New("ingress: the final rule must be a catch-all (empty hostname and path)")
+	}
+	return nil
+}
+
+// compiledIngressRule is an IngressRule with its Path pre-compiled and its
+// dialing resources (client or status code) built once at forwarder
+// construction instead of per-request.
+type compiledIngressRule struct {
+	rule       IngressRule
+	path       *regexp.Regexp
+	statusCode int  // >0 for an http_status: sentinel, 0 otherwise
+	helloWorld bool // true for a hello_world sentinel
+	client     *http.Client
+	serviceURL *url.URL
+	network    string // "tcp" or "unix", for raw passthrough dialing; "" for a sentinel rule
+	address    string // dial address/path matching network, "" for a sentinel rule
+}
+
+// compileIngressRules builds a compiledIngressRule for every rule, sharing
+// the dialing conventions newHTTPForwarder already uses for the
+// non-ingress case.
+func compileIngressRules(rules []IngressRule) ([]compiledIngressRule, error) {
+	compiled := make([]compiledIngressRule, 0, len(rules))
+	for _, rule := range rules {
+		c := compiledIngressRule{rule: rule}
+
+		if rule.Path != "" {
+			re, err := regexp.Compile(rule.Path)
+			if err != nil {
+				return nil, err
+			}
+			c.path = re
+		}
+
+		if strings.HasPrefix(rule.Service, httpStatusSentinelPrefix) {
+			code, err := strconv.Atoi(strings.TrimPrefix(rule.Service, httpStatusSentinelPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("ingress rule for %q: invalid %s: %w", rule.Hostname, rule.Service, err)
+			}
+			c.statusCode = code
+			compiled = append(compiled, c)
+			continue
+		}
+
+		if rule.Service == helloWorldService {
+			c.helloWorld = true
+			compiled = append(compiled, c)
+			continue
+		}
+
+		network, address, err := resolveServiceAddr(rule.Service)
+		if err != nil {
+			return nil, fmt.Errorf("ingress rule for %q: %w", rule.Hostname, err)
+		}
+		c.network = network
+		c.address = address
+
+		if !strings.HasPrefix(rule.Service, "tcp://") {
+			client, serviceURL, err := buildIngressClient(rule.Service, rule.OriginRequest)
+			if err != nil {
+				return nil, fmt.Errorf("ingress rule for %q: %w", rule.Hostname, err)
+			}
+			c.client = client
+			c.serviceURL = serviceURL
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// buildIngressClient builds the *http.Client and upstream URL for an
+// IngressRule.Service of the form "http://host:port", "https://host:port",
+// or "unix:/path/to.sock". "tcp://" services are handled separately by raw
+// passthrough (see httpForwarder.resolveStreamAddr) and never reach here.
+func buildIngressClient(service string, origin OriginRequestConfig) (*http.Client, *url.URL, error) {
+	connectTimeout := origin.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+
+	dial, err := buildProxyDialer(origin, connectTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if strings.HasPrefix(service, "unix:") {
+		sockPath := strings.TrimPrefix(service, "unix:")
+		dialer := &net.Dialer{Timeout: connectTimeout}
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", sockPath)
+			},
+			ForceAttemptHTTP2: origin.HTTP2Origin,
+		}
+		return &http.Client{Transport: transport, Timeout: 0}, &url.URL{Scheme: "http", Host: "localhost"}, nil
+	}
+
+	u, err := url.Parse(service)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid service %q: %w", service, err)
+	}
+
+	transport := &http.Transport{
+		DialContext:       (&net.Dialer{Timeout: connectTimeout}).DialContext,
+		ForceAttemptHTTP2: origin.HTTP2Origin,
+	}
+	if dial != nil {
+		transport.DialContext = dial
+	}
+	if u.Scheme == "https" {
+		tlsConfig := &tls.Config{InsecureSkipVerify: origin.NoTLSVerify}
+		if origin.CAPool != "" {
+			pool, err := loadCAPool(origin.CAPool)
+			if err != nil {
+				return nil, nil, err
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Transport: transport}, u, nil
+}
+
+// buildProxyDialer returns an http.Transport.DialContext-compatible dialer
+// that reaches an ingress rule's Service through origin's ProxyType/
+// ProxyAddress, or nil (dial Service directly) if ProxyType is unset.
+func buildProxyDialer(origin OriginRequestConfig, connectTimeout time.Duration) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	if origin.ProxyType == "" {
+		return nil, nil
+	}
+	if origin.ProxyAddress == "" {
+		return nil, fmt.Errorf("proxy-type %q requires ProxyAddress", origin.ProxyType)
+	}
+
+	switch origin.ProxyType {
+	case "socks5":
+		dialer, err := proxy.SOCKS5("tcp", origin.ProxyAddress, nil, &net.Dialer{Timeout: connectTimeout})
+		if err != nil {
+			return nil, fmt.Errorf("building socks5 proxy dialer for %q: %w", origin.ProxyAddress, err)
+		}
+		ctxDialer, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			// proxy.SOCKS5 always returns a proxy.ContextDialer today; this
+			// is a defensive fallback should that ever change.
+			return func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.Dial(network, addr)
+			}, nil
+		}
+		return ctxDialer.DialContext, nil
+	case "http_connect":
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialHTTPConnectProxy(ctx, origin.ProxyAddress, addr, connectTimeout)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown proxy-type %q", origin.ProxyType)
+	}
+}
+
+// dialHTTPConnectProxy dials proxyAddr and issues a CONNECT request for
+// targetAddr, returning the resulting tunnel once the proxy replies 200 OK.
+func dialHTTPConnectProxy(ctx context.Context, proxyAddr, targetAddr string, connectTimeout time.Duration) (net.Conn, error) {
+	conn, err := (&net.Dialer{Timeout: connectTimeout}).DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing proxy %q: %w", proxyAddr, err)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: targetAddr},
+		Host:   targetAddr,
+		Header: make(http.Header),
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("writing CONNECT to proxy %q: %w", proxyAddr, err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading CONNECT response from proxy %q: %w", proxyAddr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %q refused CONNECT to %q: %s", proxyAddr, targetAddr, resp.Status)
+	}
+	return conn, nil
+}
+
+// resolveServiceAddr extracts the raw dial network and address for an
+// IngressRule.Service, for the HTTP stream passthrough path
+// (Tunnel.handleHTTPStream) which copies bytes without parsing them as HTTP
+// and so needs a plain net.Dial target rather than an *http.Client.
+func resolveServiceAddr(service string) (network, address string, err error) {
+	switch {
+	case strings.HasPrefix(service, "tcp://"):
+		return "tcp", strings.TrimPrefix(service, "tcp://"), nil
+	case strings.HasPrefix(service, "unix:"):
+		return "unix", strings.TrimPrefix(service, "unix:"), nil
+	case strings.HasPrefix(service, "http://"):
+		return "tcp", strings.TrimPrefix(service, "http://"), nil
+	case strings.HasPrefix(service, "https://"):
+		return "tcp", strings.TrimPrefix(service, "https://"), nil
+	default:
+		return "", "", fmt.Errorf("invalid service %q", service)
+	}
+}
+
+// lookupHeader does a case-insensitive lookup in a map[string]string header
+// set, since wire messages carry headers as a plain map rather than
+// http.Header's canonicalized multimap.
+func lookupHeader(headers map[string]string, key string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// loadCAPool reads a PEM file of CA certificates into a fresh x509.CertPool.
+func loadCAPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA pool %q: %w", path, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA pool %q", path)
+	}
+	return pool, nil
+}
+
+// matchIngress returns the first compiledIngressRule whose Hostname and Path match
+// host/path, in order, or false if none do (including no catch-all, which
+// Validate normally prevents).
+func matchIngress(rules []compiledIngressRule, host, path string) (*compiledIngressRule, bool) {
+	for i := range rules {
+		r := &rules[i]
+		if r.rule.Hostname != "" && r.rule.Hostname != host {
+			continue
+		}
+		if r.path != nil && !r.path.MatchString(path) {
+			continue
+		}
+		return r, true
+	}
+	return nil, false
+}
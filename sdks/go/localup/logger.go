@@ -3,6 +3,7 @@ package localup
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"strings"
 )
@@ -13,6 +14,12 @@ type Logger interface {
 	Info(msg string, keysAndValues ...interface{})
 	Warn(msg string, keysAndValues ...interface{})
 	Error(msg string, keysAndValues ...interface{})
+
+	// With returns a Logger that prepends keysAndValues to every subsequent
+	// call's own keysAndValues, so callers on a hot path (e.g. per-stream
+	// tunnel handlers) can bind context like stream_id once instead of
+	// repeating it on every log line.
+	With(keysAndValues ...interface{}) Logger
 }
 
 // LogLevelFromEnv returns a LogLevel based on the LOCALUP_LOG environment variable.
@@ -36,15 +43,27 @@ func LogLevelFromEnv() LogLevel {
 	}
 }
 
-// LoggerFromEnv creates a logger based on the LOCALUP_LOG environment variable.
+// LoggerFromEnv creates a logger based on the LOCALUP_LOG and
+// LOCALUP_LOG_FORMAT environment variables.
 // If LOCALUP_LOG is "none", returns a no-op logger.
-// Otherwise returns a standard logger at the specified level.
+// LOCALUP_LOG_FORMAT selects the output format: "json" or "text" returns a
+// NewSlogLogger wrapping a slog.JSONHandler or slog.TextHandler at the
+// chosen level, while any other value (including unset) returns a standard
+// logger.
 func LoggerFromEnv() Logger {
 	level := LogLevelFromEnv()
 	if level == LogLevelNone {
 		return &noopLogger{}
 	}
-	return NewStdLogger(level)
+
+	switch strings.ToLower(os.Getenv("LOCALUP_LOG_FORMAT")) {
+	case "json":
+		return NewSlogLogger(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level.slogLevel()}))
+	case "text":
+		return NewSlogLogger(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level.slogLevel()}))
+	default:
+		return NewStdLogger(level)
+	}
 }
 
 // noopLogger is a logger that discards all output.
@@ -54,11 +73,13 @@ func (l *noopLogger) Debug(_ string, _ ...interface{}) {}
 func (l *noopLogger) Info(_ string, _ ...interface{})  {}
 func (l *noopLogger) Warn(_ string, _ ...interface{})  {}
 func (l *noopLogger) Error(_ string, _ ...interface{}) {}
+func (l *noopLogger) With(_ ...interface{}) Logger     { return l }
 
 // stdLogger is a simple logger that uses the standard library.
 type stdLogger struct {
 	logger *log.Logger
 	level  LogLevel
+	prefix []interface{} // keysAndValues bound by With, prepended to every call
 }
 
 // LogLevel represents the logging level.
@@ -72,6 +93,22 @@ const (
 	LogLevelNone // Disables all logging
 )
 
+// slogLevel converts l to the equivalent slog.Level. LogLevelNone has no
+// slog equivalent; callers must avoid constructing a slog handler in that
+// case (see LoggerFromEnv).
+func (l LogLevel) slogLevel() slog.Level {
+	switch l {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
 // NewStdLogger creates a new standard library logger.
 func NewStdLogger(level LogLevel) Logger {
 	return &stdLogger{
@@ -104,7 +141,18 @@ func (l *stdLogger) Error(msg string, keysAndValues ...interface{}) {
 	}
 }
 
+func (l *stdLogger) With(keysAndValues ...interface{}) Logger {
+	return &stdLogger{
+		logger: l.logger,
+		level:  l.level,
+		prefix: append(append([]interface{}{}, l.prefix...), keysAndValues...),
+	}
+}
+
 func (l *stdLogger) log(level, msg string, keysAndValues ...interface{}) {
+	if len(l.prefix) > 0 {
+		keysAndValues = append(append([]interface{}{}, l.prefix...), keysAndValues...)
+	}
 	if len(keysAndValues) == 0 {
 		l.logger.Printf("%s: %s", level, msg)
 		return
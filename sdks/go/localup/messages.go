@@ -33,6 +33,54 @@ const (
 	MessageTypeHttpStreamConnect MessageType = 15
 	MessageTypeHttpStreamData    MessageType = 16
 	MessageTypeHttpStreamClose   MessageType = 17
+
+	// TLS-terminated TCP messages: the relay terminates TLS and forwards
+	// plain TCP to the local app, unlike MessageTypeTls* which passes the
+	// encrypted bytes through untouched.
+	MessageTypeTlsTermConnect MessageType = 18
+	MessageTypeTlsTermData    MessageType = 19
+	MessageTypeTlsTermClose   MessageType = 20
+
+	// HTTP/3 messages: bidirectional QUIC streams modeled on the
+	// HttpStream* family, plus unreliable datagrams for WebTransport and
+	// MASQUE-style upstreams.
+	MessageTypeHttp3StreamConnect MessageType = 21
+	MessageTypeHttp3StreamData    MessageType = 22
+	MessageTypeHttp3StreamClose   MessageType = 23
+	MessageTypeQuicDatagram       MessageType = 24
+
+	// Multiplexing messages: flow-control signaling for the tunnel's
+	// per-stream flow control (see flowcontrol.go). A StreamWindowUpdate
+	// with StreamID 0 refers to the connection-level window rather than
+	// any individual stream.
+	MessageTypeStreamWindowUpdate MessageType = 25
+	MessageTypeStreamReset        MessageType = 26
+
+	// UDP messages: unlike TCP/TLS, a single stream multiplexes datagrams
+	// for every remote peer hitting the tunnel's UDP listener, so each
+	// UdpDatagramMessage carries the peer address alongside the payload.
+	MessageTypeUdpBind     MessageType = 27
+	MessageTypeUdpDatagram MessageType = 28
+	MessageTypeUdpClose    MessageType = 29
+
+	// CertUpdate is a control message (Stream 0): the acme package delivers
+	// an obtained/renewed keypair to the relay through it. New variants
+	// must keep being appended here, never inserted earlier, since the
+	// ordinal is what the Rust side's bincode enum matches on.
+	MessageTypeCertUpdate MessageType = 30
+
+	// Streaming HTTP messages: an alternative to HttpRequestMessage/
+	// HttpResponseMessage that never buffers a full body. HttpRequestHeaders
+	// opens the exchange, zero or more HttpBodyChunk frames carry the
+	// request body, and HttpEnd closes it; the relay/agent then reply with
+	// HttpResponseHeaders as soon as the upstream responds, their own
+	// HttpBodyChunk frames, and a closing HttpEnd. HttpTrailers is optional
+	// and, when sent, always precedes HttpEnd on the same side.
+	MessageTypeHttpRequestHeaders  MessageType = 31
+	MessageTypeHttpBodyChunk       MessageType = 32
+	MessageTypeHttpResponseHeaders MessageType = 33
+	MessageTypeHttpTrailers        MessageType = 34
+	MessageTypeHttpEnd             MessageType = 35
 )
 
 // TunnelMessage is the base interface for all protocol messages.
@@ -52,22 +100,71 @@ func (m *ConnectMessage) MessageType() MessageType { return MessageTypeConnect }
 
 // ProtocolSpec specifies a protocol configuration in the Connect message.
 type ProtocolSpec struct {
-	Type       string  `json:"type"` // "tcp", "tls", "http", "https"
+	Type       string  `json:"type"` // "tcp", "tls", "http", "https", "tls-terminated"
 	Port       uint16  `json:"port,omitempty"`
 	SNIPattern string  `json:"sni_pattern,omitempty"`
 	Subdomain  *string `json:"subdomain,omitempty"`
+
+	// CertSource selects the certificate used to terminate TLS for
+	// "tls-terminated" protocol specs: "wildcard" (the relay's shared cert,
+	// the default) or "custom" (a user-uploaded bundle identified by
+	// CertBundleID).
+	CertSource string `json:"cert_source,omitempty"`
+
+	// CertBundleID references a cert bundle previously uploaded out-of-band
+	// to the relay. Only meaningful when CertSource is "custom".
+	CertBundleID string `json:"cert_bundle_id,omitempty"`
+
+	// Domain requests a custom domain for an "https" protocol spec instead
+	// of an auto-assigned subdomain, e.g. "app.example.com". Set via
+	// WithDomain. The relay routes the domain's traffic, including
+	// TLS-ALPN-01 challenge connections, to this tunnel; see
+	// ManagedCert/CertUpdateMessage for how its certificate gets there.
+	Domain string `json:"domain,omitempty"`
+
+	// ManagedCert is true when a CertUpdateMessage should be expected for
+	// Domain instead of the relay needing a certificate provisioned for it
+	// out of band. Set via WithACME.
+	ManagedCert bool `json:"managed_cert,omitempty"`
+
+	// Compression lists the compression algorithms this client can decode
+	// for data frames on this protocol, in preference order. Valid values:
+	// "none", "zstd", "snappy", "gzip". The relay picks the strongest
+	// algorithm both sides advertise and reports it back in
+	// ConnectedMessage.ChosenCompression.
+	Compression []string `json:"compression,omitempty"`
 }
 
 // TunnelConfigMsg is the tunnel configuration sent in Connect message.
 type TunnelConfigMsg struct {
-	LocalHost           string         `json:"local_host"`
-	LocalPort           *uint16        `json:"local_port,omitempty"`
-	LocalHTTPS          bool           `json:"local_https"`
-	ExitNode            ExitNodeConfig `json:"exit_node"`
-	Failover            bool           `json:"failover"`
-	IPAllowlist         []string       `json:"ip_allowlist"`
-	EnableCompression   bool           `json:"enable_compression"`
-	EnableMultiplexing  bool           `json:"enable_multiplexing"`
+	LocalHost          string         `json:"local_host"`
+	LocalPort          *uint16        `json:"local_port,omitempty"`
+	LocalHTTPS         bool           `json:"local_https"`
+	ExitNode           ExitNodeConfig `json:"exit_node"`
+	Failover           bool           `json:"failover"`
+	IPAllowlist        []string       `json:"ip_allowlist"`
+	EnableCompression  bool           `json:"enable_compression"`
+	EnableMultiplexing bool           `json:"enable_multiplexing"`
+
+	// EnableHTTP3 requests that the relay forward HTTP/3 connections
+	// (negotiated via Alt-Svc/ALPN at the edge) through Http3Stream*
+	// messages instead of downgrading to HTTP/1.1.
+	EnableHTTP3 bool `json:"enable_http3"`
+
+	// HTTP3IdleTimeoutSecs is the idle timeout for HTTP/3 streams, in
+	// seconds. 0 means use the default (see DefaultHTTP3IdleTimeout).
+	HTTP3IdleTimeoutSecs uint32 `json:"http3_idle_timeout_secs,omitempty"`
+
+	// MaxConcurrentStreams caps how many multiplexed streams will be
+	// allowed open at once when EnableMultiplexing is set. 0 means use
+	// the default (see DefaultMaxConcurrentStreams).
+	MaxConcurrentStreams uint32 `json:"max_concurrent_streams,omitempty"`
+
+	// EnableHeaderCompression requests HPACK-style compression (see
+	// hpack.go) for HttpRequestMessage/HttpResponseMessage headers. The
+	// relay acks support in ConnectedMessage.HeaderCompressionEnabled;
+	// until both sides agree, headers always travel as plain Headers maps.
+	EnableHeaderCompression bool `json:"enable_header_compression,omitempty"`
 }
 
 // ExitNodeConfig specifies how to select an exit node.
@@ -82,6 +179,16 @@ type ExitNodeConfig struct {
 type ConnectedMessage struct {
 	TunnelID  string     `json:"localup_id"`
 	Endpoints []Endpoint `json:"endpoints"`
+
+	// ChosenCompression is the compression algorithm the relay selected
+	// from ProtocolSpec.Compression, or "none" if no mutually supported
+	// algorithm was found.
+	ChosenCompression string `json:"chosen_compression,omitempty"`
+
+	// HeaderCompressionEnabled acknowledges TunnelConfigMsg.EnableHeaderCompression;
+	// true only if the relay also understands HttpRequestMessage/
+	// HttpResponseMessage.HeaderBlock.
+	HeaderCompressionEnabled bool `json:"header_compression_enabled,omitempty"`
 }
 
 func (m *ConnectedMessage) MessageType() MessageType { return MessageTypeConnected }
@@ -126,6 +233,12 @@ type TcpConnectMessage struct {
 	StreamID   uint32 `json:"stream_id"`
 	RemoteAddr string `json:"remote_addr"`
 	RemotePort uint16 `json:"remote_port"`
+
+	// ProxyProtocolV2 is an optional PROXY protocol v2 header the relay
+	// precomputed from the original client's address. When present, the
+	// local forwarder prepends it verbatim instead of building its own;
+	// see WithPROXYProtocol.
+	ProxyProtocolV2 []byte `json:"proxy_protocol_v2,omitempty"`
 }
 
 func (m *TcpConnectMessage) MessageType() MessageType { return MessageTypeTcpConnect }
@@ -134,6 +247,12 @@ func (m *TcpConnectMessage) MessageType() MessageType { return MessageTypeTcpCon
 type TcpDataMessage struct {
 	StreamID uint32 `json:"stream_id"`
 	Data     []byte `json:"data"`
+
+	// Compressed indicates Data was compressed with the stream's negotiated
+	// algorithm; OrigLen is the uncompressed length, used to size the
+	// decode buffer.
+	Compressed bool   `json:"compressed,omitempty"`
+	OrigLen    uint32 `json:"orig_len,omitempty"`
 }
 
 func (m *TcpDataMessage) MessageType() MessageType { return MessageTypeTcpData }
@@ -150,6 +269,25 @@ type TlsConnectMessage struct {
 	StreamID    uint32 `json:"stream_id"`
 	SNI         string `json:"sni"`
 	ClientHello []byte `json:"client_hello"`
+
+	// ProxyProtocolV2 is an optional PROXY protocol v2 header the relay
+	// precomputed from the original client's address; see WithPROXYProtocol.
+	ProxyProtocolV2 []byte `json:"proxy_protocol_v2,omitempty"`
+
+	// ALPNOffers lists the ALPN protocols the client offered in its
+	// ClientHello, parsed by the relay ahead of forwarding.
+	ALPNOffers []string `json:"alpn_offers,omitempty"`
+
+	// JA3 and JA4 are TLS client fingerprints the relay computed from the
+	// ClientHello, useful for bot/client identification at the local app.
+	JA3 string `json:"ja3,omitempty"`
+	JA4 string `json:"ja4,omitempty"`
+
+	// ClientCertChain and ClientCertSHA256 are populated only when the
+	// relay validated a client certificate (mTLS on a ProtocolTLSTerminated
+	// tunnel); ClientCertChain holds DER-encoded certificates, leaf first.
+	ClientCertChain  [][]byte `json:"client_cert_chain,omitempty"`
+	ClientCertSHA256 string   `json:"client_cert_sha256,omitempty"`
 }
 
 func (m *TlsConnectMessage) MessageType() MessageType { return MessageTypeTlsConnect }
@@ -158,6 +296,10 @@ func (m *TlsConnectMessage) MessageType() MessageType { return MessageTypeTlsCon
 type TlsDataMessage struct {
 	StreamID uint32 `json:"stream_id"`
 	Data     []byte `json:"data"`
+
+	// Compressed and OrigLen mirror TcpDataMessage's fields.
+	Compressed bool   `json:"compressed,omitempty"`
+	OrigLen    uint32 `json:"orig_len,omitempty"`
 }
 
 func (m *TlsDataMessage) MessageType() MessageType { return MessageTypeTlsData }
@@ -176,6 +318,20 @@ type HttpRequestMessage struct {
 	URI      string            `json:"uri"`
 	Headers  map[string]string `json:"headers"`
 	Body     []byte            `json:"body,omitempty"`
+
+	// Compressed and OrigLen mirror TcpDataMessage's fields, letting Body
+	// travel compressed over the wire.
+	Compressed bool   `json:"compressed,omitempty"`
+	OrigLen    uint32 `json:"orig_len,omitempty"`
+
+	// HeaderBlock holds Headers HPACK-compressed (RFC 7541 static table plus
+	// a fresh per-message dynamic table; see hpack.go) when header
+	// compression was negotiated (TunnelConfigMsg.EnableHeaderCompression /
+	// ConnectedMessage.HeaderCompressionEnabled). When non-empty it takes
+	// precedence over Headers on the wire; callers still always see Headers
+	// populated, since the tunnel decompresses HeaderBlock right after
+	// decoding.
+	HeaderBlock []byte `json:"header_block,omitempty"`
 }
 
 func (m *HttpRequestMessage) MessageType() MessageType { return MessageTypeHttpRequest }
@@ -186,6 +342,14 @@ type HttpResponseMessage struct {
 	Status   uint16            `json:"status"`
 	Headers  map[string]string `json:"headers"`
 	Body     []byte            `json:"body,omitempty"`
+
+	// Compressed and OrigLen mirror TcpDataMessage's fields, letting Body
+	// travel compressed over the wire.
+	Compressed bool   `json:"compressed,omitempty"`
+	OrigLen    uint32 `json:"orig_len,omitempty"`
+
+	// HeaderBlock mirrors HttpRequestMessage.HeaderBlock.
+	HeaderBlock []byte `json:"header_block,omitempty"`
 }
 
 func (m *HttpResponseMessage) MessageType() MessageType { return MessageTypeHttpResponse }
@@ -195,6 +359,11 @@ type HttpChunkMessage struct {
 	StreamID uint32 `json:"stream_id"`
 	Chunk    []byte `json:"chunk"`
 	IsFinal  bool   `json:"is_final"`
+
+	// Compressed and OrigLen mirror TcpDataMessage's fields, letting Chunk
+	// travel compressed over the wire.
+	Compressed bool   `json:"compressed,omitempty"`
+	OrigLen    uint32 `json:"orig_len,omitempty"`
 }
 
 func (m *HttpChunkMessage) MessageType() MessageType { return MessageTypeHttpChunk }
@@ -212,6 +381,10 @@ func (m *HttpStreamConnectMessage) MessageType() MessageType { return MessageTyp
 type HttpStreamDataMessage struct {
 	StreamID uint32 `json:"stream_id"`
 	Data     []byte `json:"data"`
+
+	// Compressed and OrigLen mirror TcpDataMessage's fields.
+	Compressed bool   `json:"compressed,omitempty"`
+	OrigLen    uint32 `json:"orig_len,omitempty"`
 }
 
 func (m *HttpStreamDataMessage) MessageType() MessageType { return MessageTypeHttpStreamData }
@@ -222,3 +395,226 @@ type HttpStreamCloseMessage struct {
 }
 
 func (m *HttpStreamCloseMessage) MessageType() MessageType { return MessageTypeHttpStreamClose }
+
+// TlsTermConnectMessage is sent when a new connection arrives on a
+// TLS-terminated TCP tunnel. The relay has already completed the TLS
+// handshake, so this carries peer info for the local app to log instead of
+// a raw ClientHello.
+type TlsTermConnectMessage struct {
+	StreamID         uint32 `json:"stream_id"`
+	RemoteAddr       string `json:"remote_addr"`
+	RemotePort       uint16 `json:"remote_port"`
+	SNI              string `json:"sni"`
+	ALPN             string `json:"alpn,omitempty"`
+	CipherSuite      string `json:"cipher_suite,omitempty"`
+	ClientCertSHA256 string `json:"client_cert_sha256,omitempty"`
+}
+
+func (m *TlsTermConnectMessage) MessageType() MessageType { return MessageTypeTlsTermConnect }
+
+// TlsTermDataMessage carries decrypted TCP data for a TLS-terminated stream.
+type TlsTermDataMessage struct {
+	StreamID uint32 `json:"stream_id"`
+	Data     []byte `json:"data"`
+}
+
+func (m *TlsTermDataMessage) MessageType() MessageType { return MessageTypeTlsTermData }
+
+// TlsTermCloseMessage closes a TLS-terminated TCP stream.
+type TlsTermCloseMessage struct {
+	StreamID uint32 `json:"stream_id"`
+}
+
+func (m *TlsTermCloseMessage) MessageType() MessageType { return MessageTypeTlsTermClose }
+
+// Http3StreamConnectMessage is sent for HTTP/3 stream passthrough, mirroring
+// HttpStreamConnectMessage but for connections negotiated over QUIC.
+type Http3StreamConnectMessage struct {
+	StreamID    uint32 `json:"stream_id"`
+	Host        string `json:"host"`
+	ALPN        string `json:"alpn"`
+	InitialData []byte `json:"initial_data"`
+}
+
+func (m *Http3StreamConnectMessage) MessageType() MessageType { return MessageTypeHttp3StreamConnect }
+
+// Http3StreamDataMessage carries HTTP/3 stream data.
+type Http3StreamDataMessage struct {
+	StreamID uint32 `json:"stream_id"`
+	Data     []byte `json:"data"`
+}
+
+func (m *Http3StreamDataMessage) MessageType() MessageType { return MessageTypeHttp3StreamData }
+
+// Http3StreamCloseMessage closes an HTTP/3 stream.
+type Http3StreamCloseMessage struct {
+	StreamID uint32 `json:"stream_id"`
+}
+
+func (m *Http3StreamCloseMessage) MessageType() MessageType { return MessageTypeHttp3StreamClose }
+
+// QuicDatagramMessage carries an unreliable QUIC datagram associated with an
+// HTTP/3 tunnel, used for WebTransport sessions that don't map onto a
+// reliable stream.
+type QuicDatagramMessage struct {
+	StreamID uint32 `json:"stream_id"`
+	Data     []byte `json:"data"`
+}
+
+func (m *QuicDatagramMessage) MessageType() MessageType { return MessageTypeQuicDatagram }
+
+// StreamWindowUpdateMessage grants the peer additional flow-control credit
+// for StreamID, or for the connection as a whole when StreamID is 0
+// (ControlStreamID). Sent as data is consumed off a stream's receive
+// buffer; see streamFlowControl's windowing doc comment in flowcontrol.go.
+type StreamWindowUpdateMessage struct {
+	StreamID uint32 `json:"stream_id"`
+	Delta    uint32 `json:"delta"`
+}
+
+func (m *StreamWindowUpdateMessage) MessageType() MessageType {
+	return MessageTypeStreamWindowUpdate
+}
+
+// StreamResetMessage abruptly terminates a multiplexed stream, e.g. when a
+// local write fails after the peer has already been granted window. Unlike
+// the protocol-specific *Close messages, it carries an ErrorCode so the
+// receiving side can distinguish a normal close from an abort.
+type StreamResetMessage struct {
+	StreamID  uint32 `json:"stream_id"`
+	ErrorCode uint32 `json:"error_code"`
+}
+
+func (m *StreamResetMessage) MessageType() MessageType { return MessageTypeStreamReset }
+
+// UdpBindMessage is sent once when the relay's UDP listener starts relaying
+// traffic for a tunnel, before any UdpDatagramMessage. StreamID identifies
+// the stream multiplexing every peer's datagrams; RemoteAddr/RemotePort
+// describe the public listener (for logging, since UDP has no single
+// "remote" the way a TCP accept does).
+type UdpBindMessage struct {
+	StreamID   uint32 `json:"stream_id"`
+	RemoteAddr string `json:"remote_addr"`
+	RemotePort uint16 `json:"remote_port"`
+}
+
+func (m *UdpBindMessage) MessageType() MessageType { return MessageTypeUdpBind }
+
+// UdpDatagramMessage carries one UDP datagram in either direction. PeerAddr
+// and PeerPort identify the originating (relay->agent) or destination
+// (agent->relay) public client, since UDP is connectionless and many peers
+// share the one StreamID.
+type UdpDatagramMessage struct {
+	StreamID uint32 `json:"stream_id"`
+	PeerAddr string `json:"peer_addr"`
+	PeerPort uint16 `json:"peer_port"`
+	Data     []byte `json:"data"`
+}
+
+func (m *UdpDatagramMessage) MessageType() MessageType { return MessageTypeUdpDatagram }
+
+// UdpCloseMessage ends a UDP tunnel's stream, closing every peer session
+// multiplexed onto it.
+type UdpCloseMessage struct {
+	StreamID uint32 `json:"stream_id"`
+}
+
+func (m *UdpCloseMessage) MessageType() MessageType { return MessageTypeUdpClose }
+
+// HttpRequestHeadersMessage opens a streaming HTTP request (see
+// Tunnel.handleHTTPRequestStream): it carries everything HttpRequestMessage
+// does except Body, which instead follows as a sequence of
+// HttpBodyChunkMessage frames terminated by HttpEndMessage.
+type HttpRequestHeadersMessage struct {
+	StreamID uint32            `json:"stream_id"`
+	Method   string            `json:"method"`
+	URI      string            `json:"uri"`
+	Headers  map[string]string `json:"headers"`
+
+	// ContentLength mirrors http.Request.ContentLength: the known body size,
+	// or -1 when unknown (e.g. a chunked request), in which case the body
+	// ends with HttpEndMessage rather than a fixed number of bytes.
+	ContentLength int64 `json:"content_length"`
+
+	// HeaderBlock mirrors HttpRequestMessage.HeaderBlock.
+	HeaderBlock []byte `json:"header_block,omitempty"`
+}
+
+func (m *HttpRequestHeadersMessage) MessageType() MessageType {
+	return MessageTypeHttpRequestHeaders
+}
+
+// HttpResponseHeadersMessage opens a streaming HTTP response, the reply to
+// HttpRequestHeadersMessage. Tunnel.handleHTTPRequestStream sends it as soon
+// as the upstream http.Client.Do call returns, before the response body has
+// been read at all, so the caller doesn't have to wait for
+// resp.ContentLength == -1 responses (chunked, SSE, long-polling) to finish.
+type HttpResponseHeadersMessage struct {
+	StreamID uint32            `json:"stream_id"`
+	Status   uint16            `json:"status"`
+	Headers  map[string]string `json:"headers"`
+
+	// ContentLength mirrors http.Response.ContentLength; -1 means the body
+	// ends with HttpEndMessage rather than a fixed number of bytes.
+	ContentLength int64 `json:"content_length"`
+
+	// HeaderBlock mirrors HttpRequestMessage.HeaderBlock.
+	HeaderBlock []byte `json:"header_block,omitempty"`
+}
+
+func (m *HttpResponseHeadersMessage) MessageType() MessageType {
+	return MessageTypeHttpResponseHeaders
+}
+
+// HttpBodyChunkMessage carries one chunk of a streaming HTTP request or
+// response body opened by HttpRequestHeadersMessage/
+// HttpResponseHeadersMessage. Which body it belongs to is implied by which
+// side sent it and where in the exchange it arrives, the same way TCP/TLS
+// data messages don't need to say which direction they flow.
+type HttpBodyChunkMessage struct {
+	StreamID uint32 `json:"stream_id"`
+	Data     []byte `json:"data"`
+
+	// Compressed and OrigLen mirror TcpDataMessage's fields.
+	Compressed bool   `json:"compressed,omitempty"`
+	OrigLen    uint32 `json:"orig_len,omitempty"`
+}
+
+func (m *HttpBodyChunkMessage) MessageType() MessageType { return MessageTypeHttpBodyChunk }
+
+// HttpTrailersMessage carries HTTP trailers for a streaming request or
+// response, e.g. populated from http.Response.Trailer once the body has been
+// read to EOF. When sent, it always comes right before HttpEndMessage.
+type HttpTrailersMessage struct {
+	StreamID uint32            `json:"stream_id"`
+	Trailers map[string]string `json:"trailers"`
+}
+
+func (m *HttpTrailersMessage) MessageType() MessageType { return MessageTypeHttpTrailers }
+
+// HttpEndMessage closes the request or response body started by
+// HttpRequestHeadersMessage/HttpResponseHeadersMessage, the streaming
+// equivalent of HttpChunkMessage.IsFinal.
+type HttpEndMessage struct {
+	StreamID uint32 `json:"stream_id"`
+}
+
+func (m *HttpEndMessage) MessageType() MessageType { return MessageTypeHttpEnd }
+
+// CertUpdateMessage delivers a TLS keypair the acme package obtained for a
+// ProtocolHTTPS tunnel's custom Domain, so the relay can start (or keep)
+// terminating that domain with it. The TLSALPN01 challenge that earns the
+// keypair travels over the existing TlsConnect/TlsData/TlsClose passthrough
+// messages like any other ProtocolTLS connection, since the relay must not
+// terminate TLS for "acme-tls/1" ALPN connections; CertUpdateMessage only
+// carries the end result. CertPEM and KeyPEM are both nil to tell the relay
+// Domain no longer has a usable cert (e.g. a renewal failed after the
+// previous cert already expired).
+type CertUpdateMessage struct {
+	TunnelID string `json:"localup_id"`
+	Domain   string `json:"domain"`
+	CertPEM  []byte `json:"cert_pem,omitempty"`
+	KeyPEM   []byte `json:"key_pem,omitempty"`
+}
+
+func (m *CertUpdateMessage) MessageType() MessageType { return MessageTypeCertUpdate }
@@ -0,0 +1,146 @@
+package localup
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// handshakeLatencyBuckets are the upper bounds, in seconds, of the
+// handshake-latency histogram Metrics.recordHandshake feeds. The range
+// spans a fast same-region QUIC handshake (tens of milliseconds) to a slow
+// cross-region TCP/TLS fallback (several seconds).
+var handshakeLatencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics accumulates the counters and histograms behind Agent.Collector():
+// stream counts, bytes transferred, handshake latency, and reconnect
+// attempts. It's updated from the same call sites that notify Observer, so
+// enabling it costs nothing beyond the atomic increments Observer wiring
+// already pays for.
+type Metrics struct {
+	streamsOpened     atomic.Uint64
+	streamsClosed     atomic.Uint64
+	bytesIn           atomic.Uint64
+	bytesOut          atomic.Uint64
+	reconnectAttempts atomic.Uint64
+
+	handshake *histogram
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{handshake: newHistogram(handshakeLatencyBuckets)}
+}
+
+func (m *Metrics) recordStreamOpened() {
+	m.streamsOpened.Add(1)
+}
+
+func (m *Metrics) recordStreamClosed(bytesIn, bytesOut uint64) {
+	m.streamsClosed.Add(1)
+	m.bytesIn.Add(bytesIn)
+	m.bytesOut.Add(bytesOut)
+}
+
+func (m *Metrics) recordReconnectAttempt() {
+	m.reconnectAttempts.Add(1)
+}
+
+func (m *Metrics) recordHandshake(d time.Duration) {
+	m.handshake.observe(d.Seconds())
+}
+
+// histogram is a minimal cumulative bucketed histogram, the same shape
+// Prometheus client libraries expose, built by hand so Metrics doesn't pull
+// in a dependency just to count handshake latencies.
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64 // upper bounds, ascending
+	counts  []uint64  // counts[i] = observations <= buckets[i]
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum += v
+	h.count++
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+func (h *histogram) snapshot() (buckets []float64, counts []uint64, sum float64, count uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]float64(nil), h.buckets...), append([]uint64(nil), h.counts...), h.sum, h.count
+}
+
+// MetricsCollector is the Prometheus-compatible value returned by
+// Agent.Collector(). Rather than depending on client_golang just to satisfy
+// its prometheus.Collector interface, WriteTo renders the same counters and
+// histogram directly as Prometheus text exposition format (see
+// https://prometheus.io/docs/instrumenting/exposition_formats/), so a
+// program already serving its own /metrics endpoint can write the bytes
+// through as-is.
+type MetricsCollector struct {
+	metrics *Metrics
+}
+
+// WriteTo renders every counter and histogram as Prometheus text exposition
+// format and writes it to w, returning the number of bytes written.
+func (c *MetricsCollector) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	write := func(format string, args ...interface{}) error {
+		n, err := fmt.Fprintf(w, format, args...)
+		total += int64(n)
+		return err
+	}
+
+	counters := []struct {
+		name  string
+		value uint64
+	}{
+		{"localup_streams_opened_total", c.metrics.streamsOpened.Load()},
+		{"localup_streams_closed_total", c.metrics.streamsClosed.Load()},
+		{"localup_bytes_in_total", c.metrics.bytesIn.Load()},
+		{"localup_bytes_out_total", c.metrics.bytesOut.Load()},
+		{"localup_reconnect_attempts_total", c.metrics.reconnectAttempts.Load()},
+	}
+	for _, ctr := range counters {
+		if err := write("# TYPE %s counter\n%s %d\n", ctr.name, ctr.name, ctr.value); err != nil {
+			return total, err
+		}
+	}
+
+	buckets, counts, sum, count := c.metrics.handshake.snapshot()
+	if err := write("# TYPE localup_handshake_latency_seconds histogram\n"); err != nil {
+		return total, err
+	}
+	for i, bound := range buckets {
+		le := strconv.FormatFloat(bound, 'f', -1, 64)
+		if err := write("localup_handshake_latency_seconds_bucket{le=%q} %d\n", le, counts[i]); err != nil {
+			return total, err
+		}
+	}
+	if err := write("localup_handshake_latency_seconds_bucket{le=\"+Inf\"} %d\n", count); err != nil {
+		return total, err
+	}
+	if err := write("localup_handshake_latency_seconds_sum %s\n", strconv.FormatFloat(sum, 'f', -1, 64)); err != nil {
+		return total, err
+	}
+	if err := write("localup_handshake_latency_seconds_count %d\n", count); err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
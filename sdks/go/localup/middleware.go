@@ -0,0 +1,46 @@
+package localup
+
+import "context"
+
+// RequestHandler produces the HttpResponseMessage for a decoded
+// HttpRequestMessage, the terminal value in a Middleware chain.
+// t.forwarder.forward (or a Handler.HTTP-backed equivalent) is wrapped as
+// the innermost RequestHandler.
+type RequestHandler func(ctx context.Context, req *HttpRequestMessage) (*HttpResponseMessage, error)
+
+// Middleware wraps a RequestHandler with cross-cutting behavior -- header
+// injection (e.g. CF-Access-*-style auth), request logging, per-client-IP
+// rate limiting, response body rewriting, mocking -- without forking
+// httpForwarder. Middleware sees the fully decoded request (decompressed
+// body and headers) and the response before it's compressed/encoded back
+// onto the stream. Register with WithMiddleware; middleware run in
+// registration order, each wrapping the next, with the last registered
+// closest to the final forward/Handler call.
+type Middleware func(next RequestHandler) RequestHandler
+
+// chainMiddleware wraps base with mws in registration order, so mws[0] sees
+// the request first and mws[len(mws)-1] runs immediately before base.
+func chainMiddleware(base RequestHandler, mws []Middleware) RequestHandler {
+	h := base
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// ConnMiddleware wraps a ConnHandler for TCP/TLS/TLS-terminated passthrough
+// streams, the L4 equivalent of Middleware, e.g. to log connections or rate
+// limit by remote address before any bytes reach the local service or a
+// Handler.Conn. Register with WithConnMiddleware; middleware run in
+// registration order, each wrapping the next.
+type ConnMiddleware func(next ConnHandler) ConnHandler
+
+// chainConnMiddleware wraps base with mws in registration order, mirroring
+// chainMiddleware.
+func chainConnMiddleware(base ConnHandler, mws []ConnMiddleware) ConnHandler {
+	h := base
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
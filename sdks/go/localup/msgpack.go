@@ -0,0 +1,174 @@
+package localup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MsgpackWireFormat is a WireFormat implementation encoding TunnelMessages as
+// MessagePack instead of bincode, for relays that can't speak the Rust
+// bincode layout. It serializes the same wireValue tree as
+// ProtobufWireFormat (see wirevalue.go); the two formats differ only in
+// their tag/length encoding.
+//
+// To keep the encoder simple, every value is written using MessagePack's
+// widest tag for its kind (uint 64, bin 32, str 32, array 32) regardless of
+// its actual magnitude; this is valid per the MessagePack spec (decoders
+// must accept any encoding of the correct value) at the cost of a few extra
+// bytes on the wire.
+type MsgpackWireFormat struct{}
+
+// NewMsgpackWireFormat constructs the MessagePack wire format.
+func NewMsgpackWireFormat() *MsgpackWireFormat {
+	return &MsgpackWireFormat{}
+}
+
+// Name implements WireFormat.
+func (f *MsgpackWireFormat) Name() string { return "msgpack" }
+
+// EncodeMessage implements WireFormat.
+func (f *MsgpackWireFormat) EncodeMessage(msg TunnelMessage) ([]byte, error) {
+	env, err := messageToValue(msg)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	msgpackEncodeValue(buf, env)
+	return framePayload(buf.Bytes()), nil
+}
+
+// DecodeMessage implements WireFormat.
+func (f *MsgpackWireFormat) DecodeMessage(r io.Reader) (TunnelMessage, error) {
+	payload, err := readFramedPayload(r)
+	if err != nil {
+		return nil, err
+	}
+	return f.DecodeMessageBytes(payload)
+}
+
+// DecodeMessageBytes implements WireFormat.
+func (f *MsgpackWireFormat) DecodeMessageBytes(data []byte) (TunnelMessage, error) {
+	env, rest, err := msgpackDecodeValue(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode msgpack message: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("trailing bytes after msgpack message")
+	}
+	return valueToMessage(env)
+}
+
+const (
+	mpNil     byte = 0xc0
+	mpFalse   byte = 0xc2
+	mpTrue    byte = 0xc3
+	mpBin32   byte = 0xc6
+	mpUint64  byte = 0xcf
+	mpStr32   byte = 0xdb
+	mpArray32 byte = 0xdd
+)
+
+func msgpackEncodeValue(buf *bytes.Buffer, v wireValue) {
+	switch v.kind {
+	case wireNil:
+		buf.WriteByte(mpNil)
+	case wireBool:
+		if v.b {
+			buf.WriteByte(mpTrue)
+		} else {
+			buf.WriteByte(mpFalse)
+		}
+	case wireUint:
+		buf.WriteByte(mpUint64)
+		var lenBuf [8]byte
+		binary.BigEndian.PutUint64(lenBuf[:], v.u)
+		buf.Write(lenBuf[:])
+	case wireBytes:
+		buf.WriteByte(mpBin32)
+		var lenBuf [4]byte
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(v.bs)))
+		buf.Write(lenBuf[:])
+		buf.Write(v.bs)
+	case wireString:
+		buf.WriteByte(mpStr32)
+		var lenBuf [4]byte
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(v.s)))
+		buf.Write(lenBuf[:])
+		buf.WriteString(v.s)
+	case wireArray:
+		buf.WriteByte(mpArray32)
+		var lenBuf [4]byte
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(v.items)))
+		buf.Write(lenBuf[:])
+		for _, item := range v.items {
+			msgpackEncodeValue(buf, item)
+		}
+	}
+}
+
+// msgpackDecodeValue decodes one value from the front of data and returns it
+// along with the unconsumed remainder.
+func msgpackDecodeValue(data []byte) (wireValue, []byte, error) {
+	if len(data) < 1 {
+		return wireValue{}, nil, fmt.Errorf("unexpected end of msgpack data")
+	}
+	tag := data[0]
+	data = data[1:]
+
+	switch tag {
+	case mpNil:
+		return vNil(), data, nil
+	case mpFalse:
+		return vBool(false), data, nil
+	case mpTrue:
+		return vBool(true), data, nil
+	case mpUint64:
+		if len(data) < 8 {
+			return wireValue{}, nil, fmt.Errorf("truncated msgpack uint64")
+		}
+		return vUint(binary.BigEndian.Uint64(data[:8])), data[8:], nil
+	case mpBin32:
+		if len(data) < 4 {
+			return wireValue{}, nil, fmt.Errorf("truncated msgpack bin32 length")
+		}
+		n := binary.BigEndian.Uint32(data[:4])
+		data = data[4:]
+		if uint64(n) > uint64(len(data)) {
+			return wireValue{}, nil, fmt.Errorf("truncated msgpack bin32 payload")
+		}
+		bs := make([]byte, n)
+		copy(bs, data[:n])
+		return vBytes(bs), data[n:], nil
+	case mpStr32:
+		if len(data) < 4 {
+			return wireValue{}, nil, fmt.Errorf("truncated msgpack str32 length")
+		}
+		n := binary.BigEndian.Uint32(data[:4])
+		data = data[4:]
+		if uint64(n) > uint64(len(data)) {
+			return wireValue{}, nil, fmt.Errorf("truncated msgpack str32 payload")
+		}
+		return vString(string(data[:n])), data[n:], nil
+	case mpArray32:
+		if len(data) < 4 {
+			return wireValue{}, nil, fmt.Errorf("truncated msgpack array32 length")
+		}
+		n := binary.BigEndian.Uint32(data[:4])
+		data = data[4:]
+		items := make([]wireValue, n)
+		for i := range items {
+			var item wireValue
+			var err error
+			item, data, err = msgpackDecodeValue(data)
+			if err != nil {
+				return wireValue{}, nil, err
+			}
+			items[i] = item
+		}
+		return vArray(items...), data, nil
+	default:
+		return wireValue{}, nil, fmt.Errorf("unknown msgpack tag 0x%02x", tag)
+	}
+}
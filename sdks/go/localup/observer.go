@@ -0,0 +1,65 @@
+package localup
+
+import "time"
+
+// Observer receives structured lifecycle events from an Agent, installed
+// via WithObserver. It's the hook point for operators who want the same
+// connect/disconnect/reconnect/stream visibility mature tunnel daemons
+// expose, without parsing Logger output; see also Agent.Collector for the
+// Prometheus-compatible counterpart that aggregates the same events into
+// metrics instead of calling back per event.
+//
+// Every method may be called concurrently from different goroutines (a
+// stream's Opened/Closed pair fires from its own handler goroutine, while
+// Connect/Disconnect/Reconnecting fire from the tunnel's connect/reconnect
+// loop) and must not block; implementations that need to do real work
+// should hand it off to their own goroutine or channel.
+type Observer interface {
+	// OnConnect fires once a transport connection to the relay succeeds.
+	// connIndex is 0 for a single-connection Agent; a multi-edge Agent (see
+	// WithEdgePool) numbers its concurrent edge connections starting from 0,
+	// and fires OnConnect again with the same connIndex on each successful
+	// reconnect of that edge.
+	OnConnect(protocol TransportProtocol, edgeAddr string, connIndex int)
+
+	// OnDisconnect fires once a transport connection to the relay is lost,
+	// with a short human-readable reason and the triggering error, if any.
+	OnDisconnect(reason string, err error)
+
+	// OnReconnecting fires just before each reconnection attempt's backoff
+	// sleep, mirroring AgentConfig.OnReconnectAttempt.
+	OnReconnecting(attempt int, delay time.Duration)
+
+	// OnTunnelRegistered fires once a tunnel successfully registers (or
+	// re-registers after a reconnect) with the relay.
+	OnTunnelRegistered(tunnelID, url string)
+
+	// OnStreamOpened fires when a tunnel accepts a new data stream, before
+	// its protocol-specific handler runs.
+	OnStreamOpened(streamID uint64)
+
+	// OnStreamClosed fires once a data stream's handler returns, with the
+	// bytes copied in each direction and how long the stream was open.
+	OnStreamClosed(streamID uint64, bytesIn, bytesOut uint64, duration time.Duration)
+}
+
+// WithObserver installs an Observer to receive the Agent's structured
+// lifecycle events. Only one Observer may be installed; wrap your own
+// multi-observer fan-out if more than one needs the events.
+func WithObserver(observer Observer) AgentOption {
+	return func(c *AgentConfig) {
+		c.Observer = observer
+	}
+}
+
+// noopObserver is the default Observer, so call sites never need to nil-check
+// config.Observer before firing an event.
+type noopObserver struct{}
+
+func (noopObserver) OnConnect(protocol TransportProtocol, edgeAddr string, connIndex int) {}
+func (noopObserver) OnDisconnect(reason string, err error)                                {}
+func (noopObserver) OnReconnecting(attempt int, delay time.Duration)                      {}
+func (noopObserver) OnTunnelRegistered(tunnelID, url string)                              {}
+func (noopObserver) OnStreamOpened(streamID uint64)                                       {}
+func (noopObserver) OnStreamClosed(streamID uint64, bytesIn, bytesOut uint64, duration time.Duration) {
+}
@@ -0,0 +1,80 @@
+package localup
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// proxyProtocolV2Signature is the fixed 12-byte signature that starts every
+// PROXY protocol v2 header, per the spec.
+var proxyProtocolV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// BuildPROXYProtocolHeader builds a PROXY protocol header (v1 or v2)
+// describing a connection from srcAddr (the original client) to dstAddr,
+// for a local forwarder to prepend ahead of the bridged TCP bytes so
+// upstream servers (Postgres, Redis, nginx, HAProxy) see the real client
+// address. See WithPROXYProtocol.
+func BuildPROXYProtocolHeader(version int, srcAddr, dstAddr *net.TCPAddr) ([]byte, error) {
+	switch version {
+	case 1:
+		return buildProxyV1Header(srcAddr, dstAddr), nil
+	case 2:
+		return buildProxyV2Header(srcAddr, dstAddr)
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol version: %d", version)
+	}
+}
+
+// buildProxyV1Header builds the human-readable v1 header:
+// "PROXY TCP4 <src> <dst> <srcPort> <dstPort>\r\n"
+func buildProxyV1Header(src, dst *net.TCPAddr) []byte {
+	family := "TCP4"
+	if src.IP.To4() == nil {
+		family = "TCP6"
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, src.IP.String(), dst.IP.String(), src.Port, dst.Port))
+}
+
+// buildProxyV2Header builds the binary v2 header: a 12-byte signature, a
+// version+command byte, a family+protocol byte, a 2-byte big-endian address
+// block length, then the address block itself.
+func buildProxyV2Header(src, dst *net.TCPAddr) ([]byte, error) {
+	var famProto byte
+	var addrBlock []byte
+
+	srcIP4, dstIP4 := src.IP.To4(), dst.IP.To4()
+	switch {
+	case srcIP4 != nil && dstIP4 != nil:
+		famProto = 0x11 // AF_INET, STREAM
+		addrBlock = make([]byte, 12)
+		copy(addrBlock[0:4], srcIP4)
+		copy(addrBlock[4:8], dstIP4)
+		binary.BigEndian.PutUint16(addrBlock[8:10], uint16(src.Port))
+		binary.BigEndian.PutUint16(addrBlock[10:12], uint16(dst.Port))
+	case srcIP4 == nil && dstIP4 == nil:
+		srcIP6, dstIP6 := src.IP.To16(), dst.IP.To16()
+		if srcIP6 == nil || dstIP6 == nil {
+			return nil, fmt.Errorf("invalid source/destination address for PROXY protocol v2")
+		}
+		famProto = 0x21 // AF_INET6, STREAM
+		addrBlock = make([]byte, 36)
+		copy(addrBlock[0:16], srcIP6)
+		copy(addrBlock[16:32], dstIP6)
+		binary.BigEndian.PutUint16(addrBlock[32:34], uint16(src.Port))
+		binary.BigEndian.PutUint16(addrBlock[34:36], uint16(dst.Port))
+	default:
+		return nil, fmt.Errorf("mismatched address families for PROXY protocol v2: src=%s dst=%s", src.IP, dst.IP)
+	}
+
+	header := make([]byte, 0, len(proxyProtocolV2Signature)+4+len(addrBlock))
+	header = append(header, proxyProtocolV2Signature...)
+	header = append(header, 0x21) // version 2, command PROXY
+	header = append(header, famProto)
+	lenBuf := make([]byte, 2)
+	binary.BigEndian.PutUint16(lenBuf, uint16(len(addrBlock)))
+	header = append(header, lenBuf...)
+	header = append(header, addrBlock...)
+
+	return header, nil
+}
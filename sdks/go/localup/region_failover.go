@@ -0,0 +1,413 @@
+package localup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default tuning for multi-region failover. These mirror the timeouts used
+// elsewhere in the package (DefaultRegisterTimeout, DefaultPingInterval).
+const (
+	// DefaultRegionProbeInterval is how often the background monitor
+	// re-probes every configured region once a tunnel is connected.
+	DefaultRegionProbeInterval = 30 * time.Second
+
+	// DefaultRegionConnectTimeout bounds how long the connect path waits
+	// for a ConnectedMessage from a single region before falling back to
+	// the next ranked candidate.
+	DefaultRegionConnectTimeout = 5 * time.Second
+
+	// DefaultRegionRTTFactor is how much worse (as a multiplier) the active
+	// region's RTT must be than the best candidate's before a migration is
+	// considered.
+	DefaultRegionRTTFactor = 1.5
+
+	// DefaultRegionBadStreak is the number of consecutive probe rounds the
+	// active region must stay above DefaultRegionRTTFactor before a soft
+	// migration is triggered.
+	DefaultRegionBadStreak = 3
+
+	// regionEWMAWeight is the smoothing factor applied to each new RTT
+	// sample; lower values react more slowly to transient spikes.
+	regionEWMAWeight = 0.2
+)
+
+// RegionFailoverOption configures the multi-region failover subsystem
+// enabled by WithMultiRegionFailover.
+type RegionFailoverOption func(*regionFailoverConfig)
+
+// WithRegionProbeInterval sets how often connected regions are re-probed.
+func WithRegionProbeInterval(interval time.Duration) RegionFailoverOption {
+	return func(c *regionFailoverConfig) {
+		c.probeInterval = interval
+	}
+}
+
+// WithRegionConnectTimeout sets how long the connect path waits for a
+// region to respond with ConnectedMessage before trying the next candidate.
+func WithRegionConnectTimeout(timeout time.Duration) RegionFailoverOption {
+	return func(c *regionFailoverConfig) {
+		c.connectTimeout = timeout
+	}
+}
+
+// WithRegionRTTFactor sets the RTT-degradation multiplier that triggers a
+// migration consideration.
+func WithRegionRTTFactor(factor float64) RegionFailoverOption {
+	return func(c *regionFailoverConfig) {
+		c.rttFactor = factor
+	}
+}
+
+// WithRegionBadStreak sets how many consecutive bad probe rounds are
+// required before a soft migration is initiated.
+func WithRegionBadStreak(rounds int) RegionFailoverOption {
+	return func(c *regionFailoverConfig) {
+		c.badStreak = rounds
+	}
+}
+
+// regionFailoverConfig holds the tuning knobs for a multi-region failover
+// tunnel, built from WithMultiRegionFailover's options.
+type regionFailoverConfig struct {
+	regions        []string
+	probeInterval  time.Duration
+	connectTimeout time.Duration
+	rttFactor      float64
+	badStreak      int
+}
+
+// WithMultiRegionFailover configures the tunnel to register against the
+// lowest-latency region in regions, continuously re-probing in the
+// background and soft-migrating to a better region when the active one
+// degrades. It sets ExitNodeConfig.Type to "multi_region" with
+// Failover=true.
+func WithMultiRegionFailover(regions []string, opts ...RegionFailoverOption) TunnelOption {
+	cfg := &regionFailoverConfig{
+		regions:        regions,
+		probeInterval:  DefaultRegionProbeInterval,
+		connectTimeout: DefaultRegionConnectTimeout,
+		rttFactor:      DefaultRegionRTTFactor,
+		badStreak:      DefaultRegionBadStreak,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(c *TunnelConfig) {
+		c.regionFailover = cfg
+	}
+}
+
+// regionStats tracks the EWMA round-trip time and recent error count for a
+// single region.
+type regionStats struct {
+	mu         sync.Mutex
+	ewmaRTT    time.Duration
+	errorCount int
+	badStreak  int
+}
+
+func (s *regionStats) recordSuccess(rtt time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ewmaRTT == 0 {
+		s.ewmaRTT = rtt
+	} else {
+		s.ewmaRTT = time.Duration(float64(s.ewmaRTT)*(1-regionEWMAWeight) + float64(rtt)*regionEWMAWeight)
+	}
+	if s.errorCount > 0 {
+		s.errorCount--
+	}
+}
+
+func (s *regionStats) recordError() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorCount++
+}
+
+// score combines latency and recent errors into a single ranking value;
+// lower is better.
+func (s *regionStats) score() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ewmaRTT == 0 && s.errorCount > 0 {
+		// No successful probe yet: rank behind every region that answered.
+		return math.Inf(1)
+	}
+	return float64(s.ewmaRTT) * (1 + float64(s.errorCount)*0.5)
+}
+
+func (s *regionStats) rtt() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ewmaRTT
+}
+
+// regionProber probes a fixed set of regions and ranks them by latency and
+// recent error count, using the existing Ping/Pong control messages to
+// measure round-trip time.
+type regionProber struct {
+	agent *Agent
+	cfg   *regionFailoverConfig
+	mu    sync.Mutex
+	stats map[string]*regionStats
+}
+
+func newRegionProber(agent *Agent, cfg *regionFailoverConfig) *regionProber {
+	stats := make(map[string]*regionStats, len(cfg.regions))
+	for _, r := range cfg.regions {
+		stats[r] = &regionStats{}
+	}
+	return &regionProber{agent: agent, cfg: cfg, stats: stats}
+}
+
+// probeAll opens a lightweight probe connection to every region and records
+// its RTT (or error).
+func (p *regionProber) probeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, region := range p.cfg.regions {
+		region := region
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rtt, err := p.probe(ctx, region)
+			stats := p.stats[region]
+			if err != nil {
+				stats.recordError()
+				return
+			}
+			stats.recordSuccess(rtt)
+		}()
+	}
+	wg.Wait()
+}
+
+// probe opens a short-lived transport to a region, sends a Ping carrying
+// the current timestamp, and measures the round trip until the matching
+// Pong arrives.
+func (p *regionProber) probe(ctx context.Context, region string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.connectTimeout)
+	defer cancel()
+
+	transport, err := p.dialRegion(ctx, region)
+	if err != nil {
+		return 0, err
+	}
+	defer transport.Close()
+
+	stream, err := transport.OpenStream(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+
+	codec := NewMessageCodec()
+	sent := time.Now()
+	ping := &PingMessage{Timestamp: uint64(sent.UnixNano())}
+	data, err := codec.EncodeMessage(ping)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := stream.Write(data); err != nil {
+		return 0, err
+	}
+
+	msg, err := codec.DecodeMessage(stream)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := msg.(*PongMessage); !ok {
+		return 0, fmt.Errorf("unexpected probe response: %T", msg)
+	}
+	return time.Since(sent), nil
+}
+
+// dialRegion opens a transport to the relay endpoint for region. Regional
+// endpoints are resolved by qualifying the configured relay host with the
+// region name, the same convention the relay uses to advertise per-region
+// endpoints in ConnectedMessage.
+func (p *regionProber) dialRegion(ctx context.Context, region string) (Transport, error) {
+	config := *p.agent.config
+	host, port, err := net.SplitHostPort(config.RelayAddr)
+	if err != nil {
+		host = config.RelayAddr
+		port = fmt.Sprintf("%d", DefaultQUICPort)
+	}
+	config.RelayAddr = net.JoinHostPort(region+"."+host, port)
+	return NewQUICTransport(ctx, &config)
+}
+
+// rank returns the configured regions sorted best-to-worst by score.
+func (p *regionProber) rank() []string {
+	ranked := make([]string, len(p.cfg.regions))
+	copy(ranked, p.cfg.regions)
+	sort.Slice(ranked, func(i, j int) bool {
+		return p.stats[ranked[i]].score() < p.stats[ranked[j]].score()
+	})
+	return ranked
+}
+
+// monitor runs until ctx is canceled, periodically re-probing every region
+// and triggering a soft migration via onDegraded when the active region's
+// RTT drifts too far above the best candidate for consecutive rounds.
+func (p *regionProber) monitor(ctx context.Context, activeRegion func() string, onDegraded func(best string)) {
+	ticker := time.NewTicker(p.cfg.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.probeAll(ctx)
+
+		active := activeRegion()
+		ranked := p.rank()
+		if len(ranked) == 0 || ranked[0] == active {
+			if stats, ok := p.stats[active]; ok {
+				stats.mu.Lock()
+				stats.badStreak = 0
+				stats.mu.Unlock()
+			}
+			continue
+		}
+
+		best := ranked[0]
+		activeStats, ok := p.stats[active]
+		bestStats := p.stats[best]
+		if !ok || bestStats.rtt() == 0 {
+			continue
+		}
+
+		degraded := activeStats.rtt() > time.Duration(float64(bestStats.rtt())*p.cfg.rttFactor)
+
+		activeStats.mu.Lock()
+		if degraded {
+			activeStats.badStreak++
+		} else {
+			activeStats.badStreak = 0
+		}
+		streak := activeStats.badStreak
+		activeStats.mu.Unlock()
+
+		if streak >= p.cfg.badStreak {
+			onDegraded(best)
+			activeStats.mu.Lock()
+			activeStats.badStreak = 0
+			activeStats.mu.Unlock()
+		}
+	}
+}
+
+// registerWithFailover probes every configured region, attempts to register
+// against the top-ranked candidate first, and falls back through the
+// remaining ranked regions if a candidate fails to connect or times out.
+// On success it starts a background monitor that soft-migrates the tunnel
+// if a better region emerges.
+func (t *Tunnel) registerWithFailover(ctx context.Context) error {
+	cfg := t.config.regionFailover
+	if len(cfg.regions) == 0 {
+		return errors.New("multi-region failover configured with no regions")
+	}
+
+	prober := newRegionProber(t.agent, cfg)
+	prober.probeAll(ctx)
+	ranked := prober.rank()
+
+	var lastErr error
+	for _, region := range ranked {
+		transport, err := prober.dialRegion(ctx, region)
+		if err != nil {
+			lastErr = fmt.Errorf("region %s: %w", region, err)
+			continue
+		}
+
+		registerCtx, cancel := context.WithTimeout(ctx, cfg.connectTimeout)
+		t.setTransport(transport)
+		err = t.register(registerCtx)
+		cancel()
+		if err != nil {
+			lastErr = fmt.Errorf("region %s: %w", region, err)
+			transport.Close()
+			t.setTransport(nil)
+			continue
+		}
+
+		t.regionMu.Lock()
+		t.activeRegion = region
+		t.regionMu.Unlock()
+		t.prober = prober
+
+		t.agent.config.Logger.Info("registered on region", "region", region)
+		go prober.monitor(t.ctx, t.getActiveRegion, t.migrateRegion)
+		return nil
+	}
+
+	return fmt.Errorf("failed to register on any region: %w", lastErr)
+}
+
+// getActiveRegion returns the region the tunnel is currently registered
+// against.
+func (t *Tunnel) getActiveRegion() string {
+	t.regionMu.Lock()
+	defer t.regionMu.Unlock()
+	return t.activeRegion
+}
+
+// migrateRegion performs a soft migration to a better-ranked region:
+// register a new tunnel against it, wait for ConnectedMessage, swap it in
+// as the active transport, then send Disconnect on the old control stream
+// and close the old transport. Streams still open on the old transport are
+// closed with it; they are not drained first.
+func (t *Tunnel) migrateRegion(best string) {
+	t.agent.config.Logger.Info("soft-migrating region", "from", t.getActiveRegion(), "to", best)
+
+	transport, err := t.prober.dialRegion(t.ctx, best)
+	if err != nil {
+		t.agent.config.Logger.Error("migration dial failed", "region", best, "error", err)
+		return
+	}
+
+	oldTransport := t.transport()
+	oldControlStream := t.controlStream
+
+	registerCtx, cancel := context.WithTimeout(t.ctx, t.config.regionFailover.connectTimeout)
+	t.setTransport(transport)
+	err = t.register(registerCtx)
+	cancel()
+	if err != nil {
+		t.agent.config.Logger.Error("migration register failed", "region", best, "error", err)
+		t.setTransport(oldTransport)
+		t.controlStream = oldControlStream
+		transport.Close()
+		return
+	}
+
+	t.regionMu.Lock()
+	t.activeRegion = best
+	t.regionMu.Unlock()
+
+	t.agent.config.Logger.Info("region migration complete", "region", best, "url", t.url)
+
+	// Disconnect the old region's control stream, then close its transport.
+	if oldControlStream != nil {
+		disconnect := &DisconnectMessage{Reason: "migrating to a lower-latency region"}
+		if data, err := t.codec.EncodeMessage(disconnect); err == nil {
+			oldControlStream.Write(data)
+		}
+		oldControlStream.Close()
+	}
+	if oldTransport != nil {
+		oldTransport.Close()
+	}
+}
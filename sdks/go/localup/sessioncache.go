@@ -0,0 +1,190 @@
+package localup
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SessionCache caches TLS session tickets so QUICTransport can resume a
+// connection (and, with WithZeroRTT, send 0-RTT data) instead of running a
+// full handshake on reconnect. It's exactly the shape crypto/tls itself
+// expects as ClientSessionCache; NewSessionCache and FileSessionCache are
+// the two implementations WithSessionCache installs in practice.
+type SessionCache = tls.ClientSessionCache
+
+// NewSessionCache returns the default in-memory SessionCache, good for the
+// lifetime of one process. Use FileSessionCache to also survive restarts,
+// which matters most for 0-RTT: a fresh process has nothing to resume from
+// until it dials once with an in-memory cache.
+func NewSessionCache() SessionCache {
+	return tls.NewLRUClientSessionCache(DefaultSessionCacheCapacity)
+}
+
+// fileSessionCache keeps its entries in an in-memory map with no capacity
+// bound (unlike NewSessionCache's LRU), persisting every Put to a file so resumption tickets (and the 0-RTT transport parameters bundled
+// into each tls.SessionState) survive process restarts.
+type fileSessionCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]*tls.ClientSessionState
+}
+
+// FileSessionCache returns a SessionCache backed by path, loading any
+// tickets already there and rewriting the file on every Put. A missing file
+// is not an error; the cache just starts empty.
+func FileSessionCache(path string) (SessionCache, error) {
+	c := &fileSessionCache{path: path, entries: make(map[string]*tls.ClientSessionState)}
+	if err := c.load(); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load session cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *fileSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cs, ok := c.entries[sessionKey]
+	return cs, ok
+}
+
+func (c *fileSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cs == nil {
+		delete(c.entries, sessionKey)
+	} else {
+		c.entries[sessionKey] = cs
+	}
+	// Persistence is best-effort: a failed write still leaves this process's
+	// in-memory copy usable for the rest of its lifetime.
+	_ = c.saveLocked()
+}
+
+// load reads every persisted entry back into c.entries. Format: a
+// uint32 entry count, then per entry a length-prefixed session key,
+// resumption ticket, and tls.SessionState.Bytes() blob.
+func (c *fileSessionCache) load() error {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var count uint32
+	if err := binary.Read(f, binary.BigEndian, &count); err != nil {
+		return err
+	}
+
+	for i := uint32(0); i < count; i++ {
+		sessionKey, err := readLengthPrefixed(f)
+		if err != nil {
+			return err
+		}
+		ticket, err := readLengthPrefixed(f)
+		if err != nil {
+			return err
+		}
+		stateBytes, err := readLengthPrefixed(f)
+		if err != nil {
+			return err
+		}
+
+		state, err := tls.ParseSessionState(stateBytes)
+		if err != nil {
+			continue // a corrupt/outdated entry just means a full handshake next time
+		}
+		cs, err := tls.NewResumptionState(ticket, state)
+		if err != nil {
+			continue
+		}
+		c.entries[string(sessionKey)] = cs
+	}
+	return nil
+}
+
+// sessionRecord is one entry's already-serialized form, computed before
+// saveLocked writes anything so the entry count it writes always matches
+// the number of entries that follow it.
+type sessionRecord struct {
+	sessionKey string
+	ticket     []byte
+	stateBytes []byte
+}
+
+// saveLocked rewrites c.path from scratch with every entry in c.entries.
+// Callers must hold c.mu.
+func (c *fileSessionCache) saveLocked() error {
+	// Serialize every entry first and skip the ones that fail, so the
+	// count written below reflects exactly the records that follow it; if
+	// it counted len(c.entries) instead, a skipped entry would make the
+	// file's declared count exceed what's actually there, and load would
+	// hit an early EOF and fail outright instead of degrading gracefully.
+	records := make([]sessionRecord, 0, len(c.entries))
+	for sessionKey, cs := range c.entries {
+		ticket, state, err := cs.ResumptionState()
+		if err != nil {
+			continue
+		}
+		stateBytes, err := state.Bytes()
+		if err != nil {
+			continue
+		}
+		records = append(records, sessionRecord{sessionKey, ticket, stateBytes})
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(c.path), "session-cache-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath) // no-op once the rename below succeeds
+
+	if err := binary.Write(f, binary.BigEndian, uint32(len(records))); err != nil {
+		f.Close()
+		return err
+	}
+	for _, rec := range records {
+		if err := writeLengthPrefixed(f, []byte(rec.sessionKey)); err != nil {
+			f.Close()
+			return err
+		}
+		if err := writeLengthPrefixed(f, rec.ticket); err != nil {
+			f.Close()
+			return err
+		}
+		if err := writeLengthPrefixed(f, rec.stateBytes); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.path)
+}
+
+func readLengthPrefixed(r io.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func writeLengthPrefixed(w io.Writer, data []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
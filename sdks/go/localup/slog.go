@@ -0,0 +1,180 @@
+package localup
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// NewSlogLogger wraps h so it can be used as this SDK's Logger, translating
+// each Debug/Info/Warn/Error(msg, keysAndValues...) call into a slog.Record
+// with properly typed slog.Attr values (see slogAttr) rather than
+// fmt.Sprintf-ing everything to a string.
+func NewSlogLogger(h slog.Handler) Logger {
+	return &slogLogger{handler: h}
+}
+
+// slogLogger adapts a slog.Handler to the Logger interface.
+type slogLogger struct {
+	handler slog.Handler
+}
+
+func (l *slogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.log(slog.LevelDebug, msg, keysAndValues...)
+}
+
+func (l *slogLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.log(slog.LevelInfo, msg, keysAndValues...)
+}
+
+func (l *slogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.log(slog.LevelWarn, msg, keysAndValues...)
+}
+
+func (l *slogLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.log(slog.LevelError, msg, keysAndValues...)
+}
+
+func (l *slogLogger) With(keysAndValues ...interface{}) Logger {
+	return &slogLogger{handler: l.handler.WithAttrs(attrsFromKVs(keysAndValues))}
+}
+
+func (l *slogLogger) log(level slog.Level, msg string, keysAndValues ...interface{}) {
+	ctx := context.Background()
+	if !l.handler.Enabled(ctx, level) {
+		return
+	}
+	r := slog.NewRecord(time.Now(), level, msg, 0)
+	r.AddAttrs(attrsFromKVs(keysAndValues)...)
+	_ = l.handler.Handle(ctx, r)
+}
+
+// attrsFromKVs converts an alternating key/value slice, in the style this
+// SDK's Logger interface has always taken, into slog.Attr values. An element
+// that's already an slog.Attr (slog's own convention for Logger.Info, etc.)
+// is taken as-is instead of being consumed as a key.
+func attrsFromKVs(keysAndValues []interface{}) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(keysAndValues))
+	for i := 0; i < len(keysAndValues); i++ {
+		if a, ok := keysAndValues[i].(slog.Attr); ok {
+			attrs = append(attrs, a)
+			continue
+		}
+		key, _ := keysAndValues[i].(string)
+		if i+1 >= len(keysAndValues) {
+			attrs = append(attrs, slog.String(key, "MISSING"))
+			break
+		}
+		i++
+		attrs = append(attrs, slogAttr(key, keysAndValues[i]))
+	}
+	return attrs
+}
+
+// slogAttr builds the slog.Attr for key/value that best preserves value's
+// type, rather than formatting it to a string immediately.
+func slogAttr(key string, value interface{}) slog.Attr {
+	switch v := value.(type) {
+	case error:
+		return slog.String(key, v.Error())
+	case time.Time:
+		return slog.Time(key, v)
+	case time.Duration:
+		return slog.Duration(key, v)
+	case string:
+		return slog.String(key, v)
+	case bool:
+		return slog.Bool(key, v)
+	case int:
+		return slog.Int(key, v)
+	case int8:
+		return slog.Int(key, int(v))
+	case int16:
+		return slog.Int(key, int(v))
+	case int32:
+		return slog.Int(key, int(v))
+	case int64:
+		return slog.Int64(key, v)
+	case uint:
+		return slog.Uint64(key, uint64(v))
+	case uint8:
+		return slog.Uint64(key, uint64(v))
+	case uint16:
+		return slog.Uint64(key, uint64(v))
+	case uint32:
+		return slog.Uint64(key, uint64(v))
+	case uint64:
+		return slog.Uint64(key, v)
+	case float32:
+		return slog.Float64(key, float64(v))
+	case float64:
+		return slog.Float64(key, v)
+	default:
+		return slog.Any(key, v)
+	}
+}
+
+// SlogHandler adapts l so it can be plugged into an existing slog.Logger
+// tree (e.g. slog.New(localup.SlogHandler(myLogger))), for users who'd
+// rather standardize on slog everywhere than hold a separate Logger.
+func SlogHandler(l Logger) slog.Handler {
+	return &slogHandlerAdapter{logger: l}
+}
+
+// slogHandlerAdapter adapts a Logger to the slog.Handler interface.
+type slogHandlerAdapter struct {
+	logger   Logger
+	prefix   string        // dotted group prefix from WithGroup, e.g. "http.request"
+	boundKVs []interface{} // resolved key/value pairs bound by prior WithAttrs calls
+}
+
+func (h *slogHandlerAdapter) Enabled(context.Context, slog.Level) bool {
+	// Level filtering is the wrapped Logger's job (e.g. stdLogger.level),
+	// same as every other call into it.
+	return true
+}
+
+func (h *slogHandlerAdapter) Handle(_ context.Context, r slog.Record) error {
+	kvs := make([]interface{}, 0, len(h.boundKVs)+2*r.NumAttrs())
+	kvs = append(kvs, h.boundKVs...)
+	r.Attrs(func(a slog.Attr) bool {
+		kvs = append(kvs, h.prefixKey(a.Key), a.Value.Any())
+		return true
+	})
+
+	switch {
+	case r.Level >= slog.LevelError:
+		h.logger.Error(r.Message, kvs...)
+	case r.Level >= slog.LevelWarn:
+		h.logger.Warn(r.Message, kvs...)
+	case r.Level < slog.LevelInfo:
+		h.logger.Debug(r.Message, kvs...)
+	default:
+		h.logger.Info(r.Message, kvs...)
+	}
+	return nil
+}
+
+func (h *slogHandlerAdapter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	kvs := make([]interface{}, 0, len(h.boundKVs)+2*len(attrs))
+	kvs = append(kvs, h.boundKVs...)
+	for _, a := range attrs {
+		kvs = append(kvs, h.prefixKey(a.Key), a.Value.Any())
+	}
+	return &slogHandlerAdapter{logger: h.logger, prefix: h.prefix, boundKVs: kvs}
+}
+
+func (h *slogHandlerAdapter) WithGroup(name string) slog.Handler {
+	prefix := name
+	if h.prefix != "" {
+		prefix = h.prefix + "." + name
+	}
+	return &slogHandlerAdapter{logger: h.logger, prefix: prefix, boundKVs: h.boundKVs}
+}
+
+func (h *slogHandlerAdapter) prefixKey(key string) string {
+	if h.prefix == "" {
+		return key
+	}
+	return h.prefix + "." + key
+}
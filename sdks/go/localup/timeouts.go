@@ -21,4 +21,21 @@ const (
 
 	// DefaultPingTimeout is the timeout waiting for a pong response.
 	DefaultPingTimeout = 5 * time.Second
+
+	// DefaultHTTP3IdleTimeout is the idle timeout for HTTP/3 streams,
+	// matching the default used by quic-go so HTTP/3 passthrough behaves
+	// identically to existing HTTP stream passthrough.
+	DefaultHTTP3IdleTimeout = 300 * time.Second
+
+	// DefaultHTTP3KeepAlive is the keepalive interval for HTTP/3 streams,
+	// consistent with quic-go's recommended keepalive cadence.
+	DefaultHTTP3KeepAlive = 10 * time.Second
+
+	// DefaultQUICRaceTimeout bounds the QUIC dial when Agent.connect races it
+	// against other protocols in WithProtocolFallback: the dial is canceled
+	// once this much time has passed, so a black-holed UDP path can't hold
+	// the race open. Whichever protocol connects first wins, before or after
+	// the timeout. A QUIC dial still running when another protocol wins is
+	// abandoned, not canceled; it finishes or times out on its own.
+	DefaultQUICRaceTimeout = 5 * time.Second
 )
@@ -2,9 +2,79 @@ package localup
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"io"
 )
 
+// ErrDatagramsNotSupported is returned by SendDatagram/ReceiveDatagram on a
+// Transport that has no unreliable datagram channel, either because its
+// underlying protocol doesn't offer one (WebSocketTransport) or because one
+// wasn't negotiated for this connection (see AgentConfig.EnableDatagrams).
+// Callers fall back to a reliable stream instead of treating it as fatal.
+var ErrDatagramsNotSupported = errors.New("localup: transport does not support datagrams")
+
+// ErrStreamReset is the close error a Stream.Read/Write sees once the peer
+// has reset it (HTTP2Stream/WebSocketStream, mirroring an HTTP/2 RST_STREAM),
+// distinguishing an abrupt reset from the ordinary EOF of a peer-closed
+// stream.
+var ErrStreamReset = errors.New("localup: stream reset by peer")
+
+// defaultTLSConfig returns the tls.Config a transport dials the relay with
+// when the caller didn't supply one via WithTLSConfig. It verifies the
+// relay's certificate like any other TLS client would; callers that want to
+// skip verification (e.g. against a self-signed dev relay) do so explicitly
+// with WithTLSConfig(&tls.Config{InsecureSkipVerify: true}), rather than
+// getting it by default. nextProtos, if non-empty, seeds ALPN.
+func defaultTLSConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{NextProtos: nextProtos}
+}
+
+// TransportDialer dials a Transport connection to the relay, given the
+// agent's configuration. QUICTransportDialer, HTTP2TransportDialer and
+// WebSocketTransportDialer are the three built-in implementations; see
+// WithTransport and WithTransportFallback.
+type TransportDialer func(ctx context.Context, config *AgentConfig) (Transport, error)
+
+// TransportProtocol names one of the transport protocols Agent.connect knows
+// how to dial directly, for use with WithTransportProtocol and
+// WithProtocolFallback. Unlike a raw TransportDialer, naming a protocol lets
+// connect apply protocol-specific policy, such as racing TransportProtocolQUIC
+// against a fallback with DefaultQUICRaceTimeout instead of trying it to
+// exhaustion first.
+type TransportProtocol string
+
+const (
+	// TransportProtocolQUIC dials QUICTransport.
+	TransportProtocolQUIC TransportProtocol = "quic"
+
+	// TransportProtocolHTTP2 dials HTTP2Transport, a long-lived TLS/TCP
+	// connection for networks that block or throttle QUIC's UDP traffic.
+	TransportProtocolHTTP2 TransportProtocol = "http2"
+
+	// TransportProtocolWebSocket identifies WebSocketTransport in Observer
+	// events. Not dialable via WithTransportProtocol/WithProtocolFallback
+	// (use WithTransport(WebSocketTransportDialer) instead); it exists here
+	// so transportProtocolOf can name it like the other two.
+	TransportProtocolWebSocket TransportProtocol = "websocket"
+)
+
+// transportProtocolOf identifies which TransportProtocol produced t, for
+// Observer.OnConnect. Returns "" for a Transport type connect doesn't know
+// about (e.g. a caller's own TransportDialer via WithTransport).
+func transportProtocolOf(t Transport) TransportProtocol {
+	switch t.(type) {
+	case *QUICTransport:
+		return TransportProtocolQUIC
+	case *HTTP2Transport:
+		return TransportProtocolHTTP2
+	case *WebSocketTransport:
+		return TransportProtocolWebSocket
+	default:
+		return ""
+	}
+}
+
 // Transport is the interface for a connection to the relay.
 type Transport interface {
 	// OpenStream opens a new bidirectional stream.
@@ -21,6 +91,18 @@ type Transport interface {
 
 	// RemoteAddr returns the remote address.
 	RemoteAddr() string
+
+	// SendDatagram sends data as a single unreliable, unordered datagram,
+	// for transports and connections that support one (see
+	// AgentConfig.EnableDatagrams). Returns ErrDatagramsNotSupported if this
+	// transport has no datagram channel; callers should fall back to a
+	// reliable stream in that case.
+	SendDatagram(data []byte) error
+
+	// ReceiveDatagram blocks until a datagram arrives or ctx is done.
+	// Returns ErrDatagramsNotSupported if this transport has no datagram
+	// channel at all, so callers can stop polling instead of busy-looping.
+	ReceiveDatagram(ctx context.Context) ([]byte, error)
 }
 
 // Stream is a bidirectional stream within a transport.
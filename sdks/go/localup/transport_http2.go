@@ -0,0 +1,593 @@
+package localup
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// ErrHTTP2Closed is returned by HTTP2Transport and HTTP2Stream methods once
+// the underlying connection has been closed.
+var ErrHTTP2Closed = errors.New("localup: http2 transport closed")
+
+// HTTP2TransportDialer dials the relay over a long-lived HTTP/2 connection,
+// for use with WithTransport, WithTransportFallback, WithTransportProtocol,
+// or WithProtocolFallback.
+var HTTP2TransportDialer TransportDialer = func(ctx context.Context, config *AgentConfig) (Transport, error) {
+	config.Logger.Debug("connecting to relay via HTTP/2", "addr", config.RelayAddr)
+
+	transport, err := NewHTTP2Transport(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP/2 connection failed: %w", err)
+	}
+
+	config.Logger.Debug("connected via HTTP/2", "addr", config.RelayAddr)
+	return transport, nil
+}
+
+// HTTP2Transport implements Transport as a fallback for networks that block
+// or throttle the QUIC transport's UDP traffic but allow ordinary outbound
+// HTTPS on DefaultHTTPSPort. A single TLS connection carries real
+// golang.org/x/net/http2 framing (HEADERS/CONTINUATION/DATA/WINDOW_UPDATE/
+// RST_STREAM), with each logical Stream mapped to one HTTP/2 stream:
+// OpenStream sends a HEADERS frame (a client PUSH-like request) to start the
+// stream, Write sends its body as DATA frames, and Close sends a trailing
+// HEADERS frame with END_STREAM set rather than ending on the last DATA
+// frame, mirroring how gRPC closes a bidirectional stream over HTTP/2.
+// AcceptStream is the mirror image: a background reader watches for a
+// HEADERS frame on a stream ID this side hasn't seen (the peer's equivalent
+// open) and queues it, the same way a server push arrives asynchronously.
+//
+// Flow control is per-stream and connection-level, exactly as RFC 7540
+// §6.9 describes: every DATA frame consumes from both windows, and
+// WINDOW_UPDATE frames addressed to the stream (or to stream 0 for the
+// connection) refill them once consumed bytes cross half of the initial
+// window (DefaultStreamWindowSize unless WithHTTP2StreamWindowSize overrides
+// it), the same threshold WebSocketTransport uses.
+type HTTP2Transport struct {
+	conn   net.Conn
+	framer *http2.Framer
+
+	localAddr  string
+	remoteAddr string
+
+	writeMu  sync.Mutex // serializes frame writes to framer
+	hpackEnc *hpack.Encoder
+	hpackBuf bytes.Buffer
+
+	initialWindow uint32 // per-stream and (initial) connection-level window
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	streams      map[uint32]*HTTP2Stream
+	accept       []*HTTP2Stream
+	connSend     uint32 // connection-level send window, refilled by stream-0 WINDOW_UPDATE frames
+	connConsumed uint32 // bytes read off stream buffers since the last connection-level window update
+	closed       bool
+	closeErr     error
+
+	nextStreamID atomic.Uint32
+}
+
+// HTTP2TransportOption configures an HTTP2Transport.
+type HTTP2TransportOption func(*HTTP2Transport)
+
+// WithHTTP2StreamWindowSize overrides DefaultStreamWindowSize for both the
+// per-stream and the connection-level flow-control windows, mirroring
+// WithWebSocketStreamWindowSize.
+func WithHTTP2StreamWindowSize(size uint32) HTTP2TransportOption {
+	return func(t *HTTP2Transport) { t.initialWindow = size }
+}
+
+// NewHTTP2Transport dials the relay's HTTPS endpoint on DefaultHTTPSPort and
+// negotiates a connection speaking raw golang.org/x/net/http2 framing.
+func NewHTTP2Transport(ctx context.Context, config *AgentConfig, opts ...HTTP2TransportOption) (*HTTP2Transport, error) {
+	host, port, err := net.SplitHostPort(config.RelayAddr)
+	if err != nil {
+		// No port in address, use default HTTPS port.
+		host = config.RelayAddr
+		port = fmt.Sprintf("%d", DefaultHTTPSPort)
+	}
+
+	tlsConfig := config.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = defaultTLSConfig()
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{"h2"}
+	}
+
+	dialer := tls.Dialer{Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to relay: %w", err)
+	}
+
+	framer := http2.NewFramer(conn, conn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(DefaultHPACKDynamicTableSize, nil)
+	framer.SetMaxReadFrameSize(MaxFrameSize)
+
+	t := &HTTP2Transport{
+		conn:          conn,
+		framer:        framer,
+		localAddr:     conn.LocalAddr().String(),
+		remoteAddr:    conn.RemoteAddr().String(),
+		streams:       make(map[uint32]*HTTP2Stream),
+		initialWindow: DefaultStreamWindowSize,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.hpackEnc = hpack.NewEncoder(&t.hpackBuf)
+	t.connSend = t.initialWindow
+	t.cond = sync.NewCond(&t.mu)
+	// Client streams are odd-numbered, per RFC 7540 §5.1.1; ControlStreamID
+	// (0) is reserved, so the first stream opened is ID 1.
+	t.nextStreamID.Store(1)
+
+	if err := framer.WriteSettings(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send settings: %w", err)
+	}
+
+	go t.readLoop()
+
+	return t, nil
+}
+
+// OpenStream opens a new HTTP/2 stream by sending a HEADERS frame, the
+// "client PUSH-like request" that starts the logical stream; the relay
+// reads this the same way AcceptStream reads one from us.
+func (t *HTTP2Transport) OpenStream(ctx context.Context) (Stream, error) {
+	t.mu.Lock()
+	if t.closed {
+		err := t.closeErr
+		t.mu.Unlock()
+		if err == nil {
+			err = ErrHTTP2Closed
+		}
+		return nil, err
+	}
+	id := t.nextStreamID.Add(2) - 2
+	st := newHTTP2Stream(t, id)
+	t.streams[id] = st
+	t.mu.Unlock()
+
+	if err := t.writeHeaders(id, false); err != nil {
+		t.removeStream(id)
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	return st, nil
+}
+
+// AcceptStream blocks until the relay opens a new logical stream (its
+// HEADERS frame for a stream ID this side hasn't seen) or the transport
+// closes.
+func (t *HTTP2Transport) AcceptStream(ctx context.Context) (Stream, error) {
+	t.mu.Lock()
+	for len(t.accept) == 0 && !t.closed {
+		t.cond.Wait()
+	}
+	if len(t.accept) == 0 {
+		err := t.closeErr
+		t.mu.Unlock()
+		if err == nil {
+			err = ErrHTTP2Closed
+		}
+		return nil, err
+	}
+	st := t.accept[0]
+	t.accept = t.accept[1:]
+	t.mu.Unlock()
+	return st, nil
+}
+
+// Close closes the underlying connection and every open stream.
+func (t *HTTP2Transport) Close() error {
+	t.closeLocked(ErrHTTP2Closed)
+	return t.conn.Close()
+}
+
+// LocalAddr returns the local address.
+func (t *HTTP2Transport) LocalAddr() string {
+	return t.localAddr
+}
+
+// RemoteAddr returns the remote address.
+func (t *HTTP2Transport) RemoteAddr() string {
+	return t.remoteAddr
+}
+
+// SendDatagram always returns ErrDatagramsNotSupported: HTTP/2 has no
+// unreliable delivery mode, so callers fall back to a reliable HTTP2Stream
+// instead.
+func (t *HTTP2Transport) SendDatagram(data []byte) error {
+	return ErrDatagramsNotSupported
+}
+
+// ReceiveDatagram always returns ErrDatagramsNotSupported; see SendDatagram.
+func (t *HTTP2Transport) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	return nil, ErrDatagramsNotSupported
+}
+
+func (t *HTTP2Transport) closeLocked(err error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	t.closeErr = err
+	streams := make([]*HTTP2Stream, 0, len(t.streams))
+	for _, st := range t.streams {
+		streams = append(streams, st)
+	}
+	t.cond.Broadcast()
+	t.mu.Unlock()
+
+	for _, st := range streams {
+		st.onClose(err)
+	}
+}
+
+// readLoop reads frames off the framer until it errors, dispatching
+// DATA/HEADERS/RST_STREAM/WINDOW_UPDATE frames to their owning HTTP2Stream
+// and registering peer-initiated streams for AcceptStream.
+func (t *HTTP2Transport) readLoop() {
+	for {
+		frame, err := t.framer.ReadFrame()
+		if err != nil {
+			t.closeLocked(err)
+			return
+		}
+
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				t.writeMu.Lock()
+				t.framer.WriteSettingsAck()
+				t.writeMu.Unlock()
+			}
+
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				t.writeMu.Lock()
+				t.framer.WritePing(true, f.Data)
+				t.writeMu.Unlock()
+			}
+
+		case *http2.GoAwayFrame:
+			t.closeLocked(fmt.Errorf("localup: relay sent GOAWAY: %v", f.ErrCode))
+			return
+
+		case *http2.MetaHeadersFrame:
+			st := t.streamOrAccept(f.StreamID)
+			if st != nil && f.StreamEnded() {
+				st.pushEOF(false)
+			}
+
+		case *http2.DataFrame:
+			st := t.lookupStream(f.StreamID)
+			if st == nil {
+				continue
+			}
+			if data := f.Data(); len(data) > 0 {
+				st.pushData(data)
+			}
+			if f.StreamEnded() {
+				st.pushEOF(false)
+			}
+
+		case *http2.RSTStreamFrame:
+			if st := t.lookupStream(f.StreamID); st != nil {
+				st.pushEOF(true)
+			}
+
+		case *http2.WindowUpdateFrame:
+			if f.StreamID == ControlStreamID {
+				t.grantConnWindow(f.Increment)
+			} else if st := t.lookupStream(f.StreamID); st != nil {
+				st.grantSendWindow(f.Increment)
+			}
+		}
+	}
+}
+
+// streamOrAccept returns the existing stream for id, registering a new one
+// and queuing it for AcceptStream if the relay opened it first.
+func (t *HTTP2Transport) streamOrAccept(id uint32) *HTTP2Stream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	st, ok := t.streams[id]
+	if !ok {
+		st = newHTTP2Stream(t, id)
+		t.streams[id] = st
+		t.accept = append(t.accept, st)
+		t.cond.Broadcast()
+	}
+	return st
+}
+
+func (t *HTTP2Transport) lookupStream(id uint32) *HTTP2Stream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.streams[id]
+}
+
+// writeHeaders HPACK-encodes a minimal pseudo-header block against the
+// transport's shared dynamic table and sends it as a HEADERS frame, ending
+// the stream if trailers is set (see HTTP2Stream.Close).
+func (t *HTTP2Transport) writeHeaders(streamID uint32, trailers bool) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	t.hpackBuf.Reset()
+	if !trailers {
+		t.hpackEnc.WriteField(hpack.HeaderField{Name: ":method", Value: "PUSH"})
+	}
+	return t.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: t.hpackBuf.Bytes(),
+		EndStream:     trailers,
+		EndHeaders:    true,
+	})
+}
+
+func (t *HTTP2Transport) writeData(streamID uint32, data []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.framer.WriteData(streamID, false, data)
+}
+
+func (t *HTTP2Transport) writeRSTStream(streamID uint32) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.framer.WriteRSTStream(streamID, http2.ErrCodeCancel)
+}
+
+func (t *HTTP2Transport) writeWindowUpdate(streamID, delta uint32) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.framer.WriteWindowUpdate(streamID, delta)
+}
+
+// removeStream drops a closed stream from the transport.
+func (t *HTTP2Transport) removeStream(id uint32) {
+	t.mu.Lock()
+	delete(t.streams, id)
+	t.mu.Unlock()
+}
+
+// acquireSendWindow blocks until at least one byte is available in both
+// st's window and the connection-level window, then reserves and returns up
+// to n bytes of it from both.
+func (t *HTTP2Transport) acquireSendWindow(st *HTTP2Stream, n int) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for {
+		if t.closed {
+			if t.closeErr != nil {
+				return 0, t.closeErr
+			}
+			return 0, ErrHTTP2Closed
+		}
+		if st.closeErr != nil {
+			return 0, st.closeErr
+		}
+		avail := st.sendWindow
+		if t.connSend < avail {
+			avail = t.connSend
+		}
+		if avail > 0 {
+			grant := n
+			if uint32(grant) > avail {
+				grant = int(avail)
+			}
+			st.sendWindow -= uint32(grant)
+			t.connSend -= uint32(grant)
+			return grant, nil
+		}
+		t.cond.Wait()
+	}
+}
+
+// grantConnWindow refills the connection-level send window by delta, the
+// stream-0 counterpart to HTTP2Stream.grantSendWindow.
+func (t *HTTP2Transport) grantConnWindow(delta uint32) {
+	t.mu.Lock()
+	t.connSend += delta
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// maybeSendConnWindowUpdate emits a stream-0 WINDOW_UPDATE once bytes
+// consumed across every stream on this connection cross half the initial
+// window, the connection-level counterpart to
+// HTTP2Stream.maybeSendWindowUpdate.
+func (t *HTTP2Transport) maybeSendConnWindowUpdate(n uint32) {
+	t.mu.Lock()
+	t.connConsumed += n
+	var delta uint32
+	if t.connConsumed >= t.initialWindow/2 {
+		delta = t.connConsumed
+		t.connConsumed = 0
+	}
+	t.mu.Unlock()
+
+	if delta > 0 {
+		t.writeWindowUpdate(ControlStreamID, delta)
+	}
+}
+
+// HTTP2Stream is one flow-controlled logical stream of an HTTP2Transport.
+// Like QUICStream and WebSocketStream, it implements the package's Stream
+// interface (io.Reader, io.Writer, io.Closer, StreamID, CloseWrite) so it's a
+// drop-in wherever Transport is used.
+type HTTP2Stream struct {
+	transport *HTTP2Transport
+	id        uint32
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	recvBuf  bytes.Buffer
+	recvEOF  bool
+	closeErr error
+	closed   bool
+	consumed uint32
+
+	sendWindow uint32 // guarded by transport.mu, not mu
+}
+
+func newHTTP2Stream(t *HTTP2Transport, id uint32) *HTTP2Stream {
+	st := &HTTP2Stream{transport: t, id: id, sendWindow: t.initialWindow}
+	st.cond = sync.NewCond(&st.mu)
+	return st
+}
+
+// StreamID returns the stream's identifier within the transport.
+func (st *HTTP2Stream) StreamID() uint64 {
+	return uint64(st.id)
+}
+
+// Read blocks until data, EOF, or a reset is available.
+func (st *HTTP2Stream) Read(p []byte) (int, error) {
+	st.mu.Lock()
+	for st.recvBuf.Len() == 0 && !st.recvEOF && st.closeErr == nil {
+		st.cond.Wait()
+	}
+	if st.recvBuf.Len() == 0 {
+		if st.closeErr != nil {
+			err := st.closeErr
+			st.mu.Unlock()
+			return 0, err
+		}
+		st.mu.Unlock()
+		return 0, io.EOF
+	}
+	n, _ := st.recvBuf.Read(p)
+	st.mu.Unlock()
+
+	st.maybeSendWindowUpdate(uint32(n))
+	st.transport.maybeSendConnWindowUpdate(uint32(n))
+	return n, nil
+}
+
+// Write splits p into DATA frames no larger than the remaining send window,
+// blocking between frames until WINDOW_UPDATE frames refill it.
+func (st *HTTP2Stream) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		n, err := st.transport.acquireSendWindow(st, len(p))
+		if err != nil {
+			return total, err
+		}
+		if err := st.transport.writeData(st.id, p[:n]); err != nil {
+			return total, err
+		}
+		total += n
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close sends a trailing HEADERS frame with END_STREAM set, the gRPC-style
+// trailer block that ends the logical stream, removes it from the
+// transport, and unblocks any pending Read/Write with io.EOF/ErrHTTP2Closed.
+func (st *HTTP2Stream) Close() error {
+	st.mu.Lock()
+	if st.closed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.closed = true
+	st.mu.Unlock()
+
+	err := st.transport.writeHeaders(st.id, true)
+	st.transport.removeStream(st.id)
+	st.onClose(io.EOF)
+	return err
+}
+
+// CloseWrite signals that this side is done sending via a trailing HEADERS
+// frame with END_STREAM set; the read side stays open until the peer sends
+// its own.
+func (st *HTTP2Stream) CloseWrite() error {
+	return st.transport.writeHeaders(st.id, true)
+}
+
+func (st *HTTP2Stream) pushData(data []byte) {
+	st.mu.Lock()
+	st.recvBuf.Write(data)
+	st.cond.Broadcast()
+	st.mu.Unlock()
+}
+
+func (st *HTTP2Stream) pushEOF(reset bool) {
+	st.mu.Lock()
+	if reset {
+		if st.closeErr == nil {
+			st.closeErr = ErrStreamReset
+		}
+	} else {
+		st.recvEOF = true
+	}
+	st.cond.Broadcast()
+	st.mu.Unlock()
+}
+
+func (st *HTTP2Stream) grantSendWindow(delta uint32) {
+	st.transport.mu.Lock()
+	st.sendWindow += delta
+	st.transport.cond.Broadcast()
+	st.transport.mu.Unlock()
+}
+
+// onClose marks the stream as closed/reset with err and wakes any blocked
+// Read/Write, taking transport.mu before mu like acquireSendWindow does so
+// the two never nest in the opposite order.
+func (st *HTTP2Stream) onClose(err error) {
+	st.transport.mu.Lock()
+	st.mu.Lock()
+	if st.closeErr == nil {
+		st.closeErr = err
+	}
+	st.mu.Unlock()
+	st.transport.cond.Broadcast()
+	st.transport.mu.Unlock()
+	st.cond.Broadcast()
+}
+
+// maybeSendWindowUpdate emits a WINDOW_UPDATE once consumed bytes cross half
+// the initial window.
+func (st *HTTP2Stream) maybeSendWindowUpdate(n uint32) {
+	st.mu.Lock()
+	st.consumed += n
+	var delta uint32
+	if st.consumed >= st.transport.initialWindow/2 {
+		delta = st.consumed
+		st.consumed = 0
+	}
+	st.mu.Unlock()
+
+	if delta > 0 {
+		st.transport.writeWindowUpdate(st.id, delta)
+	}
+}
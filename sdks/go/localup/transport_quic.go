@@ -2,18 +2,40 @@ package localup
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/quic-go/quic-go/qlog"
 )
 
+// QUICTransportDialer dials the relay over QUIC, for use with WithTransport
+// or WithTransportFallback. It's the default transport an Agent uses.
+var QUICTransportDialer TransportDialer = func(ctx context.Context, config *AgentConfig) (Transport, error) {
+	config.Logger.Debug("connecting to relay via QUIC", "addr", config.RelayAddr)
+
+	transport, err := NewQUICTransport(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("QUIC connection failed: %w", err)
+	}
+
+	config.Logger.Debug("connected via QUIC", "addr", config.RelayAddr)
+	return transport, nil
+}
+
 // QUICTransport implements Transport using QUIC.
 type QUICTransport struct {
 	conn       quic.Connection
 	localAddr  string
 	remoteAddr string
+
+	// handshakeComplete is closed once the TLS handshake finishes; for a
+	// non-0-RTT connection it's already closed by the time NewQUICTransport
+	// returns. See HandshakeComplete.
+	handshakeComplete <-chan struct{}
 }
 
 // NewQUICTransport creates a new QUIC transport to the relay.
@@ -43,10 +65,7 @@ func NewQUICTransport(ctx context.Context, config *AgentConfig) (*QUICTransport,
 	// TLS configuration
 	tlsConfig := config.TLSConfig
 	if tlsConfig == nil {
-		tlsConfig = &tls.Config{
-			InsecureSkipVerify: true, // TODO: proper certificate verification
-			NextProtos:         []string{"localup-v1"},
-		}
+		tlsConfig = defaultTLSConfig("localup-v1")
 	} else {
 		// Clone and set ALPN
 		tlsConfig = tlsConfig.Clone()
@@ -60,23 +79,64 @@ func NewQUICTransport(ctx context.Context, config *AgentConfig) (*QUICTransport,
 		tlsConfig.ServerName = host
 	}
 
+	if config.TLSKeyLogWriter != nil {
+		tlsConfig.KeyLogWriter = config.TLSKeyLogWriter
+	}
+	if config.SessionCache != nil {
+		tlsConfig.ClientSessionCache = config.SessionCache
+	}
+
 	// QUIC configuration
 	quicConfig := &quic.Config{
 		MaxIdleTimeout:  DefaultIdleTimeout,
 		KeepAlivePeriod: DefaultKeepAlive,
+		EnableDatagrams: config.EnableDatagrams,
+		Allow0RTT:       config.EnableZeroRTT,
 	}
 
-	// Dial the relay
-	conn, err := quic.Dial(ctx, udpConn, udpAddr, tlsConfig, quicConfig)
-	if err != nil {
-		udpConn.Close()
-		return nil, fmt.Errorf("failed to connect to relay: %w", err)
+	if config.QLogDir != "" {
+		qlogDir := config.QLogDir
+		quicConfig.Tracer = func(_ context.Context, p logging.Perspective, connID quic.ConnectionID) *logging.ConnectionTracer {
+			f, err := os.Create(filepath.Join(qlogDir, fmt.Sprintf("client-%s.qlog", connID)))
+			if err != nil {
+				config.Logger.Warn("failed to create qlog file", "dir", qlogDir, "error", err)
+				return nil
+			}
+			return qlog.NewConnectionTracer(f, p, connID)
+		}
+	}
+
+	// Dial the relay. With EnableZeroRTT, DialEarly returns as soon as a
+	// resumed session lets us send 0-RTT data, before the handshake
+	// finishes; HandshakeComplete tells callers when it's safe to send
+	// anything non-idempotent (see Tunnel.register).
+	var conn quic.Connection
+	var handshakeComplete <-chan struct{}
+	if config.EnableZeroRTT {
+		earlyConn, err := quic.DialEarly(ctx, udpConn, udpAddr, tlsConfig, quicConfig)
+		if err != nil {
+			udpConn.Close()
+			return nil, fmt.Errorf("failed to connect to relay: %w", err)
+		}
+		conn = earlyConn
+		handshakeComplete = earlyConn.HandshakeComplete()
+	} else {
+		c, err := quic.Dial(ctx, udpConn, udpAddr, tlsConfig, quicConfig)
+		if err != nil {
+			udpConn.Close()
+			return nil, fmt.Errorf("failed to connect to relay: %w", err)
+		}
+		conn = c
+		closed := make(chan struct{})
+		close(closed)
+		handshakeComplete = closed
 	}
 
 	return &QUICTransport{
-		conn:       conn,
-		localAddr:  udpConn.LocalAddr().String(),
-		remoteAddr: addr,
+		conn:              conn,
+		localAddr:         udpConn.LocalAddr().String(),
+		remoteAddr:        addr,
+		handshakeComplete: handshakeComplete,
 	}, nil
 }
 
@@ -113,6 +173,63 @@ func (t *QUICTransport) RemoteAddr() string {
 	return t.remoteAddr
 }
 
+// SendDatagram sends data as an unreliable QUIC datagram (RFC 9221). Returns
+// ErrDatagramsNotSupported if the peer didn't negotiate datagram support or
+// AgentConfig.EnableDatagrams wasn't set on this side.
+func (t *QUICTransport) SendDatagram(data []byte) error {
+	if !t.conn.ConnectionState().SupportsDatagrams {
+		return ErrDatagramsNotSupported
+	}
+	return t.conn.SendDatagram(data)
+}
+
+// ReceiveDatagram blocks until a datagram arrives or ctx is done. Returns
+// ErrDatagramsNotSupported if datagrams weren't negotiated for this
+// connection, so callers can stop polling instead of busy-looping.
+func (t *QUICTransport) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	if !t.conn.ConnectionState().SupportsDatagrams {
+		return nil, ErrDatagramsNotSupported
+	}
+	return t.conn.ReceiveDatagram(ctx)
+}
+
+// QUICConnectionState surfaces the handshake details QUICTransport.
+// ConnectionState exposes, for diagnosing MTU/path/version issues in the
+// field without reaching into quic-go's own types.
+type QUICConnectionState struct {
+	// ALPN is the application-layer protocol negotiated during the TLS
+	// handshake (e.g. "localup-v1").
+	ALPN string
+
+	// Version is the QUIC version this connection settled on.
+	Version quic.Version
+
+	// Used0RTT reports whether this connection resumed with a 0-RTT
+	// session ticket instead of a full handshake.
+	Used0RTT bool
+}
+
+// HandshakeComplete returns a channel that's closed once the TLS handshake
+// finishes (immediately, if this connection wasn't dialed with
+// WithZeroRTT). Anything non-idempotent sent over this transport before the
+// handshake completes rides 0-RTT keys and may be replayed or rejected by
+// the peer if resumption fails; callers like Tunnel.register wait on this
+// before sending their registration payload.
+func (t *QUICTransport) HandshakeComplete() <-chan struct{} {
+	return t.handshakeComplete
+}
+
+// ConnectionState returns the negotiated ALPN, QUIC version, and 0-RTT
+// status for this connection.
+func (t *QUICTransport) ConnectionState() QUICConnectionState {
+	state := t.conn.ConnectionState()
+	return QUICConnectionState{
+		ALPN:     state.TLS.NegotiatedProtocol,
+		Version:  state.Version,
+		Used0RTT: state.Used0RTT,
+	}
+}
+
 // QUICStream wraps a QUIC stream.
 type QUICStream struct {
 	stream quic.Stream
@@ -0,0 +1,636 @@
+package localup
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/http2/hpack"
+)
+
+// ErrWebSocketClosed is returned by WebSocketTransport and WebSocketStream
+// methods once the underlying connection has been closed.
+var ErrWebSocketClosed = errors.New("localup: websocket transport closed")
+
+// WebSocketTransportDialer dials the relay over wss://, for use with
+// WithTransport or WithTransportFallback.
+var WebSocketTransportDialer TransportDialer = func(ctx context.Context, config *AgentConfig) (Transport, error) {
+	config.Logger.Debug("connecting to relay via WebSocket", "addr", config.RelayAddr)
+
+	transport, err := NewWebSocketTransport(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("WebSocket connection failed: %w", err)
+	}
+
+	config.Logger.Debug("connected via WebSocket", "addr", config.RelayAddr)
+	return transport, nil
+}
+
+// WebSocketTransport implements Transport as a fallback for networks that
+// block the QUIC transport's UDP traffic on DefaultQUICPort (corporate
+// proxies, hotel Wi-Fi, some cloud egress rules) but allow ordinary outbound
+// HTTPS. A single wss:// connection to DefaultWebSocketPort stands in for
+// QUIC's native stream multiplexing: logical streams are multiplexed over it
+// using the FrameHeaderSize-prefixed frames (stream_id + type + flags +
+// length) and FrameType*/FrameFlag* constants declared in constants.go, each
+// frame carried as one WebSocket binary message. Everything above the
+// Transport interface — handshake, stream IDs, control messages — is
+// byte-identical to the QUIC path, so Tunnel doesn't need to know which
+// transport it's using.
+//
+// Flow control is credit-based and two-level: each WebSocketStream has its
+// own send window (initialWindow bytes), and there
+// is a matching connection-level window shared by all streams, refilled by
+// FrameTypeWindowUpdate frames addressed to ConnectionWindowStreamID. A
+// single slow stream can still only hold back the connection's share of
+// bytes the peer has acknowledged room for, not the other streams sharing
+// this one WebSocket connection.
+type WebSocketTransport struct {
+	conn *websocket.Conn
+
+	localAddr  string
+	remoteAddr string
+
+	initialWindow uint32 // per-stream and (initial) connection-level window
+	headerCodec   *HeaderFrameCodec
+
+	writeMu sync.Mutex // serializes frame writes to conn
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	streams      map[uint32]*WebSocketStream
+	accept       []*WebSocketStream
+	connSend     uint32 // connection-level send window, refilled by ConnectionWindowStreamID updates
+	connConsumed uint32 // bytes read off stream buffers since the last connection-level window update
+	closed       bool
+	closeErr     error
+
+	nextStreamID atomic.Uint32
+}
+
+// WebSocketTransportOption configures a WebSocketTransport.
+type WebSocketTransportOption func(*WebSocketTransport)
+
+// WithWebSocketStreamWindowSize overrides DefaultStreamWindowSize for both
+// the per-stream and the connection-level flow-control windows.
+func WithWebSocketStreamWindowSize(size uint32) WebSocketTransportOption {
+	return func(t *WebSocketTransport) { t.initialWindow = size }
+}
+
+// NewWebSocketTransport dials the relay's wss://<relay>/tunnel endpoint.
+func NewWebSocketTransport(ctx context.Context, config *AgentConfig, opts ...WebSocketTransportOption) (*WebSocketTransport, error) {
+	host, port, err := net.SplitHostPort(config.RelayAddr)
+	if err != nil {
+		// No port in address, use default WebSocket port.
+		host = config.RelayAddr
+		port = fmt.Sprintf("%d", DefaultWebSocketPort)
+	}
+
+	tlsConfig := config.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = defaultTLSConfig()
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+
+	endpoint := url.URL{Scheme: "wss", Host: net.JoinHostPort(host, port), Path: "/tunnel"}
+
+	dialer := websocket.Dialer{
+		TLSClientConfig:  tlsConfig,
+		HandshakeTimeout: DefaultConnectTimeout,
+	}
+	conn, _, err := dialer.DialContext(ctx, endpoint.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to relay: %w", err)
+	}
+
+	t := &WebSocketTransport{
+		conn:          conn,
+		localAddr:     conn.LocalAddr().String(),
+		remoteAddr:    conn.RemoteAddr().String(),
+		streams:       make(map[uint32]*WebSocketStream),
+		initialWindow: DefaultStreamWindowSize,
+		headerCodec:   NewHeaderFrameCodec(),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.connSend = t.initialWindow
+	t.cond = sync.NewCond(&t.mu)
+
+	go t.readLoop()
+
+	return t, nil
+}
+
+// OpenStream opens a new multiplexed stream, identified by the next
+// sequential stream ID (0 for the first call on a fresh transport, matching
+// ControlStreamID for the tunnel's control stream).
+func (t *WebSocketTransport) OpenStream(ctx context.Context) (Stream, error) {
+	t.mu.Lock()
+	if t.closed {
+		err := t.closeErr
+		t.mu.Unlock()
+		if err == nil {
+			err = ErrWebSocketClosed
+		}
+		return nil, err
+	}
+	id := t.nextStreamID.Add(1) - 1
+	st := newWebSocketStream(t, id)
+	t.streams[id] = st
+	t.mu.Unlock()
+	return st, nil
+}
+
+// AcceptStream blocks until the relay opens a new logical stream (its first
+// frame for a stream ID this side hasn't seen) or the transport closes.
+func (t *WebSocketTransport) AcceptStream(ctx context.Context) (Stream, error) {
+	t.mu.Lock()
+	for len(t.accept) == 0 && !t.closed {
+		t.cond.Wait()
+	}
+	if len(t.accept) == 0 {
+		err := t.closeErr
+		t.mu.Unlock()
+		if err == nil {
+			err = ErrWebSocketClosed
+		}
+		return nil, err
+	}
+	st := t.accept[0]
+	t.accept = t.accept[1:]
+	t.mu.Unlock()
+	return st, nil
+}
+
+// Close closes the underlying connection and every open stream.
+func (t *WebSocketTransport) Close() error {
+	t.closeLocked(ErrWebSocketClosed)
+	return t.conn.Close()
+}
+
+// LocalAddr returns the local address.
+func (t *WebSocketTransport) LocalAddr() string {
+	return t.localAddr
+}
+
+// RemoteAddr returns the remote address.
+func (t *WebSocketTransport) RemoteAddr() string {
+	return t.remoteAddr
+}
+
+// SendDatagram always returns ErrDatagramsNotSupported: a WebSocket
+// connection has no unreliable delivery mode, so callers fall back to a
+// reliable WebSocketStream instead.
+func (t *WebSocketTransport) SendDatagram(data []byte) error {
+	return ErrDatagramsNotSupported
+}
+
+// ReceiveDatagram always returns ErrDatagramsNotSupported; see SendDatagram.
+func (t *WebSocketTransport) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	return nil, ErrDatagramsNotSupported
+}
+
+func (t *WebSocketTransport) closeLocked(err error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	t.closeErr = err
+	streams := make([]*WebSocketStream, 0, len(t.streams))
+	for _, st := range t.streams {
+		streams = append(streams, st)
+	}
+	t.cond.Broadcast()
+	t.mu.Unlock()
+
+	for _, st := range streams {
+		st.onClose(err)
+	}
+}
+
+// readLoop reads frames off conn until it errors, dispatching Data/Close/
+// WindowUpdate frames to their owning WebSocketStream and registering
+// relay-initiated streams for AcceptStream.
+func (t *WebSocketTransport) readLoop() {
+	for {
+		_, data, err := t.conn.ReadMessage()
+		if err != nil {
+			t.closeLocked(err)
+			return
+		}
+		if len(data) < FrameHeaderSize {
+			continue
+		}
+
+		streamID := binary.BigEndian.Uint32(data[0:4])
+		frameType := data[4]
+		flags := data[5]
+		length := binary.BigEndian.Uint32(data[6:10])
+		payload := data[FrameHeaderSize:]
+		if uint32(len(payload)) < length {
+			continue
+		}
+		payload = payload[:length]
+
+		if streamID == ConnectionWindowStreamID {
+			if frameType == FrameTypeWindowUpdate && len(payload) >= 4 {
+				t.grantConnWindow(binary.BigEndian.Uint32(payload))
+			}
+			continue
+		}
+
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			return
+		}
+		st, ok := t.streams[streamID]
+		if !ok {
+			st = newWebSocketStream(t, streamID)
+			t.streams[streamID] = st
+			t.accept = append(t.accept, st)
+			t.cond.Broadcast()
+		}
+		t.mu.Unlock()
+
+		switch frameType {
+		case FrameTypeControl, FrameTypeData:
+			st.pushData(payload)
+		case FrameTypeClose:
+			st.pushEOF(flags&FrameFlagRst != 0)
+		case FrameTypeWindowUpdate:
+			if len(payload) >= 4 {
+				st.grantSendWindow(binary.BigEndian.Uint32(payload))
+			}
+		case FrameTypeHeaders, FrameTypeContinuation:
+			st.pushHeaderFragment(payload, frameType == FrameTypeHeaders, flags&FrameFlagFin != 0)
+		}
+	}
+}
+
+// writeFrame writes a single frame as one WebSocket binary message,
+// serialized against concurrent writers since every WebSocketStream shares
+// the one underlying connection.
+func (t *WebSocketTransport) writeFrame(streamID uint32, frameType, flags uint8, payload []byte) error {
+	frame := make([]byte, FrameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], streamID)
+	frame[4] = frameType
+	frame[5] = flags
+	binary.BigEndian.PutUint32(frame[6:10], uint32(len(payload)))
+	copy(frame[FrameHeaderSize:], payload)
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+// removeStream drops a closed stream from the transport.
+func (t *WebSocketTransport) removeStream(id uint32) {
+	t.mu.Lock()
+	delete(t.streams, id)
+	t.mu.Unlock()
+}
+
+// acquireSendWindow blocks until at least one byte is available in both
+// st's window and the connection-level window, then reserves and returns up
+// to n bytes of it from both.
+func (t *WebSocketTransport) acquireSendWindow(st *WebSocketStream, n int) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for {
+		if t.closed {
+			if t.closeErr != nil {
+				return 0, t.closeErr
+			}
+			return 0, ErrWebSocketClosed
+		}
+		if st.closeErr != nil {
+			return 0, st.closeErr
+		}
+		avail := st.sendWindow
+		if t.connSend < avail {
+			avail = t.connSend
+		}
+		if avail > 0 {
+			grant := n
+			if uint32(grant) > avail {
+				grant = int(avail)
+			}
+			st.sendWindow -= uint32(grant)
+			t.connSend -= uint32(grant)
+			return grant, nil
+		}
+		t.cond.Wait()
+	}
+}
+
+// grantConnWindow refills the connection-level send window by delta, the
+// ConnectionWindowStreamID counterpart to WebSocketStream.grantSendWindow.
+func (t *WebSocketTransport) grantConnWindow(delta uint32) {
+	t.mu.Lock()
+	t.connSend += delta
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// maybeSendConnWindowUpdate emits a FrameTypeWindowUpdate addressed to
+// ConnectionWindowStreamID once bytes consumed across every stream on this
+// connection cross half the initial window, the connection-level
+// counterpart to WebSocketStream.maybeSendWindowUpdate.
+func (t *WebSocketTransport) maybeSendConnWindowUpdate(n uint32) {
+	t.mu.Lock()
+	t.connConsumed += n
+	var delta uint32
+	if t.connConsumed >= t.initialWindow/2 {
+		delta = t.connConsumed
+		t.connConsumed = 0
+	}
+	t.mu.Unlock()
+
+	if delta > 0 {
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, delta)
+		t.writeFrame(ConnectionWindowStreamID, FrameTypeWindowUpdate, 0, payload)
+	}
+}
+
+// WebSocketStream is one flow-controlled logical stream of a
+// WebSocketTransport. It implements the package's Stream interface
+// (io.Reader, io.Writer, io.Closer, StreamID, CloseWrite) so it's a
+// drop-in for QUICStream wherever Transport is used. Flow control exists so
+// that a slow reader on one logical stream can't block every other stream
+// sharing the one underlying WebSocket connection; FrameTypeWindowUpdate
+// refills it once consumed bytes cross half the initial window, both for
+// this stream and (via WebSocketTransport.maybeSendConnWindowUpdate) for
+// the connection as a whole.
+//
+// WriteHeaders/ReadHeaders are an optional extra on top of the plain
+// Stream interface: a caller holding a concrete *WebSocketStream (rather
+// than just the Stream interface) can send/receive an HPACK-compressed
+// header block as FrameTypeHeaders/FrameTypeContinuation frames instead of
+// folding it into the ordinary byte stream. See HeaderFrameCodec.
+type WebSocketStream struct {
+	transport *WebSocketTransport
+	id        uint32
+
+	mu            sync.Mutex
+	cond          *sync.Cond
+	recvBuf       bytes.Buffer
+	recvEOF       bool
+	closeErr      error
+	closed        bool
+	consumed      uint32
+	headerFrags   [][]byte
+	headerResults []headerFrameResult
+
+	sendWindow uint32 // guarded by transport.mu, not mu
+}
+
+// headerFrameResult is one completed, HPACK-decoded header block delivered
+// by WebSocketTransport.readLoop to a WebSocketStream's ReadHeaders.
+type headerFrameResult struct {
+	fields []hpack.HeaderField
+	err    error
+}
+
+func newWebSocketStream(t *WebSocketTransport, id uint32) *WebSocketStream {
+	st := &WebSocketStream{transport: t, id: id, sendWindow: t.initialWindow}
+	st.cond = sync.NewCond(&st.mu)
+	return st
+}
+
+// StreamID returns the stream's identifier within the transport.
+func (st *WebSocketStream) StreamID() uint64 {
+	return uint64(st.id)
+}
+
+// Read blocks until data, EOF, or a reset is available.
+func (st *WebSocketStream) Read(p []byte) (int, error) {
+	st.mu.Lock()
+	for st.recvBuf.Len() == 0 && !st.recvEOF && st.closeErr == nil {
+		st.cond.Wait()
+	}
+	if st.recvBuf.Len() == 0 {
+		if st.closeErr != nil {
+			err := st.closeErr
+			st.mu.Unlock()
+			return 0, err
+		}
+		st.mu.Unlock()
+		return 0, io.EOF
+	}
+	n, _ := st.recvBuf.Read(p)
+	st.mu.Unlock()
+
+	st.maybeSendWindowUpdate(uint32(n))
+	st.transport.maybeSendConnWindowUpdate(uint32(n))
+	return n, nil
+}
+
+// WriteHeaders HPACK-encodes fields against the transport's per-connection
+// dynamic table (see HeaderFrameCodec) and sends them as a FrameTypeHeaders
+// frame followed by any FrameTypeContinuation frames needed to stay under
+// MaxFrameSize, flagging the last one FrameFlagFin.
+func (st *WebSocketStream) WriteHeaders(fields []hpack.HeaderField) error {
+	t := st.transport
+	// Hold writeMu from encoding through the last frame, so header blocks
+	// reach the wire in the order they were encoded against the shared
+	// table and no other frame lands between a block's frames.
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	frames, err := t.headerCodec.EncodeHeaderFrames(fields)
+	if err != nil {
+		return err
+	}
+	for i, frame := range frames {
+		frameType := FrameTypeHeaders
+		if i > 0 {
+			frameType = FrameTypeContinuation
+		}
+		var flags uint8
+		if i == len(frames)-1 {
+			flags = FrameFlagFin
+		}
+		buf := make([]byte, FrameHeaderSize+len(frame))
+		binary.BigEndian.PutUint32(buf[0:4], st.id)
+		buf[4] = frameType
+		buf[5] = flags
+		binary.BigEndian.PutUint32(buf[6:10], uint32(len(frame)))
+		copy(buf[FrameHeaderSize:], frame)
+		if err := t.conn.WriteMessage(websocket.BinaryMessage, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadHeaders blocks until a complete FrameTypeHeaders/FrameTypeContinuation
+// block has arrived for this stream and returns its HPACK-decoded fields.
+func (st *WebSocketStream) ReadHeaders() ([]hpack.HeaderField, error) {
+	st.mu.Lock()
+	for len(st.headerResults) == 0 && !st.recvEOF && st.closeErr == nil && !st.closed {
+		st.cond.Wait()
+	}
+	if len(st.headerResults) == 0 {
+		err := st.closeErr
+		st.mu.Unlock()
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	res := st.headerResults[0]
+	st.headerResults = st.headerResults[1:]
+	st.mu.Unlock()
+	return res.fields, res.err
+}
+
+// pushHeaderFragment accumulates one FrameTypeHeaders/FrameTypeContinuation
+// payload and, once fin is set, HPACK-decodes the reassembled block and
+// queues it for ReadHeaders.
+func (st *WebSocketStream) pushHeaderFragment(payload []byte, first, fin bool) {
+	st.mu.Lock()
+	if first {
+		st.headerFrags = st.headerFrags[:0]
+	}
+	st.headerFrags = append(st.headerFrags, payload)
+	var frags [][]byte
+	if fin {
+		frags = st.headerFrags
+		st.headerFrags = nil
+	}
+	st.mu.Unlock()
+
+	if frags == nil {
+		return
+	}
+	fields, err := st.transport.headerCodec.DecodeHeaderFrames(frags)
+
+	st.mu.Lock()
+	st.headerResults = append(st.headerResults, headerFrameResult{fields: fields, err: err})
+	st.cond.Broadcast()
+	st.mu.Unlock()
+}
+
+// Write splits p into frames no larger than the remaining send window,
+// blocking between frames until FrameTypeWindowUpdate frames refill it.
+func (st *WebSocketStream) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		n, err := st.transport.acquireSendWindow(st, len(p))
+		if err != nil {
+			return total, err
+		}
+
+		frameType := uint8(FrameTypeData)
+		if st.id == ControlStreamID {
+			frameType = FrameTypeControl
+		}
+		if err := st.transport.writeFrame(st.id, frameType, 0, p[:n]); err != nil {
+			return total, err
+		}
+		total += n
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close sends a clean FrameTypeClose, removes the stream from the
+// transport, and unblocks any pending Read/Write with io.EOF/ErrWebSocketClosed.
+func (st *WebSocketStream) Close() error {
+	st.mu.Lock()
+	if st.closed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.closed = true
+	st.mu.Unlock()
+
+	err := st.transport.writeFrame(st.id, FrameTypeClose, 0, nil)
+	st.transport.removeStream(st.id)
+	st.onClose(io.EOF)
+	return err
+}
+
+// CloseWrite signals that this side is done sending via a clean
+// FrameTypeClose; the read side stays open until the peer sends its own.
+func (st *WebSocketStream) CloseWrite() error {
+	return st.transport.writeFrame(st.id, FrameTypeClose, 0, nil)
+}
+
+func (st *WebSocketStream) pushData(data []byte) {
+	st.mu.Lock()
+	st.recvBuf.Write(data)
+	st.cond.Broadcast()
+	st.mu.Unlock()
+}
+
+func (st *WebSocketStream) pushEOF(reset bool) {
+	st.mu.Lock()
+	if reset {
+		if st.closeErr == nil {
+			st.closeErr = ErrStreamReset
+		}
+	} else {
+		st.recvEOF = true
+	}
+	st.cond.Broadcast()
+	st.mu.Unlock()
+}
+
+func (st *WebSocketStream) grantSendWindow(delta uint32) {
+	st.transport.mu.Lock()
+	st.sendWindow += delta
+	st.transport.cond.Broadcast()
+	st.transport.mu.Unlock()
+}
+
+// onClose marks the stream as closed/reset with err and wakes any blocked
+// Read/Write, taking transport.mu before mu like acquireSendWindow does so
+// the two never nest in the opposite order.
+func (st *WebSocketStream) onClose(err error) {
+	st.transport.mu.Lock()
+	st.mu.Lock()
+	if st.closeErr == nil {
+		st.closeErr = err
+	}
+	st.mu.Unlock()
+	st.transport.cond.Broadcast()
+	st.transport.mu.Unlock()
+	st.cond.Broadcast()
+}
+
+// maybeSendWindowUpdate emits a FrameTypeWindowUpdate once consumed bytes
+// cross half the initial window.
+func (st *WebSocketStream) maybeSendWindowUpdate(n uint32) {
+	st.mu.Lock()
+	st.consumed += n
+	var delta uint32
+	if st.consumed >= st.transport.initialWindow/2 {
+		delta = st.consumed
+		st.consumed = 0
+	}
+	st.mu.Unlock()
+
+	if delta > 0 {
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, delta)
+		st.transport.writeFrame(st.id, FrameTypeWindowUpdate, 0, payload)
+	}
+}
@@ -2,8 +2,11 @@ package localup
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
@@ -23,7 +26,14 @@ type Tunnel struct {
 
 	// Control stream (Stream 0)
 	controlStream Stream
-	codec         *MessageCodec
+	codec         WireFormat
+
+	// poolControlStreams holds the non-primary control streams opened by
+	// registerPool when t.transport() is an *EdgePool: every healthy edge
+	// besides the one backing controlStream, kept open only so the relay
+	// keeps treating their edges as registered for this tunnel. Closed
+	// alongside controlStream in Close.
+	poolControlStreams []Stream
 
 	// State
 	ctx       context.Context
@@ -32,10 +42,14 @@ type Tunnel struct {
 	closeOnce sync.Once
 	closed    atomic.Bool
 
-	// Stream management
-	streams   map[uint32]Stream
+	// Stream management. streams holds every data stream currently being
+	// handled, keyed by Stream.StreamID(); acceptStreams registers one
+	// before spawning its handler goroutine, refusing (closing the stream
+	// outright instead) once len(streams) would exceed maxConcurrentStreams,
+	// and the handler unregisters it when done. Close uses it to close any
+	// still-open stream on shutdown.
+	streams   map[uint64]Stream
 	streamsMu sync.RWMutex
-	nextID    atomic.Uint32
 
 	// Handlers
 	forwarder *httpForwarder
@@ -44,9 +58,84 @@ type Tunnel struct {
 	bytesIn  atomic.Uint64
 	bytesOut atomic.Uint64
 
-	// Reconnection state
+	// Reconnection state. reconnectCount is an atomic.Int32 rather than a
+	// plain int because resetTimer's AfterFunc callback can fire and zero it
+	// concurrently with a new reconnect() call. resetTimer itself is only
+	// ever touched from within reconnect(), which reconnecting serializes.
 	reconnecting   atomic.Bool
-	reconnectCount int
+	reconnectCount atomic.Int32
+	resetTimer     *time.Timer
+
+	// Multi-region failover state (see region_failover.go). regionTransport
+	// is this tunnel's own dedicated connection, separate from (and never
+	// stored in) agent.transport: regionTransportMu guards it because
+	// registerWithFailover/migrateRegion swap it in from one goroutine
+	// (the background prober.monitor call in registerWithFailover) while
+	// acceptStreams, handleDatagrams and reconnect read it every loop
+	// iteration from tunnel.run's goroutines. Sharing agent.transport here
+	// would race with, and corrupt, every other tunnel on the same Agent.
+	regionMu          sync.Mutex
+	activeRegion      string
+	prober            *regionProber
+	regionTransportMu sync.RWMutex
+	regionTransport   Transport
+
+	// Compression state (see compression.go). compressionVal holds the
+	// algorithm the relay chose in ConnectedMessage.ChosenCompression,
+	// accessed via setCompression/getCompression since register() can
+	// rewrite it from a reconnect while stream goroutines read it
+	// concurrently. compressStats tracks its rolling effectiveness and
+	// auto-disables it.
+	compressionVal atomic.Value // CompressionAlgorithm
+	compressStats  *compressionStats
+
+	// headerCompressionVal is true once both sides have agreed to HPACK
+	// header compression (see hpack.go): we requested it via
+	// TunnelConfigMsg.EnableHeaderCompression and the relay acked it in
+	// ConnectedMessage.HeaderCompressionEnabled. Only read/written through
+	// setHeaderCompression/getHeaderCompression for the same reconnect-vs-
+	// stream-goroutine reason as compressionVal.
+	headerCompressionVal atomic.Bool
+
+	// flowControl bounds in-flight bytes per StreamID (and for the tunnel's
+	// streams as a whole) for copyToStream/copyHttpStreamToRemote/
+	// copyTlsStreamToRemote; see flowcontrol.go and TunnelConfig.StreamWindowSize.
+	flowControl *streamFlowControl
+
+	// udpSessions maps a UDP bind's StreamID to the session table handling
+	// its peers, so handleDatagrams can route a UdpDatagramMessage that
+	// arrived over the transport's unreliable datagram channel (see
+	// AgentConfig.EnableDatagrams) to the same place a reliable one would
+	// have gone. Registered by handleUDPStream, removed when it returns.
+	udpSessionsMu sync.Mutex
+	udpSessions   map[uint32]*udpSessionTable
+}
+
+// setHeaderCompression records whether HPACK header compression was
+// negotiated with the relay.
+func (t *Tunnel) setHeaderCompression(enabled bool) {
+	t.headerCompressionVal.Store(enabled)
+}
+
+// getHeaderCompression reports whether HPACK header compression was
+// negotiated with the relay.
+func (t *Tunnel) getHeaderCompression() bool {
+	return t.headerCompressionVal.Load()
+}
+
+// setCompression stores the negotiated compression algorithm.
+func (t *Tunnel) setCompression(alg CompressionAlgorithm) {
+	t.compressionVal.Store(alg)
+}
+
+// getCompression returns the negotiated compression algorithm, or
+// CompressionNone if none has been negotiated yet.
+func (t *Tunnel) getCompression() CompressionAlgorithm {
+	v := t.compressionVal.Load()
+	if v == nil {
+		return CompressionNone
+	}
+	return v.(CompressionAlgorithm)
 }
 
 // newTunnel creates a new tunnel instance.
@@ -54,24 +143,55 @@ func newTunnel(ctx context.Context, agent *Agent, config *TunnelConfig) *Tunnel
 	tunnelCtx, cancel := context.WithCancel(ctx)
 
 	t := &Tunnel{
-		agent:   agent,
-		config:  config,
-		id:      generateTunnelID(),
-		codec:   NewMessageCodec(),
-		ctx:     tunnelCtx,
-		cancel:  cancel,
-		done:    make(chan struct{}),
-		streams: make(map[uint32]Stream),
-	}
-
-	// Set up HTTP forwarder if upstream is configured
-	if config.Upstream != "" {
+		agent:         agent,
+		config:        config,
+		id:            generateTunnelID(),
+		codec:         NewMessageCodec(),
+		ctx:           tunnelCtx,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+		streams:       make(map[uint64]Stream),
+		compressStats: newCompressionStats(),
+		flowControl:   newStreamFlowControl(config.StreamWindowSize),
+		udpSessions:   make(map[uint32]*udpSessionTable),
+	}
+
+	// Set up HTTP forwarder if an upstream or ingress rules are configured
+	if config.Upstream != "" || len(config.Ingress) > 0 {
 		t.forwarder = newHTTPForwarder(config)
 	}
 
 	return t
 }
 
+// transport returns the connection this tunnel should use: its own
+// dedicated regionTransport for multi-region failover tunnels (see
+// region_failover.go), or the Agent's shared transport for every other
+// tunnel. Always go through this instead of reading agent.transport
+// directly so a region migration on one tunnel never races with another
+// tunnel sharing the same Agent.
+func (t *Tunnel) transport() Transport {
+	if t.config.regionFailover != nil {
+		t.regionTransportMu.RLock()
+		defer t.regionTransportMu.RUnlock()
+		return t.regionTransport
+	}
+	return t.agent.transport
+}
+
+// setTransport installs tr as this tunnel's connection, storing it in
+// regionTransport for multi-region failover tunnels (see transport) or in
+// the shared agent.transport otherwise.
+func (t *Tunnel) setTransport(tr Transport) {
+	if t.config.regionFailover != nil {
+		t.regionTransportMu.Lock()
+		t.regionTransport = tr
+		t.regionTransportMu.Unlock()
+		return
+	}
+	t.agent.transport = tr
+}
+
 // ID returns the tunnel's unique identifier.
 func (t *Tunnel) ID() string {
 	return t.id
@@ -97,6 +217,7 @@ func (t *Tunnel) Close() error {
 	t.closeOnce.Do(func() {
 		t.closed.Store(true)
 		t.cancel()
+		t.flowControl.closeAll()
 
 		// Send disconnect message
 		if t.controlStream != nil {
@@ -106,13 +227,16 @@ func (t *Tunnel) Close() error {
 			}
 			t.controlStream.Close()
 		}
+		for _, stream := range t.poolControlStreams {
+			stream.Close()
+		}
 
 		// Close all data streams
 		t.streamsMu.Lock()
 		for _, stream := range t.streams {
 			stream.Close()
 		}
-		t.streams = make(map[uint32]Stream)
+		t.streams = make(map[uint64]Stream)
 		t.streamsMu.Unlock()
 
 		close(t.done)
@@ -130,18 +254,167 @@ func (t *Tunnel) BytesOut() uint64 {
 	return t.bytesOut.Load()
 }
 
+// ActiveStreams returns the number of data streams currently being handled.
+func (t *Tunnel) ActiveStreams() int {
+	t.streamsMu.RLock()
+	defer t.streamsMu.RUnlock()
+	return len(t.streams)
+}
+
+// maxConcurrentStreams returns the configured (or default) cap on
+// concurrent data streams this tunnel services at once; see
+// TunnelConfig.MaxConcurrentStreams.
+func (t *Tunnel) maxConcurrentStreams() int {
+	if t.config.MaxConcurrentStreams > 0 {
+		return int(t.config.MaxConcurrentStreams)
+	}
+	return DefaultMaxConcurrentStreams
+}
+
+// registerStream adds stream to t.streams under streamID, refusing to do
+// so once that would exceed maxConcurrentStreams, the client-side
+// counterpart to EdgePool.OpenStream's WithEdgeMaxConcurrentStreams guard
+// on the outbound side.
+func (t *Tunnel) registerStream(streamID uint64, stream Stream) bool {
+	t.streamsMu.Lock()
+	defer t.streamsMu.Unlock()
+	if len(t.streams) >= t.maxConcurrentStreams() {
+		return false
+	}
+	t.streams[streamID] = stream
+	return true
+}
+
+// unregisterStream removes streamID from t.streams once its handler
+// returns.
+func (t *Tunnel) unregisterStream(streamID uint64) {
+	t.streamsMu.Lock()
+	delete(t.streams, streamID)
+	t.streamsMu.Unlock()
+}
+
+// SendCertUpdate delivers an ACME-obtained (or renewed) keypair for domain
+// to the relay over the control stream, so it starts or keeps terminating
+// ProtocolHTTPS connections to domain with it. Called by an ACMEManager
+// (see WithACME); certPEM/keyPEM both nil tells the relay domain no longer
+// has a usable cert.
+func (t *Tunnel) SendCertUpdate(domain string, certPEM, keyPEM []byte) error {
+	msg := &CertUpdateMessage{TunnelID: t.id, Domain: domain, CertPEM: certPEM, KeyPEM: keyPEM}
+	data, err := t.codec.EncodeMessage(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode CertUpdate message: %w", err)
+	}
+	if _, err := t.controlStream.Write(data); err != nil {
+		return fmt.Errorf("failed to send CertUpdate message: %w", err)
+	}
+	return nil
+}
+
 // register registers the tunnel with the relay.
 func (t *Tunnel) register(ctx context.Context) error {
 	t.agent.config.Logger.Debug("opening control stream")
 
+	// An EdgePool needs the tunnel registered on every healthy edge, not
+	// just whichever one OpenStream's round-robin would pick, or the relay
+	// has no way to route an incoming stream to the others (see
+	// edgepool.go's WithConnections doc and registerPool below).
+	if pool, ok := t.transport().(*EdgePool); ok {
+		return t.registerPool(ctx, pool)
+	}
+
 	// Open control stream (Stream 0)
-	stream, err := t.agent.transport.OpenStream(ctx)
+	stream, err := t.transport().OpenStream(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to open control stream: %w", err)
 	}
 	t.controlStream = stream
 	t.agent.config.Logger.Debug("control stream opened")
 
+	return t.registerControlStream(ctx, stream, true)
+}
+
+// registerPool replicates tunnel registration across every edge in pool
+// currently considered healthy (see WithConnections/WithEdgePool and
+// EdgePool.OpenControlStreams), so the relay associates the tunnel with all
+// of them and can hand an incoming stream to any edge instead of just the
+// one that happened to carry the first Connect message. The first edge's
+// stream becomes t.controlStream, exactly as for a single-transport tunnel,
+// so Ping/Pong, Disconnect and SendCertUpdate keep working unchanged; the
+// rest are kept open in t.poolControlStreams purely so their edges stay
+// registered, and are closed alongside t.controlStream in Tunnel.Close.
+func (t *Tunnel) registerPool(ctx context.Context, pool *EdgePool) error {
+	streams, err := pool.OpenControlStreams(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open control streams: %w", err)
+	}
+
+	t.controlStream = streams[0]
+	if err := t.registerControlStream(ctx, streams[0], true); err != nil {
+		for _, s := range streams {
+			s.Close()
+		}
+		return err
+	}
+
+	// Reset rather than append: on a reconnect this is called again with a
+	// brand new set of streams, and the previous registration's entries
+	// are already closed (or about to be by the caller) — leaving them in
+	// place would leak them into Close's cleanup loop forever.
+	t.poolControlStreams = nil
+	for _, s := range streams[1:] {
+		if err := t.registerControlStream(ctx, s, false); err != nil {
+			t.agent.config.Logger.Warn("failed to register secondary edge control stream", "error", err)
+			s.Close()
+			continue
+		}
+		t.poolControlStreams = append(t.poolControlStreams, s)
+	}
+	return nil
+}
+
+// registerControlStream negotiates a wire format (primary only) and runs
+// the Connect/Connected handshake on stream. primary is true for the
+// control stream handleControlMessages/SendCertUpdate/Close will actually
+// use afterwards (a single-transport tunnel's only control stream, or an
+// EdgePool's first); it decides the wire format for t.codec and records the
+// relay's response (endpoints, URL, compression) into t. Secondary
+// EdgePool streams (primary false) reuse the codec the primary stream
+// already negotiated — renegotiating per edge risks a different outcome
+// than what every other stream on this tunnel assumes — and their
+// Connected response is discarded beyond confirming the relay accepted the
+// registration.
+func (t *Tunnel) registerControlStream(ctx context.Context, stream Stream, primary bool) error {
+	// Wire-format negotiation carries no secrets and has no side effects on
+	// the relay beyond picking a codec, so it's safe to ride 0-RTT data:
+	// a rejected 0-RTT attempt just means renegotiating identically once
+	// the handshake completes. This is the one real latency win
+	// WithZeroRTT buys a reconnect, since everything below it still waits
+	// on the handshake.
+	if primary && len(t.config.wireFormats) > 0 {
+		format, err := negotiateWireFormat(stream, t.config.wireFormats)
+		if err != nil {
+			return fmt.Errorf("failed to negotiate wire format: %w", err)
+		}
+		t.codec = format
+		t.agent.config.Logger.Debug("negotiated wire format", "format", format.Name())
+	}
+
+	// The Connect message below carries the auth token and creates
+	// server-side tunnel state, so it isn't safe to send on a 0-RTT
+	// connection until the handshake confirms the session actually resumed
+	// (a rejected 0-RTT attempt would otherwise get silently dropped or
+	// replayed). Opening the stream and negotiating a wire format above are
+	// both fine either way, since neither is non-idempotent.
+	if primary {
+		if quicTransport, ok := t.transport().(*QUICTransport); ok {
+			select {
+			case <-quicTransport.HandshakeComplete():
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
 	// Build Connect message
 	protocols := t.buildProtocols()
 	config := t.buildTunnelConfig()
@@ -166,7 +439,7 @@ func (t *Tunnel) register(ctx context.Context) error {
 
 	t.agent.config.Logger.Debug("sending Connect message", "bytes", len(data))
 
-	if _, err := t.controlStream.Write(data); err != nil {
+	if _, err := stream.Write(data); err != nil {
 		return fmt.Errorf("failed to send Connect message: %w", err)
 	}
 
@@ -179,7 +452,7 @@ func (t *Tunnel) register(ctx context.Context) error {
 	t.agent.config.Logger.Debug("waiting for response...")
 
 	// Read response
-	response, err := t.codec.DecodeMessage(t.controlStream)
+	response, err := t.codec.DecodeMessage(stream)
 	if err != nil {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
@@ -188,11 +461,19 @@ func (t *Tunnel) register(ctx context.Context) error {
 
 	switch msg := response.(type) {
 	case *ConnectedMessage:
+		if !primary {
+			return nil
+		}
 		t.endpoints = msg.Endpoints
 		if len(msg.Endpoints) > 0 {
 			t.url = msg.Endpoints[0].URL
 		}
-		t.agent.config.Logger.Info("tunnel connected", "url", t.url, "endpoints", len(t.endpoints))
+		if msg.ChosenCompression != "" {
+			t.setCompression(CompressionAlgorithm(msg.ChosenCompression))
+		}
+		t.setHeaderCompression(t.config.EnableHeaderCompression && msg.HeaderCompressionEnabled)
+		t.agent.config.Logger.Info("tunnel connected", "url", t.url, "endpoints", len(t.endpoints),
+			"compression", t.getCompression(), "header_compression", t.getHeaderCompression())
 		return nil
 
 	case *DisconnectMessage:
@@ -215,6 +496,10 @@ func (t *Tunnel) run(ctx context.Context) {
 			close(controlDone)
 		}()
 
+		// Start the unreliable-datagram receive loop (see handleDatagrams);
+		// it exits immediately on a transport with no datagram support.
+		go t.handleDatagrams(ctx)
+
 		// Accept and handle data streams
 		disconnected := t.acceptStreams(ctx, controlDone)
 
@@ -236,7 +521,14 @@ func (t *Tunnel) run(ctx context.Context) {
 }
 
 // acceptStreams accepts and handles data streams until disconnection.
-// Returns true if disconnected (should attempt reconnect), false if closed intentionally.
+// Returns true if disconnected (should attempt reconnect), false if closed
+// intentionally. When the agent was built with WithEdgePool, transport is
+// an *EdgePool: a failed edge other than the one carrying t.controlStream
+// never surfaces here, since the pool's own background reconnector repairs
+// it while surviving edges keep streams flowing; the accept side returns
+// true only once every edge is down. Losing the edge that carries
+// t.controlStream ends handleControlMessages, and this returns true just
+// as it does for a single transport.
 func (t *Tunnel) acceptStreams(ctx context.Context, controlDone <-chan struct{}) bool {
 	for {
 		select {
@@ -247,26 +539,103 @@ func (t *Tunnel) acceptStreams(ctx context.Context, controlDone <-chan struct{})
 			if t.closed.Load() {
 				return false
 			}
+			t.agent.config.Observer.OnDisconnect("control stream closed", nil)
 			return true
 		default:
 		}
 
-		stream, err := t.agent.transport.AcceptStream(ctx)
+		tr := t.transport()
+		stream, err := tr.AcceptStream(ctx)
 		if err != nil {
 			if t.closed.Load() {
 				return false
 			}
+			if tr != t.transport() {
+				// migrateRegion already swapped in a new transport and
+				// closed this one just to unblock AcceptStream; that's not
+				// a real disconnect, so pick up the new transport instead
+				// of reporting one.
+				continue
+			}
 			// Transport error - likely disconnected
 			t.agent.config.Logger.Error("failed to accept stream", "error", err)
+			t.agent.config.Observer.OnDisconnect("transport stream accept failed", err)
 			return true
 		}
 
+		if !t.registerStream(stream.StreamID(), stream) {
+			t.agent.config.Logger.Warn("rejecting stream: max concurrent streams reached",
+				"stream_id", stream.StreamID(), "max", t.maxConcurrentStreams())
+			stream.Close()
+			continue
+		}
+
 		go t.handleDataStream(ctx, stream)
 	}
 }
 
-// reconnect attempts to reconnect to the relay with exponential backoff.
-// Returns true if reconnection succeeded, false if we should give up.
+// handleDatagrams routes unreliable datagrams received on the transport
+// (see AgentConfig.EnableDatagrams and Transport.ReceiveDatagram) back to
+// the UDP session table they belong to, as an alternative to the reliable
+// stream handleUDPStream normally reads from. Returns as soon as the
+// transport reports it has no datagram channel at all, rather than busy
+// polling a transport that will never produce one.
+func (t *Tunnel) handleDatagrams(ctx context.Context) {
+	for {
+		data, err := t.transport().ReceiveDatagram(ctx)
+		if err != nil {
+			return
+		}
+
+		msg, err := t.codec.DecodeMessageBytes(data)
+		if err != nil {
+			t.agent.config.Logger.Error("failed to decode datagram", "error", err)
+			continue
+		}
+
+		udp, ok := msg.(*UdpDatagramMessage)
+		if !ok {
+			t.agent.config.Logger.Debug("received unexpected datagram", "type", fmt.Sprintf("%T", msg))
+			continue
+		}
+
+		t.udpSessionsMu.Lock()
+		sessions := t.udpSessions[udp.StreamID]
+		t.udpSessionsMu.Unlock()
+		if sessions == nil {
+			continue
+		}
+		sessions.writeToUpstream(udp.PeerAddr, udp.PeerPort, udp.Data)
+	}
+}
+
+// fullJitterBackoff implements AWS's "full jitter" backoff: the delay
+// before attempt n (1-based) is uniformly random in [0, cap), where
+// cap = min(maxDelay, initialDelay * multiplier^(n-1)). Sleeping a random
+// duration up to the cap, rather than always the full cap, keeps many
+// agents that lose the relay at the same moment from retrying in lockstep.
+func fullJitterBackoff(attempt int, initialDelay, maxDelay time.Duration, multiplier float64) time.Duration {
+	if initialDelay <= 0 {
+		initialDelay = time.Second
+	}
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+
+	capDelay := float64(initialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if maxDelay > 0 && capDelay > float64(maxDelay) {
+		capDelay = float64(maxDelay)
+	}
+	if capDelay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(capDelay)))
+}
+
+// reconnect attempts to reconnect to the relay with full-jitter exponential
+// backoff (see fullJitterBackoff). Returns true if reconnection succeeded,
+// false if we should give up.
 func (t *Tunnel) reconnect(ctx context.Context) bool {
 	if !t.reconnecting.CompareAndSwap(false, true) {
 		// Already reconnecting from another goroutine
@@ -274,23 +643,45 @@ func (t *Tunnel) reconnect(ctx context.Context) bool {
 	}
 	defer t.reconnecting.Store(false)
 
+	// The connection just dropped, so cancel any pending "stayed up long
+	// enough" reset: if the relay is flapping, the attempt count should
+	// keep climbing instead of collapsing back to its initial delay every
+	// cycle.
+	if t.resetTimer != nil {
+		t.resetTimer.Stop()
+		t.resetTimer = nil
+	}
+
 	config := t.agent.config
-	delay := config.ReconnectInitialDelay
+	start := time.Now()
 
 	for {
-		t.reconnectCount++
+		attempt := int(t.reconnectCount.Add(1))
 
-		// Check max retries
-		if config.ReconnectMaxRetries > 0 && t.reconnectCount > config.ReconnectMaxRetries {
+		if config.ReconnectMaxRetries > 0 && attempt > config.ReconnectMaxRetries {
 			t.agent.config.Logger.Error("max reconnection attempts reached",
-				"attempts", t.reconnectCount-1,
+				"attempts", attempt-1,
 				"max", config.ReconnectMaxRetries)
 			return false
 		}
+		if config.ReconnectMaxElapsed > 0 && time.Since(start) > config.ReconnectMaxElapsed {
+			t.agent.config.Logger.Error("reconnect time budget exhausted",
+				"attempts", attempt-1,
+				"elapsed", time.Since(start),
+				"maxElapsed", config.ReconnectMaxElapsed)
+			return false
+		}
+
+		delay := fullJitterBackoff(attempt, config.ReconnectInitialDelay, config.ReconnectMaxDelay, config.ReconnectMultiplier)
 
 		t.agent.config.Logger.Info("attempting to reconnect",
-			"attempt", t.reconnectCount,
+			"attempt", attempt,
 			"delay", delay)
+		if config.OnReconnectAttempt != nil {
+			config.OnReconnectAttempt(attempt, delay)
+		}
+		t.agent.metrics.recordReconnectAttempt()
+		config.Observer.OnReconnecting(attempt, delay)
 
 		// Wait before attempting reconnection
 		select {
@@ -300,41 +691,50 @@ func (t *Tunnel) reconnect(ctx context.Context) bool {
 		}
 
 		// Close old transport
-		if t.agent.transport != nil {
-			t.agent.transport.Close()
-			t.agent.transport = nil
+		if old := t.transport(); old != nil {
+			old.Close()
+			t.setTransport(nil)
 		}
 
-		// Attempt to connect
-		transport, err := t.agent.connect(ctx)
+		// A multi-region failover tunnel re-runs the whole probe-and-rank
+		// path instead of dialing the agent's default relay: agent.connect
+		// knows nothing about t.config.regionFailover, so going through it
+		// here would silently reconnect against the default region and
+		// drop failover for good (see registerWithFailover).
+		var err error
+		if t.config.regionFailover != nil {
+			err = t.registerWithFailover(ctx)
+		} else {
+			var transport Transport
+			transport, err = t.agent.connect(ctx)
+			if err == nil {
+				t.setTransport(transport)
+				err = t.register(ctx)
+			}
+		}
 		if err != nil {
 			t.agent.config.Logger.Error("reconnection failed", "error", err)
-
-			// Exponential backoff
-			delay = time.Duration(float64(delay) * config.ReconnectMultiplier)
-			if delay > config.ReconnectMaxDelay {
-				delay = config.ReconnectMaxDelay
+			if config.OnReconnectFailure != nil {
+				config.OnReconnectFailure(attempt, err)
 			}
 			continue
 		}
 
-		t.agent.transport = transport
-
-		// Re-register the tunnel
-		if err := t.register(ctx); err != nil {
-			t.agent.config.Logger.Error("re-registration failed", "error", err)
+		t.agent.config.Logger.Info("reconnected successfully", "url", t.url)
+		if config.OnReconnectSuccess != nil {
+			config.OnReconnectSuccess(attempt)
+		}
 
-			// Exponential backoff
-			delay = time.Duration(float64(delay) * config.ReconnectMultiplier)
-			if delay > config.ReconnectMaxDelay {
-				delay = config.ReconnectMaxDelay
-			}
-			continue
+		// Only reset the attempt count once the connection has proven
+		// stable for ReconnectResetInterval, not immediately.
+		resetInterval := config.ReconnectResetInterval
+		if resetInterval <= 0 {
+			resetInterval = 60 * time.Second
 		}
+		t.resetTimer = time.AfterFunc(resetInterval, func() {
+			t.reconnectCount.Store(0)
+		})
 
-		// Reset reconnect count on success
-		t.reconnectCount = 0
-		t.agent.config.Logger.Info("reconnected successfully", "url", t.url)
 		return true
 	}
 }
@@ -348,11 +748,19 @@ func (t *Tunnel) handleControlMessages(ctx context.Context) {
 		default:
 		}
 
-		msg, err := t.codec.DecodeMessage(t.controlStream)
+		cs := t.controlStream
+		msg, err := t.codec.DecodeMessage(cs)
 		if err != nil {
 			if err == io.EOF || t.closed.Load() {
 				return
 			}
+			if cs != t.controlStream {
+				// migrateRegion already swapped in a new control stream
+				// and closed this one (after writing it a courtesy
+				// Disconnect) just to unblock the read; pick up the new
+				// stream instead of reporting a real disconnect.
+				continue
+			}
 			t.agent.config.Logger.Error("failed to decode control message", "error", err)
 			return
 		}
@@ -384,10 +792,61 @@ func (t *Tunnel) handleControlMessages(ctx context.Context) {
 	}
 }
 
-// handleDataStream handles an incoming data stream.
+// streamLogger returns a Logger scoped to one accepted data stream, binding
+// stream_id, protocol, and remote_addr once so every line an individual
+// stream handler logs carries them automatically instead of repeating them
+// on every call.
+func (t *Tunnel) streamLogger(protocol Protocol, streamID uint32, remoteAddr string) Logger {
+	return t.agent.config.Logger.With("stream_id", streamID, "protocol", protocol, "remote_addr", remoteAddr)
+}
+
+// streamByteCounter accumulates the bytes a single handleDataStream call
+// moves, alongside (not instead of) the tunnel-wide bytesIn/bytesOut
+// atomics those same copy loops already update. handleDataStream reports
+// this counter's totals to Observer.OnStreamClosed/Metrics.recordStreamClosed
+// once the stream ends, instead of diffing the tunnel-wide counters, which
+// would mix in bytes moved by every other stream open on the tunnel at the
+// same time.
+type streamByteCounter struct {
+	in  atomic.Uint64
+	out atomic.Uint64
+}
+
+// addBytesIn records n more bytes decoded off the tunnel and written to the
+// local service, crediting both the tunnel-wide total and counter's
+// per-stream total.
+func (t *Tunnel) addBytesIn(counter *streamByteCounter, n uint64) {
+	t.bytesIn.Add(n)
+	counter.in.Add(n)
+}
+
+// addBytesOut records n more bytes read from the local service and encoded
+// onto the tunnel, crediting both the tunnel-wide total and counter's
+// per-stream total.
+func (t *Tunnel) addBytesOut(counter *streamByteCounter, n uint64) {
+	t.bytesOut.Add(n)
+	counter.out.Add(n)
+}
+
+// handleDataStream handles an incoming data stream. Observer.OnStreamOpened/
+// OnStreamClosed bracket the whole call, reporting this stream's own
+// streamByteCounter totals rather than a delta of the tunnel-wide counters.
 func (t *Tunnel) handleDataStream(ctx context.Context, stream Stream) {
 	defer stream.Close()
 
+	streamID := stream.StreamID()
+	defer t.unregisterStream(streamID)
+
+	start := time.Now()
+	counter := &streamByteCounter{}
+	t.agent.metrics.recordStreamOpened()
+	t.agent.config.Observer.OnStreamOpened(streamID)
+	defer func() {
+		bytesIn, bytesOut := counter.in.Load(), counter.out.Load()
+		t.agent.metrics.recordStreamClosed(bytesIn, bytesOut)
+		t.agent.config.Observer.OnStreamClosed(streamID, bytesIn, bytesOut, time.Since(start))
+	}()
+
 	// Read the first message to determine the stream type
 	msg, err := t.codec.DecodeMessage(stream)
 	if err != nil {
@@ -397,29 +856,63 @@ func (t *Tunnel) handleDataStream(ctx context.Context, stream Stream) {
 
 	switch m := msg.(type) {
 	case *TcpConnectMessage:
-		t.handleTCPStream(ctx, stream, m)
+		t.handleTCPStream(ctx, stream, m, counter)
+	case *UdpBindMessage:
+		t.handleUDPStream(ctx, stream, m, counter)
 	case *HttpRequestMessage:
 		t.handleHTTPRequest(ctx, stream, m)
+	case *HttpRequestHeadersMessage:
+		t.handleHTTPRequestStream(ctx, stream, m, counter)
 	case *HttpStreamConnectMessage:
-		t.handleHTTPStream(ctx, stream, m)
+		t.handleHTTPStream(ctx, stream, m, counter)
 	case *TlsConnectMessage:
-		t.handleTLSStream(ctx, stream, m)
+		t.handleTLSStream(ctx, stream, m, counter)
+	case *TlsTermConnectMessage:
+		t.handleTLSTermStream(ctx, stream, m, counter)
+	case *Http3StreamConnectMessage:
+		t.handleHTTP3Stream(ctx, stream, m, counter)
 	default:
 		t.agent.config.Logger.Error("unexpected stream message", "type", fmt.Sprintf("%T", msg))
 	}
 }
 
 // handleTCPStream handles a TCP data stream.
-func (t *Tunnel) handleTCPStream(ctx context.Context, stream Stream, connect *TcpConnectMessage) {
-	t.agent.config.Logger.Debug("handling TCP stream",
-		"stream_id", connect.StreamID,
-		"remote", fmt.Sprintf("%s:%d", connect.RemoteAddr, connect.RemotePort))
+func (t *Tunnel) handleTCPStream(ctx context.Context, stream Stream, connect *TcpConnectMessage, counter *streamByteCounter) {
+	logger := t.streamLogger(ProtocolTCP, connect.StreamID, fmt.Sprintf("%s:%d", connect.RemoteAddr, connect.RemotePort))
+	logger.Debug("handling TCP stream")
+
+	hasConnHandler := t.config.Handler != nil && t.config.Handler.Conn != nil
+	if hasConnHandler || len(t.config.connMiddleware) > 0 {
+		var base ConnHandler
+		var copyIn func(local net.Conn)
+		if hasConnHandler {
+			base = t.config.Handler.Conn
+			copyIn = func(local net.Conn) {
+				if err := t.writePROXYHeader(local, connect.RemoteAddr, connect.RemotePort, connect.ProxyProtocolV2); err != nil {
+					logger.Error("failed to write PROXY protocol header", "error", err)
+					return
+				}
+				t.copyWithCodec(local, stream, connect.StreamID, true, counter)
+			}
+		} else {
+			// The default dial handler writes its own PROXY header against
+			// the real dialed connection, so copyIn just pumps stream data.
+			base = t.defaultTCPDialHandler(connect.RemoteAddr, connect.RemotePort, connect.ProxyProtocolV2)
+			copyIn = func(local net.Conn) { t.copyWithCodec(local, stream, connect.StreamID, true, counter) }
+		}
+
+		t.serveConnHandler(stream, connect.StreamID, chainConnMiddleware(base, t.config.connMiddleware),
+			copyIn,
+			func(local net.Conn) { t.copyToStream(stream, local, connect.StreamID, counter) },
+		)
+		return
+	}
 
 	// Connect to local service
 	localAddr := net.JoinHostPort(t.config.LocalHost(), fmt.Sprintf("%d", t.config.LocalPort()))
 	local, err := net.DialTimeout("tcp", localAddr, DefaultConnectTimeout)
 	if err != nil {
-		t.agent.config.Logger.Error("failed to connect to local", "addr", localAddr, "error", err)
+		logger.Error("failed to connect to local", "addr", localAddr, "error", err)
 		// Send close message
 		closeMsg := &TcpCloseMessage{StreamID: connect.StreamID}
 		if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
@@ -429,6 +922,15 @@ func (t *Tunnel) handleTCPStream(ctx context.Context, stream Stream, connect *Tc
 	}
 	defer local.Close()
 
+	if err := t.writePROXYHeader(local, connect.RemoteAddr, connect.RemotePort, connect.ProxyProtocolV2); err != nil {
+		logger.Error("failed to write PROXY protocol header", "error", err)
+		closeMsg := &TcpCloseMessage{StreamID: connect.StreamID}
+		if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
+			stream.Write(data)
+		}
+		return
+	}
+
 	// Bidirectional copy
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -436,115 +938,595 @@ func (t *Tunnel) handleTCPStream(ctx context.Context, stream Stream, connect *Tc
 	// Stream -> Local
 	go func() {
 		defer wg.Done()
-		t.copyWithCodec(local, stream, connect.StreamID, true)
+		t.copyWithCodec(local, stream, connect.StreamID, true, counter)
 	}()
 
 	// Local -> Stream
 	go func() {
 		defer wg.Done()
-		t.copyToStream(stream, local, connect.StreamID)
+		t.copyToStream(stream, local, connect.StreamID, counter)
 	}()
 
 	wg.Wait()
 }
 
+// handleUDPStream handles a UDP tunnel's stream, which multiplexes
+// datagrams for every public peer hitting the relay's UDP listener. Each
+// distinct peer gets its own net.Conn to the local upstream, keyed by
+// "PeerAddr:PeerPort", so replies can be tagged back to the right peer; idle
+// peer sessions are torn down after DefaultIdleTimeout.
+func (t *Tunnel) handleUDPStream(ctx context.Context, stream Stream, bind *UdpBindMessage, counter *streamByteCounter) {
+	logger := t.streamLogger(ProtocolUDP, bind.StreamID, fmt.Sprintf("%s:%d", bind.RemoteAddr, bind.RemotePort))
+	logger.Debug("handling UDP stream")
+
+	localAddr := net.JoinHostPort(t.config.LocalHost(), fmt.Sprintf("%d", t.config.LocalPort()))
+
+	sessions := newUdpSessionTable(t, logger, stream, bind.StreamID, localAddr, counter)
+	defer sessions.closeAll()
+
+	t.udpSessionsMu.Lock()
+	t.udpSessions[bind.StreamID] = sessions
+	t.udpSessionsMu.Unlock()
+	defer func() {
+		t.udpSessionsMu.Lock()
+		delete(t.udpSessions, bind.StreamID)
+		t.udpSessionsMu.Unlock()
+	}()
+
+	for {
+		msg, err := t.codec.DecodeMessage(stream)
+		if err != nil {
+			return
+		}
+
+		switch m := msg.(type) {
+		case *UdpDatagramMessage:
+			sessions.writeToUpstream(m.PeerAddr, m.PeerPort, m.Data)
+		case *UdpCloseMessage:
+			return
+		default:
+			logger.Error("unexpected message on UDP stream", "type", fmt.Sprintf("%T", msg))
+		}
+	}
+}
+
+// udpSession is one peer's connection to the local UDP upstream.
+type udpSession struct {
+	conn     net.Conn
+	peerAddr string
+	peerPort uint16
+}
+
+// udpSessionTable tracks per-peer UDP sessions multiplexed onto a single
+// tunnel stream, so replies from the upstream are tagged with the right
+// peer before being written back to the relay.
+type udpSessionTable struct {
+	tunnel    *Tunnel
+	logger    Logger
+	stream    Stream
+	streamID  uint32
+	localAddr string
+	counter   *streamByteCounter
+	writeMu   sync.Mutex // serializes writes to stream
+	mu        sync.Mutex
+	byPeer    map[string]*udpSession
+}
+
+func newUdpSessionTable(t *Tunnel, logger Logger, stream Stream, streamID uint32, localAddr string, counter *streamByteCounter) *udpSessionTable {
+	return &udpSessionTable{
+		tunnel:    t,
+		logger:    logger,
+		stream:    stream,
+		streamID:  streamID,
+		localAddr: localAddr,
+		counter:   counter,
+		byPeer:    make(map[string]*udpSession),
+	}
+}
+
+// writeToUpstream forwards data from peerAddr:peerPort to the local
+// upstream, dialing a new session on first use.
+func (st *udpSessionTable) writeToUpstream(peerAddr string, peerPort uint16, data []byte) {
+	key := net.JoinHostPort(peerAddr, fmt.Sprintf("%d", peerPort))
+
+	st.mu.Lock()
+	sess, ok := st.byPeer[key]
+	if !ok {
+		conn, err := net.DialTimeout("udp", st.localAddr, DefaultConnectTimeout)
+		if err != nil {
+			st.mu.Unlock()
+			st.logger.Error("failed to dial local UDP upstream", "addr", st.localAddr, "error", err)
+			return
+		}
+		sess = &udpSession{conn: conn, peerAddr: peerAddr, peerPort: peerPort}
+		st.byPeer[key] = sess
+		st.mu.Unlock()
+		go st.readFromUpstream(key, sess)
+	} else {
+		st.mu.Unlock()
+	}
+
+	if _, err := sess.conn.Write(data); err != nil {
+		st.logger.Error("failed to write to local UDP upstream", "error", err)
+	}
+}
+
+// readFromUpstream copies datagrams from sess's upstream connection back to
+// the relay, tagged with sess's peer, until it goes idle or errors.
+func (st *udpSessionTable) readFromUpstream(key string, sess *udpSession) {
+	defer st.remove(key, sess)
+
+	buf := make([]byte, 64*1024)
+	for {
+		sess.conn.SetReadDeadline(time.Now().Add(DefaultIdleTimeout))
+		n, err := sess.conn.Read(buf)
+		if n > 0 {
+			msg := &UdpDatagramMessage{
+				StreamID: st.streamID,
+				PeerAddr: sess.peerAddr,
+				PeerPort: sess.peerPort,
+				Data:     append([]byte(nil), buf[:n]...),
+			}
+			data, encErr := st.tunnel.codec.EncodeMessage(msg)
+			if encErr != nil {
+				st.logger.Error("failed to encode UDP datagram", "error", encErr)
+				return
+			}
+
+			// Fast path: send as an unreliable QUIC datagram (flow-ID framed
+			// by StreamID, same as the reliable path) when it fits and the
+			// transport supports one, falling back to the reliable stream
+			// otherwise. The length prefix EncodeMessage adds is only needed
+			// to delimit messages within a stream, so it's stripped here
+			// since a datagram is already its own delimited unit.
+			sentAsDatagram := false
+			payload := data[LengthPrefixSize:]
+			if len(payload) <= MaxDatagramFrameSize {
+				sentAsDatagram = st.tunnel.transport().SendDatagram(payload) == nil
+			}
+
+			if !sentAsDatagram {
+				st.writeMu.Lock()
+				_, writeErr := st.stream.Write(data)
+				st.writeMu.Unlock()
+				if writeErr != nil {
+					return
+				}
+			}
+			st.tunnel.addBytesIn(st.counter, uint64(n))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (st *udpSessionTable) remove(key string, sess *udpSession) {
+	sess.conn.Close()
+	st.mu.Lock()
+	if st.byPeer[key] == sess {
+		delete(st.byPeer, key)
+	}
+	st.mu.Unlock()
+}
+
+func (st *udpSessionTable) closeAll() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for key, sess := range st.byPeer {
+		sess.conn.Close()
+		delete(st.byPeer, key)
+	}
+}
+
 // handleHTTPRequest handles an HTTP request message.
 func (t *Tunnel) handleHTTPRequest(ctx context.Context, stream Stream, req *HttpRequestMessage) {
-	t.agent.config.Logger.Debug("handling HTTP request",
-		"stream_id", req.StreamID,
-		"method", req.Method,
-		"uri", req.URI)
+	logger := t.streamLogger(ProtocolHTTP, req.StreamID, "")
+	logger.Debug("handling HTTP request", "method", req.Method, "uri", req.URI)
 
-	if t.forwarder == nil {
+	hasHandler := t.config.Handler != nil && t.config.Handler.HTTP != nil
+	if t.forwarder == nil && !hasHandler {
 		t.sendHTTPError(stream, req.StreamID, http.StatusBadGateway, "no upstream configured")
 		return
 	}
 
-	resp, err := t.forwarder.forward(ctx, req)
+	if req.Compressed {
+		body, err := t.decompressPayload(req.Body, true, req.OrigLen)
+		if err != nil {
+			logger.Error("failed to decompress request body", "error", err)
+			t.sendHTTPError(stream, req.StreamID, http.StatusBadGateway, "failed to decompress request body")
+			return
+		}
+		req.Body = body
+		req.Compressed = false
+	}
+
+	if len(req.HeaderBlock) > 0 {
+		headers, err := DecompressHeaders(req.HeaderBlock)
+		if err != nil {
+			logger.Error("failed to decompress request headers", "error", err)
+			t.sendHTTPError(stream, req.StreamID, http.StatusBadGateway, "failed to decompress request headers")
+			return
+		}
+		req.Headers = headers
+		req.HeaderBlock = nil
+	}
+
+	var base RequestHandler
+	if hasHandler {
+		base = t.serveHTTPHandler
+	} else {
+		base = t.forwarder.forward
+	}
+
+	resp, err := chainMiddleware(base, t.config.middleware)(ctx, req)
 	if err != nil {
-		t.agent.config.Logger.Error("failed to forward request", "error", err)
+		logger.Error("failed to forward request", "error", err)
 		t.sendHTTPError(stream, req.StreamID, http.StatusBadGateway, err.Error())
 		return
 	}
 
+	resp.Body, resp.Compressed, resp.OrigLen = t.compressPayload(resp.Body)
+
+	if t.getHeaderCompression() && len(resp.Headers) > 0 {
+		resp.HeaderBlock = CompressHeaders(resp.Headers)
+		resp.Headers = nil
+	}
+
 	// Send response
 	data, err := t.codec.EncodeMessage(resp)
 	if err != nil {
-		t.agent.config.Logger.Error("failed to encode response", "error", err)
+		logger.Error("failed to encode response", "error", err)
 		return
 	}
 
 	if _, err := stream.Write(data); err != nil {
-		t.agent.config.Logger.Error("failed to send response", "error", err)
+		logger.Error("failed to send response", "error", err)
 	}
 }
 
-// handleHTTPStream handles an HTTP stream passthrough.
-func (t *Tunnel) handleHTTPStream(ctx context.Context, stream Stream, connect *HttpStreamConnectMessage) {
-	t.agent.config.Logger.Debug("handling HTTP stream",
-		"stream_id", connect.StreamID,
-		"host", connect.Host)
-
-	// Connect to local service
-	localAddr := net.JoinHostPort(t.config.LocalHost(), fmt.Sprintf("%d", t.config.LocalPort()))
-	local, err := net.DialTimeout("tcp", localAddr, DefaultConnectTimeout)
-	if err != nil {
-		t.agent.config.Logger.Error("failed to connect to local", "addr", localAddr, "error", err)
-		closeMsg := &HttpStreamCloseMessage{StreamID: connect.StreamID}
-		if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
-			stream.Write(data)
-		}
+// handleHTTPRequestStream handles a streaming HTTP request opened by
+// HttpRequestHeadersMessage: unlike handleHTTPRequest, the request body
+// arrives as HttpBodyChunkMessage frames instead of being buffered into a
+// single message, response headers are sent back as soon as f.forwardStream
+// returns (before the upstream response body has been read at all), and the
+// response body is pumped through in bounded chunks. This keeps large
+// uploads/downloads, SSE, and long-polling off the heap end to end.
+func (t *Tunnel) handleHTTPRequestStream(ctx context.Context, stream Stream, req *HttpRequestHeadersMessage, counter *streamByteCounter) {
+	logger := t.streamLogger(ProtocolHTTP, req.StreamID, "")
+	logger.Debug("handling streaming HTTP request", "method", req.Method, "uri", req.URI)
+
+	hasHandler := t.config.Handler != nil && t.config.Handler.HTTP != nil
+	if t.forwarder == nil && !hasHandler {
+		t.sendHTTPError(stream, req.StreamID, http.StatusBadGateway, "no upstream configured")
 		return
 	}
-	defer local.Close()
 
-	// Send initial data
-	if len(connect.InitialData) > 0 {
-		if _, err := local.Write(connect.InitialData); err != nil {
-			t.agent.config.Logger.Error("failed to send initial data", "error", err)
+	if len(req.HeaderBlock) > 0 {
+		headers, err := DecompressHeaders(req.HeaderBlock)
+		if err != nil {
+			logger.Error("failed to decompress request headers", "error", err)
+			t.sendHTTPError(stream, req.StreamID, http.StatusBadGateway, "failed to decompress request headers")
 			return
 		}
+		req.Headers = headers
+		req.HeaderBlock = nil
 	}
 
-	// Bidirectional copy (similar to TCP)
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		t.copyHttpStream(local, stream, connect.StreamID)
-	}()
+	if hasHandler {
+		t.serveHTTPHandlerStream(ctx, stream, req, counter)
+		return
+	}
 
+	bodyReader, bodyWriter := io.Pipe()
 	go func() {
-		defer wg.Done()
-		t.copyHttpStreamToRemote(stream, local, connect.StreamID)
+		bodyWriter.CloseWithError(t.pumpHTTPRequestBody(bodyWriter, stream, req.StreamID, counter))
 	}()
 
-	wg.Wait()
-}
-
-// handleTLSStream handles a TLS/SNI stream.
-func (t *Tunnel) handleTLSStream(ctx context.Context, stream Stream, connect *TlsConnectMessage) {
-	t.agent.config.Logger.Debug("handling TLS stream",
-		"stream_id", connect.StreamID,
-		"sni", connect.SNI)
-
-	// Connect to local service
-	localAddr := net.JoinHostPort(t.config.LocalHost(), fmt.Sprintf("%d", t.config.LocalPort()))
-	local, err := net.DialTimeout("tcp", localAddr, DefaultConnectTimeout)
+	resp, err := t.forwarder.forwardStream(ctx, req, bodyReader)
 	if err != nil {
-		t.agent.config.Logger.Error("failed to connect to local", "addr", localAddr, "error", err)
-		closeMsg := &TlsCloseMessage{StreamID: connect.StreamID}
-		if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
-			stream.Write(data)
-		}
+		logger.Error("failed to forward streaming request", "error", err)
+		t.sendHTTPError(stream, req.StreamID, http.StatusBadGateway, err.Error())
 		return
 	}
-	defer local.Close()
+	defer resp.Body.Close()
 
-	// Send the ClientHello first
-	if _, err := local.Write(connect.ClientHello); err != nil {
-		t.agent.config.Logger.Error("failed to send ClientHello", "error", err)
+	headers := make(map[string]string, len(resp.Header))
+	for k, v := range resp.Header {
+		if len(v) > 0 {
+			headers[k] = v[0]
+		}
+	}
+
+	respHeaders := &HttpResponseHeadersMessage{
+		StreamID:      req.StreamID,
+		Status:        uint16(resp.StatusCode),
+		Headers:       headers,
+		ContentLength: resp.ContentLength,
+	}
+	if t.getHeaderCompression() && len(respHeaders.Headers) > 0 {
+		respHeaders.HeaderBlock = CompressHeaders(respHeaders.Headers)
+		respHeaders.Headers = nil
+	}
+
+	if err := t.encodeDataMessage(stream, respHeaders); err != nil {
+		logger.Error("failed to send response headers", "error", err)
+		return
+	}
+
+	t.streamHTTPResponseBody(stream, resp, req.StreamID, counter)
+}
+
+// serveHTTPHandler runs t.config.Handler.HTTP against a buffered request,
+// in place of t.forwarder.forward, and packs its response into a single
+// HttpResponseMessage the same way forward's *http.Response conversion does.
+func (t *Tunnel) serveHTTPHandler(ctx context.Context, req *HttpRequestMessage) (*HttpResponseMessage, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URI, io.NopCloser(strings.NewReader(string(req.Body))))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if host := lookupHeader(req.Headers, "Host"); host != "" {
+		httpReq.Host = host
+	}
+	httpReq.ContentLength = int64(len(req.Body))
+
+	rw := newHTTPHandlerResponseWriter()
+	t.config.Handler.HTTP.ServeHTTP(rw, httpReq)
+
+	return &HttpResponseMessage{
+		StreamID: req.StreamID,
+		Status:   uint16(rw.statusCode),
+		Headers:  headersFromHTTPHeader(rw.header),
+		Body:     rw.body.Bytes(),
+	}, nil
+}
+
+// serveHTTPHandlerStream runs t.config.Handler.HTTP against a streaming
+// request, in place of t.forwarder.forwardStream, writing directly to
+// stream via a tunnelStreamResponseWriter instead of buffering a full
+// *http.Response.
+func (t *Tunnel) serveHTTPHandlerStream(ctx context.Context, stream Stream, req *HttpRequestHeadersMessage, counter *streamByteCounter) {
+	logger := t.streamLogger(ProtocolHTTP, req.StreamID, "")
+
+	bodyReader, bodyWriter := io.Pipe()
+	go func() {
+		bodyWriter.CloseWithError(t.pumpHTTPRequestBody(bodyWriter, stream, req.StreamID, counter))
+	}()
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URI, bodyReader)
+	if err != nil {
+		logger.Error("failed to build request for handler", "error", err)
+		t.sendHTTPError(stream, req.StreamID, http.StatusBadRequest, "invalid request")
+		return
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if host := lookupHeader(req.Headers, "Host"); host != "" {
+		httpReq.Host = host
+	}
+	httpReq.ContentLength = req.ContentLength
+
+	rw := &tunnelStreamResponseWriter{t: t, stream: stream, streamID: req.StreamID, header: make(http.Header)}
+	t.config.Handler.HTTP.ServeHTTP(rw, httpReq)
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.err != nil {
+		logger.Error("failed to stream response from handler", "error", rw.err)
+		return
+	}
+
+	if err := t.encodeDataMessage(stream, &HttpEndMessage{StreamID: req.StreamID}); err != nil {
+		logger.Error("failed to send response end", "error", err)
+	}
+}
+
+// pumpHTTPRequestBody reads HttpBodyChunkMessage/HttpTrailersMessage frames
+// off src until HttpEndMessage, writing each chunk's decompressed data to
+// dst, so the http.Client request body stays a plain io.Reader regardless of
+// how many frames the relay split it into.
+func (t *Tunnel) pumpHTTPRequestBody(dst io.Writer, src Stream, streamID uint32, counter *streamByteCounter) error {
+	for {
+		msg, release, err := t.decodeDataMessage(src)
+		if err != nil {
+			return err
+		}
+
+		switch m := msg.(type) {
+		case *HttpBodyChunkMessage:
+			payload, err := t.decompressPayload(m.Data, m.Compressed, m.OrigLen)
+			if err != nil {
+				release()
+				return err
+			}
+			_, writeErr := dst.Write(payload)
+			t.addBytesIn(counter, uint64(len(payload)))
+			release()
+			if writeErr != nil {
+				return writeErr
+			}
+		case *HttpTrailersMessage:
+			release()
+		case *HttpEndMessage:
+			release()
+			return nil
+		default:
+			release()
+		}
+	}
+}
+
+// buildHttpBodyChunkMessage mirrors buildHttpStreamDataMessage for
+// streaming HTTP request/response bodies.
+func (t *Tunnel) buildHttpBodyChunkMessage(streamID uint32, data []byte) *HttpBodyChunkMessage {
+	out, compressed, origLen := t.compressPayload(data)
+	return &HttpBodyChunkMessage{StreamID: streamID, Data: out, Compressed: compressed, OrigLen: origLen}
+}
+
+// streamHTTPResponseBody pumps resp.Body through dst as HttpBodyChunkMessage
+// frames in bounded chunks, so a resp.ContentLength == -1 response (chunked
+// transfer, SSE, long-polling) streams through instead of being read to EOF
+// in memory first. Any response trailers are sent just before HttpEndMessage.
+func (t *Tunnel) streamHTTPResponseBody(dst Stream, resp *http.Response, streamID uint32, counter *streamByteCounter) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			msg := t.buildHttpBodyChunkMessage(streamID, buf[:n])
+			if encErr := t.encodeDataMessage(dst, msg); encErr != nil {
+				return
+			}
+			t.addBytesOut(counter, uint64(n))
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if len(resp.Trailer) > 0 {
+		trailers := make(map[string]string, len(resp.Trailer))
+		for k, v := range resp.Trailer {
+			if len(v) > 0 {
+				trailers[k] = v[0]
+			}
+		}
+		if err := t.encodeDataMessage(dst, &HttpTrailersMessage{StreamID: streamID, Trailers: trailers}); err != nil {
+			return
+		}
+	}
+
+	t.encodeDataMessage(dst, &HttpEndMessage{StreamID: streamID})
+}
+
+// handleHTTPStream handles an HTTP stream passthrough.
+func (t *Tunnel) handleHTTPStream(ctx context.Context, stream Stream, connect *HttpStreamConnectMessage, counter *streamByteCounter) {
+	logger := t.streamLogger(ProtocolHTTP, connect.StreamID, "")
+	logger.Debug("handling HTTP stream", "host", connect.Host)
+
+	// Connect to local service, or to whichever ingress rule matches
+	// connect.Host if ingress routing is configured.
+	network, localAddr := "tcp", net.JoinHostPort(t.config.LocalHost(), fmt.Sprintf("%d", t.config.LocalPort()))
+	if t.forwarder != nil {
+		if n, a, ok := t.forwarder.resolveStreamAddr(connect.Host); ok {
+			network, localAddr = n, a
+		}
+	}
+	local, err := net.DialTimeout(network, localAddr, DefaultConnectTimeout)
+	if err != nil {
+		logger.Error("failed to connect to local", "addr", localAddr, "error", err)
+		closeMsg := &HttpStreamCloseMessage{StreamID: connect.StreamID}
+		if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
+			stream.Write(data)
+		}
+		return
+	}
+	defer local.Close()
+
+	// Send initial data
+	if len(connect.InitialData) > 0 {
+		if _, err := local.Write(connect.InitialData); err != nil {
+			logger.Error("failed to send initial data", "error", err)
+			return
+		}
+	}
+
+	// Bidirectional copy (similar to TCP)
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		t.copyHttpStream(local, stream, connect.StreamID, counter)
+	}()
+
+	go func() {
+		defer wg.Done()
+		t.copyHttpStreamToRemote(stream, local, connect.StreamID, counter)
+	}()
+
+	wg.Wait()
+}
+
+// handleTLSStream handles a TLS/SNI stream.
+func (t *Tunnel) handleTLSStream(ctx context.Context, stream Stream, connect *TlsConnectMessage, counter *streamByteCounter) {
+	logger := t.streamLogger(ProtocolTLS, connect.StreamID, "")
+	logger.Debug("handling TLS stream", "sni", connect.SNI)
+
+	// A relay routes "acme-tls/1" ALPN connections here instead of to the
+	// local upstream, since only the acme package -- not the local app --
+	// knows how to answer a TLSALPN01 challenge (see WithACME).
+	if t.config.acmeManager != nil && containsACMETLSALPN(connect.ALPNOffers) {
+		t.handleACMEChallengeStream(stream, connect, counter)
+		return
+	}
+
+	hasConnHandler := t.config.Handler != nil && t.config.Handler.Conn != nil
+	if hasConnHandler || len(t.config.connMiddleware) > 0 {
+		var base ConnHandler
+		var copyIn func(local net.Conn)
+		if hasConnHandler {
+			base = t.config.Handler.Conn
+			copyIn = func(local net.Conn) {
+				// TlsConnectMessage carries no RemoteAddr/RemotePort
+				// (SNI-passthrough never decrypts the connection), so only
+				// a relay-precomputed header can be forwarded here.
+				if err := t.writePROXYHeader(local, "", 0, connect.ProxyProtocolV2); err != nil {
+					logger.Error("failed to write PROXY protocol header", "error", err)
+					return
+				}
+				if _, err := local.Write(connect.ClientHello); err != nil {
+					logger.Error("failed to send ClientHello", "error", err)
+					return
+				}
+				t.copyTlsStream(local, stream, connect.StreamID, counter)
+			}
+		} else {
+			// The default dial handler writes its own PROXY header and
+			// replays ClientHello against the real dialed connection, so
+			// copyIn just pumps stream data.
+			base = t.defaultTLSDialHandler(connect.ClientHello, connect.ProxyProtocolV2)
+			copyIn = func(local net.Conn) { t.copyTlsStream(local, stream, connect.StreamID, counter) }
+		}
+
+		t.serveConnHandler(stream, connect.StreamID, chainConnMiddleware(base, t.config.connMiddleware),
+			copyIn,
+			func(local net.Conn) { t.copyTlsStreamToRemote(stream, local, connect.StreamID, counter) },
+		)
+		return
+	}
+
+	// Connect to local service
+	localAddr := net.JoinHostPort(t.config.LocalHost(), fmt.Sprintf("%d", t.config.LocalPort()))
+	local, err := net.DialTimeout("tcp", localAddr, DefaultConnectTimeout)
+	if err != nil {
+		logger.Error("failed to connect to local", "addr", localAddr, "error", err)
+		closeMsg := &TlsCloseMessage{StreamID: connect.StreamID}
+		if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
+			stream.Write(data)
+		}
+		return
+	}
+	defer local.Close()
+
+	// TlsConnectMessage carries no RemoteAddr/RemotePort (SNI-passthrough
+	// never decrypts the connection), so only a relay-precomputed header
+	// can be forwarded here; there's nothing to build one from locally.
+	if err := t.writePROXYHeader(local, "", 0, connect.ProxyProtocolV2); err != nil {
+		logger.Error("failed to write PROXY protocol header", "error", err)
+		closeMsg := &TlsCloseMessage{StreamID: connect.StreamID}
+		if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
+			stream.Write(data)
+		}
+		return
+	}
+
+	// Send the ClientHello first
+	if _, err := local.Write(connect.ClientHello); err != nil {
+		logger.Error("failed to send ClientHello", "error", err)
 		return
 	}
 
@@ -554,69 +1536,506 @@ func (t *Tunnel) handleTLSStream(ctx context.Context, stream Stream, connect *Tl
 
 	go func() {
 		defer wg.Done()
-		t.copyTlsStream(local, stream, connect.StreamID)
+		t.copyTlsStream(local, stream, connect.StreamID, counter)
+	}()
+
+	go func() {
+		defer wg.Done()
+		t.copyTlsStreamToRemote(stream, local, connect.StreamID, counter)
+	}()
+
+	wg.Wait()
+}
+
+// acmeTLSALPNProtocol is the ALPN value a TLS-ALPN-01 challenge connection
+// (RFC 8737) offers instead of the protocol the real upstream expects.
+const acmeTLSALPNProtocol = "acme-tls/1"
+
+// containsACMETLSALPN reports whether offers includes acmeTLSALPNProtocol.
+func containsACMETLSALPN(offers []string) bool {
+	for _, alpn := range offers {
+		if alpn == acmeTLSALPNProtocol {
+			return true
+		}
+	}
+	return false
+}
+
+// handleACMEChallengeStream answers a TLS-ALPN-01 challenge connection that
+// arrived as an ordinary ProtocolTLS passthrough stream. It performs the TLS
+// handshake itself over an in-process net.Pipe, reusing copyTlsStream/
+// copyTlsStreamToRemote to ferry bytes between the stream and the pipe
+// exactly as handleTLSStream does for a real upstream, presenting whatever
+// challenge certificate t.config.acmeManager currently has for the SNI name.
+func (t *Tunnel) handleACMEChallengeStream(stream Stream, connect *TlsConnectMessage, counter *streamByteCounter) {
+	t.agent.config.Logger.Debug("handling ACME TLS-ALPN-01 challenge stream", "sni", connect.SNI)
+
+	local, remote := net.Pipe()
+	defer local.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		// The relay already consumed the ClientHello into connect; replay
+		// it before forwarding whatever TlsData arrives after it, so the
+		// TLS server on the other end of the pipe sees the full handshake
+		// in order.
+		if _, err := local.Write(connect.ClientHello); err != nil {
+			return
+		}
+		t.copyTlsStream(local, stream, connect.StreamID, counter)
+	}()
+
+	go func() {
+		defer wg.Done()
+		t.copyTlsStreamToRemote(stream, local, connect.StreamID, counter)
+	}()
+
+	tlsConn := tls.Server(remote, &tls.Config{
+		NextProtos: []string{acmeTLSALPNProtocol},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, ok := t.config.acmeManager.ChallengeCertificate(hello.ServerName)
+			if !ok {
+				return nil, fmt.Errorf("acme: no challenge certificate for %s", hello.ServerName)
+			}
+			return cert, nil
+		},
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		t.agent.config.Logger.Warn("acme: TLS-ALPN-01 challenge handshake failed", "sni", connect.SNI, "error", err)
+	}
+	tlsConn.Close()
+
+	wg.Wait()
+}
+
+// handleTLSTermStream handles a TLS-terminated TCP stream: the relay has
+// already completed the TLS handshake, so the local app only ever sees
+// plain TCP bytes.
+func (t *Tunnel) handleTLSTermStream(ctx context.Context, stream Stream, connect *TlsTermConnectMessage, counter *streamByteCounter) {
+	logger := t.streamLogger(ProtocolTLSTerminated, connect.StreamID, fmt.Sprintf("%s:%d", connect.RemoteAddr, connect.RemotePort))
+	logger.Debug("handling TLS-terminated stream",
+		"sni", connect.SNI,
+		"alpn", connect.ALPN,
+		"cipher_suite", connect.CipherSuite,
+		"client_cert_sha256", connect.ClientCertSHA256)
+
+	// Connect to local service
+	localAddr := net.JoinHostPort(t.config.LocalHost(), fmt.Sprintf("%d", t.config.LocalPort()))
+	local, err := net.DialTimeout("tcp", localAddr, DefaultConnectTimeout)
+	if err != nil {
+		logger.Error("failed to connect to local", "addr", localAddr, "error", err)
+		closeMsg := &TlsTermCloseMessage{StreamID: connect.StreamID}
+		if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
+			stream.Write(data)
+		}
+		return
+	}
+	defer local.Close()
+
+	// Bidirectional copy, identical shape to handleTCPStream since the
+	// relay already stripped TLS off the wire.
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		t.copyTlsTermStream(local, stream, connect.StreamID, counter)
+	}()
+
+	go func() {
+		defer wg.Done()
+		t.copyTlsTermStreamToRemote(stream, local, connect.StreamID, counter)
+	}()
+
+	wg.Wait()
+}
+
+// handleHTTP3Stream handles an HTTP/3 stream passthrough. It is forwarded to
+// the local service exactly like an HTTP stream passthrough connection;
+// HTTP/3 only changes how the edge negotiated the connection with the
+// client, not how bytes reach the upstream.
+func (t *Tunnel) handleHTTP3Stream(ctx context.Context, stream Stream, connect *Http3StreamConnectMessage, counter *streamByteCounter) {
+	logger := t.streamLogger(Protocol("http3"), connect.StreamID, "")
+	logger.Debug("handling HTTP/3 stream", "host", connect.Host, "alpn", connect.ALPN)
+
+	// Connect to local service
+	localAddr := net.JoinHostPort(t.config.LocalHost(), fmt.Sprintf("%d", t.config.LocalPort()))
+	local, err := net.DialTimeout("tcp", localAddr, DefaultConnectTimeout)
+	if err != nil {
+		logger.Error("failed to connect to local", "addr", localAddr, "error", err)
+		closeMsg := &Http3StreamCloseMessage{StreamID: connect.StreamID}
+		if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
+			stream.Write(data)
+		}
+		return
+	}
+	defer local.Close()
+
+	if len(connect.InitialData) > 0 {
+		if _, err := local.Write(connect.InitialData); err != nil {
+			logger.Error("failed to send initial data", "error", err)
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		t.copyHTTP3Stream(local, stream, connect.StreamID, counter)
 	}()
 
 	go func() {
 		defer wg.Done()
-		t.copyTlsStreamToRemote(stream, local, connect.StreamID)
+		t.copyHTTP3StreamToRemote(stream, local, connect.StreamID, counter)
 	}()
 
 	wg.Wait()
 }
 
+// writePROXYHeader prepends a PROXY protocol header to local ahead of the
+// bridged bytes. If the relay already sent a precomputed header
+// (precomputed), that's forwarded verbatim; otherwise, when
+// WithPROXYProtocol is enabled and remoteAddr is known, one is built from
+// remoteAddr/remotePort and local's own address. A zero-value remoteAddr
+// means no fallback is possible, so only a relay-precomputed header can
+// apply.
+func (t *Tunnel) writePROXYHeader(local net.Conn, remoteAddr string, remotePort uint16, precomputed []byte) error {
+	if len(precomputed) > 0 {
+		_, err := local.Write(precomputed)
+		return err
+	}
+	if t.config.PROXYProtocolVersion == 0 || remoteAddr == "" {
+		return nil
+	}
+
+	dstAddr, ok := local.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return fmt.Errorf("PROXY protocol requires a TCP local connection, got %T", local.LocalAddr())
+	}
+	srcIP := net.ParseIP(remoteAddr)
+	if srcIP == nil {
+		return fmt.Errorf("invalid remote address for PROXY protocol: %q", remoteAddr)
+	}
+	srcAddr := &net.TCPAddr{IP: srcIP, Port: int(remotePort)}
+
+	header, err := BuildPROXYProtocolHeader(t.config.PROXYProtocolVersion, srcAddr, dstAddr)
+	if err != nil {
+		return err
+	}
+	_, err = local.Write(header)
+	return err
+}
+
+// compressPayload compresses data with the tunnel's negotiated algorithm.
+// Once compressStats.disabled() trips (recent frames stopped shrinking
+// enough to justify the CPU cost), it still probes periodically via
+// shouldAttempt so compression can resume if traffic becomes compressible
+// again, instead of being disabled for the tunnel's entire lifetime.
+func (t *Tunnel) compressPayload(data []byte) (out []byte, compressed bool, origLen uint32) {
+	alg := t.getCompression()
+	if alg == CompressionNone || alg == "" || len(data) < minCompressSize(alg) {
+		return data, false, 0
+	}
+	if !t.compressStats.shouldAttempt() {
+		return data, false, 0
+	}
+
+	compressedData, err := compressBytes(alg, data)
+	if err != nil {
+		return data, false, 0
+	}
+	t.compressStats.record(len(data), len(compressedData))
+
+	if len(compressedData) >= len(data) {
+		return data, false, 0
+	}
+	return compressedData, true, uint32(len(data))
+}
+
+func (t *Tunnel) buildTcpDataMessage(streamID uint32, data []byte) *TcpDataMessage {
+	out, compressed, origLen := t.compressPayload(data)
+	return &TcpDataMessage{StreamID: streamID, Data: out, Compressed: compressed, OrigLen: origLen}
+}
+
+func (t *Tunnel) buildTlsDataMessage(streamID uint32, data []byte) *TlsDataMessage {
+	out, compressed, origLen := t.compressPayload(data)
+	return &TlsDataMessage{StreamID: streamID, Data: out, Compressed: compressed, OrigLen: origLen}
+}
+
+func (t *Tunnel) buildHttpStreamDataMessage(streamID uint32, data []byte) *HttpStreamDataMessage {
+	out, compressed, origLen := t.compressPayload(data)
+	return &HttpStreamDataMessage{StreamID: streamID, Data: out, Compressed: compressed, OrigLen: origLen}
+}
+
+// decompressPayload reverses compressPayload for an inbound data message.
+func (t *Tunnel) decompressPayload(data []byte, compressed bool, origLen uint32) ([]byte, error) {
+	if !compressed {
+		return data, nil
+	}
+	return decompressFrame(t.getCompression(), data, origLen)
+}
+
 // Helper methods for stream copying
 
-func (t *Tunnel) copyWithCodec(dst io.Writer, src Stream, streamID uint32, isTcp bool) {
-	buf := make([]byte, 32*1024)
+// decodeDataMessage decodes the next TunnelMessage from src. When the
+// tunnel's negotiated WireFormat is bincode, it uses MessageCodec.DecodeInto
+// so *TcpDataMessage/*TlsDataMessage/*HttpStreamDataMessage's Data field
+// comes back as a zero-copy subslice of a pooled buffer instead of
+// DecodeMessage's per-frame allocation; the returned release func must be
+// called once the caller is done reading that Data (and is a no-op for
+// every other message type or WireFormat).
+func (t *Tunnel) decodeDataMessage(src Stream) (TunnelMessage, func(), error) {
+	if mc, ok := t.codec.(*MessageCodec); ok {
+		msg, frame, err := mc.DecodeInto(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		return msg, frame.Release, nil
+	}
+	msg, err := t.codec.DecodeMessage(src)
+	return msg, func() {}, err
+}
+
+// encodeDataMessage writes msg to dst. When the tunnel's negotiated
+// WireFormat is bincode, it uses MessageCodec.EncodeInto to skip the
+// intermediate result := make(...) copy EncodeMessage does before the
+// caller's own Write.
+func (t *Tunnel) encodeDataMessage(dst io.Writer, msg TunnelMessage) error {
+	if mc, ok := t.codec.(*MessageCodec); ok {
+		return mc.EncodeInto(msg, dst)
+	}
+	data, err := t.codec.EncodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(data)
+	return err
+}
+
+// writeWindowed sends data onto dst as one or more build(streamID, chunk)
+// DataMessages, splitting it into chunks no larger than streamID's
+// currently available send window (see streamFlowControl.acquireSend) and
+// blocking between chunks until the peer's StreamWindowUpdateMessages
+// refill it. Callers must have already called t.flowControl.open(streamID).
+func (t *Tunnel) writeWindowed(dst Stream, streamID uint32, data []byte, build func(streamID uint32, chunk []byte) TunnelMessage) error {
+	for len(data) > 0 {
+		n, err := t.flowControl.acquireSend(streamID, uint32(len(data)))
+		if err != nil {
+			return err
+		}
+		if err := t.encodeDataMessage(dst, build(streamID, data[:n])); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// maybeGrantWindow records n more received-and-consumed bytes for streamID
+// and writes a StreamWindowUpdateMessage back onto dst for the stream
+// and/or the tunnel's connection-level window, once recordConsumed says
+// either is due (see streamFlowControl.recordConsumed).
+func (t *Tunnel) maybeGrantWindow(dst io.Writer, streamID uint32, n uint32) {
+	streamDelta, connDelta := t.flowControl.recordConsumed(streamID, n)
+	if streamDelta > 0 {
+		t.encodeDataMessage(dst, &StreamWindowUpdateMessage{StreamID: streamID, Delta: streamDelta})
+	}
+	if connDelta > 0 {
+		t.encodeDataMessage(dst, &StreamWindowUpdateMessage{StreamID: ControlStreamID, Delta: connDelta})
+	}
+}
+
+func (t *Tunnel) copyWithCodec(dst io.Writer, src Stream, streamID uint32, isTcp bool, counter *streamByteCounter) {
+	t.flowControl.open(streamID)
+	defer t.flowControl.release(streamID)
+
 	for {
-		msg, err := t.codec.DecodeMessage(src)
+		msg, release, err := t.decodeDataMessage(src)
 		if err != nil {
 			return
 		}
 
 		switch m := msg.(type) {
 		case *TcpDataMessage:
-			if _, err := dst.Write(m.Data); err != nil {
+			payload, err := t.decompressPayload(m.Data, m.Compressed, m.OrigLen)
+			if err != nil {
+				t.agent.config.Logger.Error("failed to decompress TCP frame", "error", err)
+				release()
 				return
 			}
-			t.bytesIn.Add(uint64(len(m.Data)))
+			_, writeErr := dst.Write(payload)
+			n := len(payload)
+			t.addBytesIn(counter, uint64(n))
+			release()
+			if writeErr != nil {
+				return
+			}
+			t.maybeGrantWindow(src, streamID, uint32(n))
 		case *TcpCloseMessage:
+			release()
 			return
+		case *StreamWindowUpdateMessage:
+			t.flowControl.grantSend(m.StreamID, m.Delta)
+			release()
 		default:
+			release()
 			continue
 		}
-		_ = buf // Silence unused warning
 	}
 }
 
-func (t *Tunnel) copyToStream(dst Stream, src io.Reader, streamID uint32) {
+func (t *Tunnel) copyToStream(dst Stream, src io.Reader, streamID uint32, counter *streamByteCounter) {
+	t.flowControl.open(streamID)
+	defer t.flowControl.release(streamID)
+
 	buf := make([]byte, 32*1024)
 	for {
 		n, err := src.Read(buf)
 		if n > 0 {
-			msg := &TcpDataMessage{StreamID: streamID, Data: buf[:n]}
-			data, err := t.codec.EncodeMessage(msg)
+			werr := t.writeWindowed(dst, streamID, buf[:n], func(id uint32, chunk []byte) TunnelMessage {
+				return t.buildTcpDataMessage(id, chunk)
+			})
+			if werr != nil {
+				return
+			}
+			t.addBytesOut(counter, uint64(n))
+		}
+		if err != nil {
+			// Send close message
+			t.encodeDataMessage(dst, &TcpCloseMessage{StreamID: streamID})
+			return
+		}
+	}
+}
+
+func (t *Tunnel) copyHttpStream(dst io.Writer, src Stream, streamID uint32, counter *streamByteCounter) {
+	t.flowControl.open(streamID)
+	defer t.flowControl.release(streamID)
+
+	for {
+		msg, release, err := t.decodeDataMessage(src)
+		if err != nil {
+			return
+		}
+
+		switch m := msg.(type) {
+		case *HttpStreamDataMessage:
+			payload, err := t.decompressPayload(m.Data, m.Compressed, m.OrigLen)
 			if err != nil {
+				t.agent.config.Logger.Error("failed to decompress HTTP stream frame", "error", err)
+				release()
 				return
 			}
-			if _, err := dst.Write(data); err != nil {
+			_, writeErr := dst.Write(payload)
+			n := len(payload)
+			t.addBytesIn(counter, uint64(n))
+			release()
+			if writeErr != nil {
+				return
+			}
+			t.maybeGrantWindow(src, streamID, uint32(n))
+		case *HttpStreamCloseMessage:
+			release()
+			return
+		case *StreamWindowUpdateMessage:
+			t.flowControl.grantSend(m.StreamID, m.Delta)
+			release()
+		default:
+			release()
+		}
+	}
+}
+
+func (t *Tunnel) copyHttpStreamToRemote(dst Stream, src io.Reader, streamID uint32, counter *streamByteCounter) {
+	t.flowControl.open(streamID)
+	defer t.flowControl.release(streamID)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			werr := t.writeWindowed(dst, streamID, buf[:n], func(id uint32, chunk []byte) TunnelMessage {
+				return t.buildHttpStreamDataMessage(id, chunk)
+			})
+			if werr != nil {
 				return
 			}
-			t.bytesOut.Add(uint64(n))
+			t.addBytesOut(counter, uint64(n))
 		}
 		if err != nil {
-			// Send close message
-			closeMsg := &TcpCloseMessage{StreamID: streamID}
-			if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
-				dst.Write(data)
+			t.encodeDataMessage(dst, &HttpStreamCloseMessage{StreamID: streamID})
+			return
+		}
+	}
+}
+
+func (t *Tunnel) copyTlsStream(dst io.Writer, src Stream, streamID uint32, counter *streamByteCounter) {
+	t.flowControl.open(streamID)
+	defer t.flowControl.release(streamID)
+
+	for {
+		msg, release, err := t.decodeDataMessage(src)
+		if err != nil {
+			return
+		}
+
+		switch m := msg.(type) {
+		case *TlsDataMessage:
+			payload, err := t.decompressPayload(m.Data, m.Compressed, m.OrigLen)
+			if err != nil {
+				t.agent.config.Logger.Error("failed to decompress TLS frame", "error", err)
+				release()
+				return
 			}
+			_, writeErr := dst.Write(payload)
+			n := len(payload)
+			t.addBytesIn(counter, uint64(n))
+			release()
+			if writeErr != nil {
+				return
+			}
+			t.maybeGrantWindow(src, streamID, uint32(n))
+		case *TlsCloseMessage:
+			release()
+			return
+		case *StreamWindowUpdateMessage:
+			t.flowControl.grantSend(m.StreamID, m.Delta)
+			release()
+		default:
+			release()
+		}
+	}
+}
+
+func (t *Tunnel) copyTlsStreamToRemote(dst Stream, src io.Reader, streamID uint32, counter *streamByteCounter) {
+	t.flowControl.open(streamID)
+	defer t.flowControl.release(streamID)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			werr := t.writeWindowed(dst, streamID, buf[:n], func(id uint32, chunk []byte) TunnelMessage {
+				return t.buildTlsDataMessage(id, chunk)
+			})
+			if werr != nil {
+				return
+			}
+			t.addBytesOut(counter, uint64(n))
+		}
+		if err != nil {
+			t.encodeDataMessage(dst, &TlsCloseMessage{StreamID: streamID})
 			return
 		}
 	}
 }
 
-func (t *Tunnel) copyHttpStream(dst io.Writer, src Stream, streamID uint32) {
+func (t *Tunnel) copyTlsTermStream(dst io.Writer, src Stream, streamID uint32, counter *streamByteCounter) {
 	for {
 		msg, err := t.codec.DecodeMessage(src)
 		if err != nil {
@@ -624,23 +2043,23 @@ func (t *Tunnel) copyHttpStream(dst io.Writer, src Stream, streamID uint32) {
 		}
 
 		switch m := msg.(type) {
-		case *HttpStreamDataMessage:
+		case *TlsTermDataMessage:
 			if _, err := dst.Write(m.Data); err != nil {
 				return
 			}
-			t.bytesIn.Add(uint64(len(m.Data)))
-		case *HttpStreamCloseMessage:
+			t.addBytesIn(counter, uint64(len(m.Data)))
+		case *TlsTermCloseMessage:
 			return
 		}
 	}
 }
 
-func (t *Tunnel) copyHttpStreamToRemote(dst Stream, src io.Reader, streamID uint32) {
+func (t *Tunnel) copyTlsTermStreamToRemote(dst Stream, src io.Reader, streamID uint32, counter *streamByteCounter) {
 	buf := make([]byte, 32*1024)
 	for {
 		n, err := src.Read(buf)
 		if n > 0 {
-			msg := &HttpStreamDataMessage{StreamID: streamID, Data: buf[:n]}
+			msg := &TlsTermDataMessage{StreamID: streamID, Data: buf[:n]}
 			data, err := t.codec.EncodeMessage(msg)
 			if err != nil {
 				return
@@ -648,10 +2067,10 @@ func (t *Tunnel) copyHttpStreamToRemote(dst Stream, src io.Reader, streamID uint
 			if _, err := dst.Write(data); err != nil {
 				return
 			}
-			t.bytesOut.Add(uint64(n))
+			t.addBytesOut(counter, uint64(n))
 		}
 		if err != nil {
-			closeMsg := &HttpStreamCloseMessage{StreamID: streamID}
+			closeMsg := &TlsTermCloseMessage{StreamID: streamID}
 			if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
 				dst.Write(data)
 			}
@@ -660,7 +2079,7 @@ func (t *Tunnel) copyHttpStreamToRemote(dst Stream, src io.Reader, streamID uint
 	}
 }
 
-func (t *Tunnel) copyTlsStream(dst io.Writer, src Stream, streamID uint32) {
+func (t *Tunnel) copyHTTP3Stream(dst io.Writer, src Stream, streamID uint32, counter *streamByteCounter) {
 	for {
 		msg, err := t.codec.DecodeMessage(src)
 		if err != nil {
@@ -668,23 +2087,28 @@ func (t *Tunnel) copyTlsStream(dst io.Writer, src Stream, streamID uint32) {
 		}
 
 		switch m := msg.(type) {
-		case *TlsDataMessage:
+		case *Http3StreamDataMessage:
 			if _, err := dst.Write(m.Data); err != nil {
 				return
 			}
-			t.bytesIn.Add(uint64(len(m.Data)))
-		case *TlsCloseMessage:
+			t.addBytesIn(counter, uint64(len(m.Data)))
+		case *QuicDatagramMessage:
+			if _, err := dst.Write(m.Data); err != nil {
+				return
+			}
+			t.addBytesIn(counter, uint64(len(m.Data)))
+		case *Http3StreamCloseMessage:
 			return
 		}
 	}
 }
 
-func (t *Tunnel) copyTlsStreamToRemote(dst Stream, src io.Reader, streamID uint32) {
+func (t *Tunnel) copyHTTP3StreamToRemote(dst Stream, src io.Reader, streamID uint32, counter *streamByteCounter) {
 	buf := make([]byte, 32*1024)
 	for {
 		n, err := src.Read(buf)
 		if n > 0 {
-			msg := &TlsDataMessage{StreamID: streamID, Data: buf[:n]}
+			msg := &Http3StreamDataMessage{StreamID: streamID, Data: buf[:n]}
 			data, err := t.codec.EncodeMessage(msg)
 			if err != nil {
 				return
@@ -692,10 +2116,10 @@ func (t *Tunnel) copyTlsStreamToRemote(dst Stream, src io.Reader, streamID uint3
 			if _, err := dst.Write(data); err != nil {
 				return
 			}
-			t.bytesOut.Add(uint64(n))
+			t.addBytesOut(counter, uint64(n))
 		}
 		if err != nil {
-			closeMsg := &TlsCloseMessage{StreamID: streamID}
+			closeMsg := &Http3StreamCloseMessage{StreamID: streamID}
 			if data, err := t.codec.EncodeMessage(closeMsg); err == nil {
 				dst.Write(data)
 			}
@@ -722,16 +2146,23 @@ func (t *Tunnel) sendHTTPError(stream Stream, streamID uint32, status int, messa
 func (t *Tunnel) buildProtocols() []ProtocolSpec {
 	var protocols []ProtocolSpec
 
+	var compression []string
+	if t.config.EnableCompression {
+		compression = supportedCompressionAlgorithms
+	}
+
 	switch t.config.Protocol {
 	case ProtocolTCP:
 		protocols = append(protocols, ProtocolSpec{
-			Type: "tcp",
-			Port: t.config.Port,
+			Type:        "tcp",
+			Port:        t.config.Port,
+			Compression: compression,
 		})
 	case ProtocolTLS:
 		protocols = append(protocols, ProtocolSpec{
-			Type: "tls",
-			Port: t.config.Port,
+			Type:        "tls",
+			Port:        t.config.Port,
+			Compression: compression,
 		})
 	case ProtocolHTTP:
 		var subdomain *string
@@ -739,8 +2170,9 @@ func (t *Tunnel) buildProtocols() []ProtocolSpec {
 			subdomain = &t.config.Subdomain
 		}
 		protocols = append(protocols, ProtocolSpec{
-			Type:      "http",
-			Subdomain: subdomain,
+			Type:        "http",
+			Subdomain:   subdomain,
+			Compression: compression,
 		})
 	case ProtocolHTTPS:
 		var subdomain *string
@@ -748,8 +2180,29 @@ func (t *Tunnel) buildProtocols() []ProtocolSpec {
 			subdomain = &t.config.Subdomain
 		}
 		protocols = append(protocols, ProtocolSpec{
-			Type:      "https",
-			Subdomain: subdomain,
+			Type:        "https",
+			Subdomain:   subdomain,
+			Compression: compression,
+			Domain:      t.config.Domain,
+			ManagedCert: t.config.acmeManager != nil,
+		})
+	case ProtocolTLSTerminated:
+		certSource := "wildcard"
+		if t.config.TLSCertBundleID != "" {
+			certSource = "custom"
+		}
+		protocols = append(protocols, ProtocolSpec{
+			Type:         "tls-terminated",
+			Port:         t.config.Port,
+			CertSource:   certSource,
+			CertBundleID: t.config.TLSCertBundleID,
+			Compression:  compression,
+		})
+	case ProtocolUDP:
+		protocols = append(protocols, ProtocolSpec{
+			Type:        "udp",
+			Port:        t.config.Port,
+			Compression: compression,
 		})
 	}
 
@@ -763,15 +2216,34 @@ func (t *Tunnel) buildTunnelConfig() TunnelConfigMsg {
 		localPort = &p
 	}
 
+	var http3IdleTimeoutSecs uint32
+	if t.config.EnableHTTP3 {
+		http3IdleTimeoutSecs = uint32(DefaultHTTP3IdleTimeout.Seconds())
+	}
+
+	exitNode := ExitNodeConfig{Type: "auto"}
+	if t.config.regionFailover != nil {
+		exitNode = ExitNodeConfig{Type: "multi_region", Regions: t.config.regionFailover.regions}
+	}
+
+	maxConcurrentStreams := t.config.MaxConcurrentStreams
+	if maxConcurrentStreams == 0 {
+		maxConcurrentStreams = DefaultMaxConcurrentStreams
+	}
+
 	return TunnelConfigMsg{
-		LocalHost:          t.config.LocalHost(),
-		LocalPort:          localPort,
-		LocalHTTPS:         t.config.LocalHTTPS,
-		ExitNode:           ExitNodeConfig{Type: "auto"},
-		Failover:           false,
-		IPAllowlist:        nil,
-		EnableCompression:  false,
-		EnableMultiplexing: true,
+		LocalHost:               t.config.LocalHost(),
+		LocalPort:               localPort,
+		LocalHTTPS:              t.config.LocalHTTPS,
+		ExitNode:                exitNode,
+		Failover:                t.config.regionFailover != nil,
+		IPAllowlist:             nil,
+		EnableCompression:       t.config.EnableCompression,
+		EnableMultiplexing:      true,
+		EnableHTTP3:             t.config.EnableHTTP3,
+		HTTP3IdleTimeoutSecs:    http3IdleTimeoutSecs,
+		MaxConcurrentStreams:    maxConcurrentStreams,
+		EnableHeaderCompression: t.config.EnableHeaderCompression,
 	}
 }
 
@@ -780,16 +2252,20 @@ func generateTunnelID() string {
 	return fmt.Sprintf("tunnel-%d", time.Now().UnixNano())
 }
 
-// httpForwarder handles forwarding HTTP requests to the local service.
+// httpForwarder handles forwarding HTTP requests to the local service. When
+// config.Ingress is non-empty, client/upstream are only the fallback used if
+// ingress is somehow empty; routing otherwise goes through ingress instead
+// (see route).
 type httpForwarder struct {
-	client    *http.Client
-	upstream  *url.URL
-	useHTTPS  bool
+	client   *http.Client
+	upstream *url.URL
+	useHTTPS bool
+	ingress  []compiledIngressRule
 }
 
 func newHTTPForwarder(config *TunnelConfig) *httpForwarder {
 	upstream := config.Upstream
-	if !strings.Contains(upstream, "://") {
+	if upstream != "" && !strings.Contains(upstream, "://") {
 		if config.LocalHTTPS {
 			upstream = "https://" + upstream
 		} else {
@@ -799,18 +2275,92 @@ func newHTTPForwarder(config *TunnelConfig) *httpForwarder {
 
 	u, _ := url.Parse(upstream)
 
+	var ingress []compiledIngressRule
+	if len(config.Ingress) > 0 {
+		// config.Validate has already run validateIngress by the time a
+		// Tunnel is constructed, so rules are known-good here.
+		ingress, _ = compileIngressRules(config.Ingress)
+	}
+
 	return &httpForwarder{
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 		upstream: u,
 		useHTTPS: config.LocalHTTPS,
+		ingress:  ingress,
+	}
+}
+
+// route resolves which client and upstream URL a request should use: the
+// first matching rule in f.ingress, in order, or f.client/f.upstream
+// unchanged when no Ingress was configured. statusCode is set, with client
+// nil, when the match is an "http_status:" sentinel rule or no rule matched
+// at all (the latter reported as http.StatusNotFound, since Validate
+// requires a catch-all whenever Ingress is non-empty). helloWorld is set,
+// with client nil, when the match is a "hello_world" sentinel rule.
+func (f *httpForwarder) route(headers map[string]string, uri string) (client *http.Client, target url.URL, hostHeader string, statusCode int, helloWorld bool, err error) {
+	if len(f.ingress) == 0 {
+		return f.client, *f.upstream, "", 0, false, nil
+	}
+
+	host := lookupHeader(headers, "Host")
+	path := uri
+	if u, perr := url.Parse(uri); perr == nil {
+		path = u.Path
+	}
+
+	rule, matched := matchIngress(f.ingress, host, path)
+	if !matched {
+		return nil, url.URL{}, "", http.StatusNotFound, false, nil
+	}
+	if rule.statusCode > 0 {
+		return nil, url.URL{}, "", rule.statusCode, false, nil
+	}
+	if rule.helloWorld {
+		return nil, url.URL{}, "", 0, true, nil
+	}
+	if rule.client == nil {
+		return nil, url.URL{}, "", 0, false, fmt.Errorf("ingress rule for %q routes to %q, which isn't an HTTP service", rule.rule.Hostname, rule.rule.Service)
+	}
+	return rule.client, *rule.serviceURL, rule.rule.OriginRequest.HTTPHostHeader, 0, false, nil
+}
+
+// resolveStreamAddr returns the raw dial network/address an ingress rule
+// matching host selects, for Tunnel.handleHTTPStream's passthrough dialing.
+// ok is false when no Ingress is configured (caller should dial the
+// tunnel's configured local service) or the match is an http_status:
+// sentinel rule (nothing to dial).
+func (f *httpForwarder) resolveStreamAddr(host string) (network, address string, ok bool) {
+	if len(f.ingress) == 0 {
+		return "", "", false
+	}
+	rule, matched := matchIngress(f.ingress, host, "")
+	if !matched || rule.statusCode > 0 || rule.helloWorld {
+		return "", "", false
 	}
+	return rule.network, rule.address, true
 }
 
 func (f *httpForwarder) forward(ctx context.Context, req *HttpRequestMessage) (*HttpResponseMessage, error) {
+	client, target, hostHeader, statusCode, helloWorld, err := f.route(req.Headers, req.URI)
+	if err != nil {
+		return nil, err
+	}
+	if helloWorld {
+		return &HttpResponseMessage{
+			StreamID: req.StreamID,
+			Status:   http.StatusOK,
+			Headers:  map[string]string{"Content-Type": "text/html; charset=utf-8"},
+			Body:     []byte(helloWorldBody),
+		}, nil
+	}
+	if statusCode > 0 {
+		return &HttpResponseMessage{StreamID: req.StreamID, Status: uint16(statusCode)}, nil
+	}
+
 	// Build the request URL
-	reqURL := *f.upstream
+	reqURL := target
 	reqURL.Path = req.URI
 
 	// Create HTTP request
@@ -823,6 +2373,9 @@ func (f *httpForwarder) forward(ctx context.Context, req *HttpRequestMessage) (*
 	for k, v := range req.Headers {
 		httpReq.Header.Set(k, v)
 	}
+	if hostHeader != "" {
+		httpReq.Host = hostHeader
+	}
 
 	// Set body if present
 	if len(req.Body) > 0 {
@@ -831,7 +2384,7 @@ func (f *httpForwarder) forward(ctx context.Context, req *HttpRequestMessage) (*
 	}
 
 	// Send request
-	resp, err := f.client.Do(httpReq)
+	resp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
@@ -858,3 +2411,51 @@ func (f *httpForwarder) forward(ctx context.Context, req *HttpRequestMessage) (*
 		Body:     body,
 	}, nil
 }
+
+// forwardStream is like forward but takes the request body as a streaming
+// io.Reader and hands back the raw *http.Response instead of buffering it
+// into an HttpResponseMessage, so the caller can write response headers to
+// the tunnel stream the moment client.Do returns and pump resp.Body through
+// afterward. The caller owns resp.Body and must close it.
+func (f *httpForwarder) forwardStream(ctx context.Context, req *HttpRequestHeadersMessage, body io.Reader) (*http.Response, error) {
+	client, target, hostHeader, statusCode, helloWorld, err := f.route(req.Headers, req.URI)
+	if err != nil {
+		return nil, err
+	}
+	if helloWorld {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Status:        http.StatusText(http.StatusOK),
+			Header:        http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+			Body:          io.NopCloser(strings.NewReader(helloWorldBody)),
+			ContentLength: int64(len(helloWorldBody)),
+		}, nil
+	}
+	if statusCode > 0 {
+		return &http.Response{
+			StatusCode:    statusCode,
+			Status:        http.StatusText(statusCode),
+			Header:        make(http.Header),
+			Body:          io.NopCloser(strings.NewReader("")),
+			ContentLength: 0,
+		}, nil
+	}
+
+	reqURL := target
+	reqURL.Path = req.URI
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, reqURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if hostHeader != "" {
+		httpReq.Host = hostHeader
+	}
+	httpReq.ContentLength = req.ContentLength
+
+	return client.Do(httpReq)
+}
@@ -0,0 +1,136 @@
+package localup
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// WireFormat encodes and decodes TunnelMessages for the control/data stream
+// wire format. The original bincode framing (MessageCodec) implements it
+// directly; MsgpackWireFormat and ProtobufWireFormat let a tunnel interop
+// with a relay that can't speak bincode, chosen via negotiateWireFormat
+// before the first ConnectMessage.
+type WireFormat interface {
+	// Name identifies the format during wire-format negotiation, e.g.
+	// "bincode", "msgpack", "protobuf".
+	Name() string
+
+	// EncodeMessage encodes msg with its 4-byte length prefix, ready to
+	// write to the wire (see MessageCodec.EncodeMessage).
+	EncodeMessage(msg TunnelMessage) ([]byte, error)
+
+	// DecodeMessage reads a length-prefixed frame from r and decodes it.
+	DecodeMessage(r io.Reader) (TunnelMessage, error)
+
+	// DecodeMessageBytes decodes a message from bytes without a length
+	// prefix, e.g. a payload already split out of a frame by a caller.
+	DecodeMessageBytes(data []byte) (TunnelMessage, error)
+}
+
+// BincodeWireFormat is the bincode wire format, kept under its original name
+// (MessageCodec) since it predates the WireFormat interface.
+type BincodeWireFormat = MessageCodec
+
+// NewBincodeWireFormat constructs the bincode wire format, using
+// FixintEncoding/LittleEndianOrder, this package's original wire format.
+func NewBincodeWireFormat() *BincodeWireFormat {
+	return NewMessageCodec()
+}
+
+// NewBincodeWireFormatWithConfig constructs the bincode wire format using
+// cfg, e.g. BincodeConfig{IntEncoding: VarintEncoding} to interop with a
+// Rust peer built against bincode 2's default configuration. Pass the
+// result to WithWireFormats; both ends of the negotiated connection must
+// agree on cfg, since wire-format negotiation only exchanges Name(), not
+// the BincodeConfig behind it.
+func NewBincodeWireFormatWithConfig(cfg BincodeConfig) *BincodeWireFormat {
+	return NewMessageCodecWithConfig(cfg)
+}
+
+// Name implements WireFormat for MessageCodec.
+func (c *MessageCodec) Name() string { return "bincode" }
+
+var (
+	_ WireFormat = (*MessageCodec)(nil)
+	_ WireFormat = (*MsgpackWireFormat)(nil)
+	_ WireFormat = (*ProtobufWireFormat)(nil)
+)
+
+// framePayload prepends a 4-byte big-endian length prefix to payload. Every
+// WireFormat uses this same framing, so only the payload encoding differs
+// between bincode, msgpack and protobuf.
+func framePayload(payload []byte) []byte {
+	result := make([]byte, LengthPrefixSize+len(payload))
+	binary.BigEndian.PutUint32(result[:LengthPrefixSize], uint32(len(payload)))
+	copy(result[LengthPrefixSize:], payload)
+	return result
+}
+
+// readFramedPayload reads a [4-byte big-endian length][payload] frame from r.
+func readFramedPayload(r io.Reader) ([]byte, error) {
+	var lengthBuf [LengthPrefixSize]byte
+	if _, err := io.ReadFull(r, lengthBuf[:]); err != nil {
+		return nil, fmt.Errorf("failed to read length: %w", err)
+	}
+	length := binary.BigEndian.Uint32(lengthBuf[:])
+	if length > MaxFrameSize {
+		return nil, fmt.Errorf("message too large: %d bytes", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("failed to read payload: %w", err)
+	}
+	return payload, nil
+}
+
+// wireHandshakeMagic marks a wire-format negotiation frame sent once on a
+// freshly opened control stream, before any TunnelMessage. It lets the
+// client advertise every WireFormat it can speak instead of assuming
+// bincode, without changing anything for relays that only ever spoke
+// bincode and never look for it (see WithWireFormats).
+var wireHandshakeMagic = [4]byte{'L', 'U', 'W', 'F'}
+
+// wireHandshakeVersion is the version of the handshake framing itself, not
+// the format list it carries; bump it if the handshake's own layout changes.
+const wireHandshakeVersion uint8 = 1
+
+// negotiateWireFormat writes wireHandshakeMagic, wireHandshakeVersion and the
+// name of every entry in supported (most preferred first) to stream, then
+// reads back the relay's chosen format name and returns the matching entry.
+// supported must be non-empty.
+func negotiateWireFormat(stream Stream, supported []WireFormat) (WireFormat, error) {
+	buf := make([]byte, 0, 32)
+	buf = append(buf, wireHandshakeMagic[:]...)
+	buf = append(buf, wireHandshakeVersion, uint8(len(supported)))
+	for _, f := range supported {
+		name := f.Name()
+		if len(name) > 255 {
+			return nil, fmt.Errorf("wire format name %q too long", name)
+		}
+		buf = append(buf, uint8(len(name)))
+		buf = append(buf, name...)
+	}
+
+	if _, err := stream.Write(buf); err != nil {
+		return nil, fmt.Errorf("failed to send wire format handshake: %w", err)
+	}
+
+	var header [2]byte // [version][name length]
+	if _, err := io.ReadFull(stream, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read wire format choice: %w", err)
+	}
+	nameBuf := make([]byte, header[1])
+	if _, err := io.ReadFull(stream, nameBuf); err != nil {
+		return nil, fmt.Errorf("failed to read wire format name: %w", err)
+	}
+	chosen := string(nameBuf)
+
+	for _, f := range supported {
+		if f.Name() == chosen {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("relay chose unsupported wire format %q", chosen)
+}
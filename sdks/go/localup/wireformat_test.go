@@ -0,0 +1,107 @@
+package localup
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// wireFormatRoundTripMessages exercises a representative slice of
+// TunnelMessage types: a small fixed-size message, one with nested
+// structures (ConnectMessage's protocols/config), one with a map
+// (HttpRequestMessage's headers), and one with optional/nil fields
+// (HttpRequestMessage.Body).
+func wireFormatRoundTripMessages() []TunnelMessage {
+	return []TunnelMessage{
+		&PingMessage{Timestamp: 123456789},
+		&ConnectMessage{
+			TunnelID:  "tun-1",
+			AuthToken: "token",
+			Protocols: []ProtocolSpec{
+				{Type: "http", Subdomain: strPtr("demo"), Compression: []string{"gzip"}},
+				{Type: "tcp", Port: 8080, Compression: []string{"zstd"}},
+			},
+			Config: TunnelConfigMsg{
+				LocalHost:            "localhost",
+				LocalPort:            u16Ptr(3000),
+				ExitNode:             ExitNodeConfig{Type: "specific", Region: "us-east"},
+				IPAllowlist:          []string{"10.0.0.0/8"},
+				MaxConcurrentStreams: 100,
+			},
+		},
+		&HttpRequestMessage{
+			StreamID: 7,
+			Method:   "POST",
+			URI:      "/api/v1/things",
+			Headers:  map[string]string{"content-type": "application/json", "x-request-id": "abc"},
+			Body:     []byte(`{"ok":true}`),
+			OrigLen:  11,
+		},
+		&HttpRequestMessage{
+			StreamID: 8,
+			Method:   "GET",
+			URI:      "/",
+			Headers:  map[string]string{},
+			Body:     nil,
+		},
+		&UdpDatagramMessage{StreamID: 1, PeerAddr: "203.0.113.5", PeerPort: 53, Data: []byte{1, 2, 3, 4}},
+	}
+}
+
+func strPtr(s string) *string { return &s }
+func u16Ptr(v uint16) *uint16 { return &v }
+
+func TestWireFormatRoundTrip(t *testing.T) {
+	formats := []WireFormat{
+		NewBincodeWireFormat(),
+		NewMsgpackWireFormat(),
+		NewProtobufWireFormat(),
+	}
+
+	for _, format := range formats {
+		t.Run(format.Name(), func(t *testing.T) {
+			for _, msg := range wireFormatRoundTripMessages() {
+				data, err := format.EncodeMessage(msg)
+				if err != nil {
+					t.Fatalf("EncodeMessage(%T): %v", msg, err)
+				}
+
+				got, err := format.DecodeMessage(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("DecodeMessage(%T): %v", msg, err)
+				}
+				if !reflect.DeepEqual(got, msg) {
+					t.Errorf("round trip mismatch for %T:\n got:  %#v\n want: %#v", msg, got, msg)
+				}
+
+				// DecodeMessageBytes must accept the same payload without its
+				// length prefix, since that's what negotiateWireFormat's
+				// callers and handleDataStream's framing rely on.
+				payload := data[LengthPrefixSize:]
+				got2, err := format.DecodeMessageBytes(payload)
+				if err != nil {
+					t.Fatalf("DecodeMessageBytes(%T): %v", msg, err)
+				}
+				if !reflect.DeepEqual(got2, msg) {
+					t.Errorf("DecodeMessageBytes mismatch for %T:\n got:  %#v\n want: %#v", msg, got2, msg)
+				}
+			}
+		})
+	}
+}
+
+// TestProtobufWireFormatRealWireBytes confirms ProtobufWireFormat emits
+// actual protobuf tag/wire-type framing per wire.proto (field 1 = Kind enum
+// varint, tag byte (1<<3)|0 = 0x08) rather than the old one-byte-per-value
+// tag scheme, so a protoc-generated decoder built against wire.proto can
+// read it.
+func TestProtobufWireFormatRealWireBytes(t *testing.T) {
+	data, err := NewProtobufWireFormat().EncodeMessage(&PingMessage{Timestamp: 1})
+	if err != nil {
+		t.Fatalf("EncodeMessage: %v", err)
+	}
+	payload := data[LengthPrefixSize:]
+	if len(payload) == 0 || payload[0] != 0x08 {
+		t.Fatalf("expected payload to start with field-1 varint tag 0x08, got % x", payload)
+	}
+}
@@ -0,0 +1,1210 @@
+package localup
+
+import "fmt"
+
+// wireValue is a generic, self-describing value tree used as the
+// intermediate representation between a TunnelMessage and the wire bytes for
+// MsgpackWireFormat and ProtobufWireFormat. Sharing this layer means adding a
+// new wire format only requires writing a tree serializer (see msgpack.go,
+// protobuf.go) instead of per-message-type encode/decode code a second time.
+type wireKind uint8
+
+const (
+	wireNil wireKind = iota
+	wireBool
+	wireUint
+	wireBytes
+	wireString
+	wireArray
+)
+
+type wireValue struct {
+	kind  wireKind
+	b     bool
+	u     uint64
+	bs    []byte
+	s     string
+	items []wireValue
+}
+
+func vNil() wireValue                     { return wireValue{kind: wireNil} }
+func vBool(b bool) wireValue              { return wireValue{kind: wireBool, b: b} }
+func vUint(u uint64) wireValue            { return wireValue{kind: wireUint, u: u} }
+func vInt(v int64) wireValue              { return wireValue{kind: wireUint, u: uint64(v)} }
+func vBytes(bs []byte) wireValue          { return wireValue{kind: wireBytes, bs: bs} }
+func vString(s string) wireValue          { return wireValue{kind: wireString, s: s} }
+func vArray(items ...wireValue) wireValue { return wireValue{kind: wireArray, items: items} }
+
+func vStrings(strs []string) wireValue {
+	items := make([]wireValue, len(strs))
+	for i, s := range strs {
+		items[i] = vString(s)
+	}
+	return vArray(items...)
+}
+
+func vBytesList(list [][]byte) wireValue {
+	items := make([]wireValue, len(list))
+	for i, bs := range list {
+		items[i] = vBytes(bs)
+	}
+	return vArray(items...)
+}
+
+func vOptionBytes(bs []byte) wireValue {
+	if bs == nil {
+		return vNil()
+	}
+	return vBytes(bs)
+}
+
+func vOptionString(s *string) wireValue {
+	if s == nil {
+		return vNil()
+	}
+	return vString(*s)
+}
+
+func vOptionU16(v *uint16) wireValue {
+	if v == nil {
+		return vNil()
+	}
+	return vUint(uint64(*v))
+}
+
+func vHeaders(h map[string]string) wireValue {
+	items := make([]wireValue, 0, len(h))
+	for k, val := range h {
+		items = append(items, vArray(vString(k), vString(val)))
+	}
+	return vArray(items...)
+}
+
+func (v wireValue) asBool() (bool, error) {
+	if v.kind != wireBool {
+		return false, fmt.Errorf("expected bool, got wireKind %d", v.kind)
+	}
+	return v.b, nil
+}
+
+func (v wireValue) asUint() (uint64, error) {
+	if v.kind != wireUint {
+		return 0, fmt.Errorf("expected uint, got wireKind %d", v.kind)
+	}
+	return v.u, nil
+}
+
+func (v wireValue) asInt() (int64, error) {
+	u, err := v.asUint()
+	if err != nil {
+		return 0, err
+	}
+	return int64(u), nil
+}
+
+func (v wireValue) asBytes() ([]byte, error) {
+	if v.kind != wireBytes {
+		return nil, fmt.Errorf("expected bytes, got wireKind %d", v.kind)
+	}
+	return v.bs, nil
+}
+
+func (v wireValue) asString() (string, error) {
+	if v.kind != wireString {
+		return "", fmt.Errorf("expected string, got wireKind %d", v.kind)
+	}
+	return v.s, nil
+}
+
+func (v wireValue) asArray() ([]wireValue, error) {
+	if v.kind != wireArray {
+		return nil, fmt.Errorf("expected array, got wireKind %d", v.kind)
+	}
+	return v.items, nil
+}
+
+func (v wireValue) asStrings() ([]string, error) {
+	items, err := v.asArray()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(items))
+	for i, it := range items {
+		s, err := it.asString()
+		if err != nil {
+			return nil, err
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+func (v wireValue) asBytesList() ([][]byte, error) {
+	items, err := v.asArray()
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, len(items))
+	for i, it := range items {
+		bs, err := it.asBytes()
+		if err != nil {
+			return nil, err
+		}
+		out[i] = bs
+	}
+	return out, nil
+}
+
+func (v wireValue) optionBytes() ([]byte, error) {
+	if v.kind == wireNil {
+		return nil, nil
+	}
+	return v.asBytes()
+}
+
+func (v wireValue) optionString() (*string, error) {
+	if v.kind == wireNil {
+		return nil, nil
+	}
+	s, err := v.asString()
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (v wireValue) optionU16() (*uint16, error) {
+	if v.kind == wireNil {
+		return nil, nil
+	}
+	u, err := v.asUint()
+	if err != nil {
+		return nil, err
+	}
+	u16 := uint16(u)
+	return &u16, nil
+}
+
+func (v wireValue) asHeaders() (map[string]string, error) {
+	items, err := v.asArray()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(items))
+	for _, it := range items {
+		pair, err := it.asArray()
+		if err != nil || len(pair) != 2 {
+			return nil, fmt.Errorf("malformed header entry")
+		}
+		k, err := pair[0].asString()
+		if err != nil {
+			return nil, err
+		}
+		val, err := pair[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		out[k] = val
+	}
+	return out, nil
+}
+
+// messageToValue converts msg into the generic [variant, fields] envelope
+// that MsgpackWireFormat and ProtobufWireFormat serialize.
+func messageToValue(msg TunnelMessage) (wireValue, error) {
+	var fields wireValue
+	switch m := msg.(type) {
+	case *PingMessage:
+		fields = vArray(vUint(m.Timestamp))
+	case *PongMessage:
+		fields = vArray(vUint(m.Timestamp))
+	case *ConnectMessage:
+		protocols := make([]wireValue, len(m.Protocols))
+		for i, p := range m.Protocols {
+			protocols[i] = protocolSpecToValue(&p)
+		}
+		fields = vArray(vString(m.TunnelID), vString(m.AuthToken), vArray(protocols...), tunnelConfigToValue(&m.Config))
+	case *ConnectedMessage:
+		endpoints := make([]wireValue, len(m.Endpoints))
+		for i, ep := range m.Endpoints {
+			endpoints[i] = vArray(vString(ep.Protocol), vString(ep.URL), vUint(uint64(ep.Port)))
+		}
+		fields = vArray(vString(m.TunnelID), vArray(endpoints...), vString(m.ChosenCompression), vBool(m.HeaderCompressionEnabled))
+	case *DisconnectMessage:
+		fields = vArray(vString(m.Reason))
+	case *DisconnectAckMessage:
+		fields = vArray(vString(m.TunnelID))
+	case *TcpConnectMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vString(m.RemoteAddr), vUint(uint64(m.RemotePort)), vBytes(m.ProxyProtocolV2))
+	case *TcpDataMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vBytes(m.Data), vBool(m.Compressed), vUint(uint64(m.OrigLen)))
+	case *TcpCloseMessage:
+		fields = vArray(vUint(uint64(m.StreamID)))
+	case *TlsConnectMessage:
+		fields = vArray(
+			vUint(uint64(m.StreamID)), vString(m.SNI), vBytes(m.ClientHello), vBytes(m.ProxyProtocolV2),
+			vStrings(m.ALPNOffers), vString(m.JA3), vString(m.JA4), vBytesList(m.ClientCertChain), vString(m.ClientCertSHA256),
+		)
+	case *TlsDataMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vBytes(m.Data), vBool(m.Compressed), vUint(uint64(m.OrigLen)))
+	case *TlsCloseMessage:
+		fields = vArray(vUint(uint64(m.StreamID)))
+	case *HttpRequestMessage:
+		fields = vArray(
+			vUint(uint64(m.StreamID)), vString(m.Method), vString(m.URI), vHeaders(m.Headers),
+			vOptionBytes(m.Body), vBool(m.Compressed), vUint(uint64(m.OrigLen)), vOptionBytes(m.HeaderBlock),
+		)
+	case *HttpResponseMessage:
+		fields = vArray(
+			vUint(uint64(m.StreamID)), vUint(uint64(m.Status)), vHeaders(m.Headers),
+			vOptionBytes(m.Body), vBool(m.Compressed), vUint(uint64(m.OrigLen)), vOptionBytes(m.HeaderBlock),
+		)
+	case *HttpChunkMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vBytes(m.Chunk), vBool(m.IsFinal), vBool(m.Compressed), vUint(uint64(m.OrigLen)))
+	case *HttpStreamConnectMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vString(m.Host), vBytes(m.InitialData))
+	case *HttpStreamDataMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vBytes(m.Data), vBool(m.Compressed), vUint(uint64(m.OrigLen)))
+	case *HttpStreamCloseMessage:
+		fields = vArray(vUint(uint64(m.StreamID)))
+	case *TlsTermConnectMessage:
+		fields = vArray(
+			vUint(uint64(m.StreamID)), vString(m.RemoteAddr), vUint(uint64(m.RemotePort)), vString(m.SNI),
+			vString(m.ALPN), vString(m.CipherSuite), vString(m.ClientCertSHA256),
+		)
+	case *TlsTermDataMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vBytes(m.Data))
+	case *TlsTermCloseMessage:
+		fields = vArray(vUint(uint64(m.StreamID)))
+	case *Http3StreamConnectMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vString(m.Host), vString(m.ALPN), vBytes(m.InitialData))
+	case *Http3StreamDataMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vBytes(m.Data))
+	case *Http3StreamCloseMessage:
+		fields = vArray(vUint(uint64(m.StreamID)))
+	case *QuicDatagramMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vBytes(m.Data))
+	case *StreamWindowUpdateMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vUint(uint64(m.Delta)))
+	case *StreamResetMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vUint(uint64(m.ErrorCode)))
+	case *UdpBindMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vString(m.RemoteAddr), vUint(uint64(m.RemotePort)))
+	case *UdpDatagramMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vString(m.PeerAddr), vUint(uint64(m.PeerPort)), vBytes(m.Data))
+	case *UdpCloseMessage:
+		fields = vArray(vUint(uint64(m.StreamID)))
+	case *HttpRequestHeadersMessage:
+		fields = vArray(
+			vUint(uint64(m.StreamID)), vString(m.Method), vString(m.URI), vHeaders(m.Headers),
+			vInt(m.ContentLength), vOptionBytes(m.HeaderBlock),
+		)
+	case *HttpResponseHeadersMessage:
+		fields = vArray(
+			vUint(uint64(m.StreamID)), vUint(uint64(m.Status)), vHeaders(m.Headers),
+			vInt(m.ContentLength), vOptionBytes(m.HeaderBlock),
+		)
+	case *HttpBodyChunkMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vBytes(m.Data), vBool(m.Compressed), vUint(uint64(m.OrigLen)))
+	case *HttpTrailersMessage:
+		fields = vArray(vUint(uint64(m.StreamID)), vHeaders(m.Trailers))
+	case *HttpEndMessage:
+		fields = vArray(vUint(uint64(m.StreamID)))
+	default:
+		return wireValue{}, fmt.Errorf("unknown message type: %T", msg)
+	}
+
+	return vArray(vUint(uint64(msg.MessageType())), fields), nil
+}
+
+// valueToMessage is the inverse of messageToValue.
+func valueToMessage(env wireValue) (TunnelMessage, error) {
+	envItems, err := env.asArray()
+	if err != nil || len(envItems) != 2 {
+		return nil, fmt.Errorf("malformed message envelope")
+	}
+	variant, err := envItems[0].asUint()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message type: %w", err)
+	}
+	f, err := envItems[1].asArray()
+	if err != nil {
+		return nil, fmt.Errorf("malformed message fields")
+	}
+
+	need := func(n int) error {
+		if len(f) != n {
+			return fmt.Errorf("message type %d: expected %d fields, got %d", variant, n, len(f))
+		}
+		return nil
+	}
+
+	switch MessageType(variant) {
+	case MessageTypePing:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		ts, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &PingMessage{Timestamp: ts}, nil
+	case MessageTypePong:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		ts, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &PongMessage{Timestamp: ts}, nil
+	case MessageTypeConnect:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		tunnelID, err := f[0].asString()
+		if err != nil {
+			return nil, err
+		}
+		authToken, err := f[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		protocolItems, err := f[2].asArray()
+		if err != nil {
+			return nil, err
+		}
+		protocols := make([]ProtocolSpec, len(protocolItems))
+		for i, pv := range protocolItems {
+			p, err := valueToProtocolSpec(pv)
+			if err != nil {
+				return nil, err
+			}
+			protocols[i] = *p
+		}
+		cfg, err := valueToTunnelConfig(f[3])
+		if err != nil {
+			return nil, err
+		}
+		return &ConnectMessage{TunnelID: tunnelID, AuthToken: authToken, Protocols: protocols, Config: *cfg}, nil
+	case MessageTypeConnected:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		tunnelID, err := f[0].asString()
+		if err != nil {
+			return nil, err
+		}
+		epItems, err := f[1].asArray()
+		if err != nil {
+			return nil, err
+		}
+		endpoints := make([]Endpoint, len(epItems))
+		for i, ev := range epItems {
+			pair, err := ev.asArray()
+			if err != nil || len(pair) != 3 {
+				return nil, fmt.Errorf("malformed endpoint")
+			}
+			protocol, err := pair[0].asString()
+			if err != nil {
+				return nil, err
+			}
+			urlStr, err := pair[1].asString()
+			if err != nil {
+				return nil, err
+			}
+			port, err := pair[2].asUint()
+			if err != nil {
+				return nil, err
+			}
+			endpoints[i] = Endpoint{Protocol: protocol, URL: urlStr, Port: uint16(port)}
+		}
+		chosenCompression, err := f[2].asString()
+		if err != nil {
+			return nil, err
+		}
+		headerCompressionEnabled, err := f[3].asBool()
+		if err != nil {
+			return nil, err
+		}
+		return &ConnectedMessage{
+			TunnelID: tunnelID, Endpoints: endpoints, ChosenCompression: chosenCompression,
+			HeaderCompressionEnabled: headerCompressionEnabled,
+		}, nil
+	case MessageTypeDisconnect:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		reason, err := f[0].asString()
+		if err != nil {
+			return nil, err
+		}
+		return &DisconnectMessage{Reason: reason}, nil
+	case MessageTypeDisconnectAck:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		tunnelID, err := f[0].asString()
+		if err != nil {
+			return nil, err
+		}
+		return &DisconnectAckMessage{TunnelID: tunnelID}, nil
+	case MessageTypeTcpConnect:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		streamID, remoteAddr, remotePort, proxy, err := decodeStreamAddrPortBytes(f)
+		if err != nil {
+			return nil, err
+		}
+		return &TcpConnectMessage{StreamID: streamID, RemoteAddr: remoteAddr, RemotePort: remotePort, ProxyProtocolV2: proxy}, nil
+	case MessageTypeTcpData:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		streamID, data, compressed, origLen, err := decodeStreamDataCompressed(f)
+		if err != nil {
+			return nil, err
+		}
+		return &TcpDataMessage{StreamID: streamID, Data: data, Compressed: compressed, OrigLen: origLen}, nil
+	case MessageTypeTcpClose:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &TcpCloseMessage{StreamID: uint32(streamID)}, nil
+	case MessageTypeTlsConnect:
+		if err := need(9); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		sni, err := f[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		clientHello, err := f[2].asBytes()
+		if err != nil {
+			return nil, err
+		}
+		proxy, err := f[3].asBytes()
+		if err != nil {
+			return nil, err
+		}
+		alpnOffers, err := f[4].asStrings()
+		if err != nil {
+			return nil, err
+		}
+		ja3, err := f[5].asString()
+		if err != nil {
+			return nil, err
+		}
+		ja4, err := f[6].asString()
+		if err != nil {
+			return nil, err
+		}
+		certChain, err := f[7].asBytesList()
+		if err != nil {
+			return nil, err
+		}
+		certSHA256, err := f[8].asString()
+		if err != nil {
+			return nil, err
+		}
+		return &TlsConnectMessage{
+			StreamID: uint32(streamID), SNI: sni, ClientHello: clientHello, ProxyProtocolV2: proxy,
+			ALPNOffers: alpnOffers, JA3: ja3, JA4: ja4, ClientCertChain: certChain, ClientCertSHA256: certSHA256,
+		}, nil
+	case MessageTypeTlsData:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		streamID, data, compressed, origLen, err := decodeStreamDataCompressed(f)
+		if err != nil {
+			return nil, err
+		}
+		return &TlsDataMessage{StreamID: streamID, Data: data, Compressed: compressed, OrigLen: origLen}, nil
+	case MessageTypeTlsClose:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &TlsCloseMessage{StreamID: uint32(streamID)}, nil
+	case MessageTypeHttpRequest:
+		if err := need(8); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		method, err := f[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		uri, err := f[2].asString()
+		if err != nil {
+			return nil, err
+		}
+		headers, err := f[3].asHeaders()
+		if err != nil {
+			return nil, err
+		}
+		body, err := f[4].optionBytes()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := f[5].asBool()
+		if err != nil {
+			return nil, err
+		}
+		origLen, err := f[6].asUint()
+		if err != nil {
+			return nil, err
+		}
+		headerBlock, err := f[7].optionBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &HttpRequestMessage{
+			StreamID: uint32(streamID), Method: method, URI: uri, Headers: headers,
+			Body: body, Compressed: compressed, OrigLen: uint32(origLen), HeaderBlock: headerBlock,
+		}, nil
+	case MessageTypeHttpResponse:
+		if err := need(7); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		status, err := f[1].asUint()
+		if err != nil {
+			return nil, err
+		}
+		headers, err := f[2].asHeaders()
+		if err != nil {
+			return nil, err
+		}
+		body, err := f[3].optionBytes()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := f[4].asBool()
+		if err != nil {
+			return nil, err
+		}
+		origLen, err := f[5].asUint()
+		if err != nil {
+			return nil, err
+		}
+		headerBlock, err := f[6].optionBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &HttpResponseMessage{
+			StreamID: uint32(streamID), Status: uint16(status), Headers: headers,
+			Body: body, Compressed: compressed, OrigLen: uint32(origLen), HeaderBlock: headerBlock,
+		}, nil
+	case MessageTypeHttpChunk:
+		if err := need(5); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := f[1].asBytes()
+		if err != nil {
+			return nil, err
+		}
+		isFinal, err := f[2].asBool()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := f[3].asBool()
+		if err != nil {
+			return nil, err
+		}
+		origLen, err := f[4].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &HttpChunkMessage{StreamID: uint32(streamID), Chunk: chunk, IsFinal: isFinal, Compressed: compressed, OrigLen: uint32(origLen)}, nil
+	case MessageTypeHttpStreamConnect:
+		if err := need(3); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		host, err := f[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		initialData, err := f[2].asBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &HttpStreamConnectMessage{StreamID: uint32(streamID), Host: host, InitialData: initialData}, nil
+	case MessageTypeHttpStreamData:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		streamID, data, compressed, origLen, err := decodeStreamDataCompressed(f)
+		if err != nil {
+			return nil, err
+		}
+		return &HttpStreamDataMessage{StreamID: streamID, Data: data, Compressed: compressed, OrigLen: origLen}, nil
+	case MessageTypeHttpStreamClose:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &HttpStreamCloseMessage{StreamID: uint32(streamID)}, nil
+	case MessageTypeTlsTermConnect:
+		if err := need(7); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		remoteAddr, err := f[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		remotePort, err := f[2].asUint()
+		if err != nil {
+			return nil, err
+		}
+		sni, err := f[3].asString()
+		if err != nil {
+			return nil, err
+		}
+		alpn, err := f[4].asString()
+		if err != nil {
+			return nil, err
+		}
+		cipherSuite, err := f[5].asString()
+		if err != nil {
+			return nil, err
+		}
+		certSHA256, err := f[6].asString()
+		if err != nil {
+			return nil, err
+		}
+		return &TlsTermConnectMessage{
+			StreamID: uint32(streamID), RemoteAddr: remoteAddr, RemotePort: uint16(remotePort),
+			SNI: sni, ALPN: alpn, CipherSuite: cipherSuite, ClientCertSHA256: certSHA256,
+		}, nil
+	case MessageTypeTlsTermData:
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		streamID, data, err := decodeStreamData(f)
+		if err != nil {
+			return nil, err
+		}
+		return &TlsTermDataMessage{StreamID: streamID, Data: data}, nil
+	case MessageTypeTlsTermClose:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &TlsTermCloseMessage{StreamID: uint32(streamID)}, nil
+	case MessageTypeHttp3StreamConnect:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		host, err := f[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		alpn, err := f[2].asString()
+		if err != nil {
+			return nil, err
+		}
+		initialData, err := f[3].asBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &Http3StreamConnectMessage{StreamID: uint32(streamID), Host: host, ALPN: alpn, InitialData: initialData}, nil
+	case MessageTypeHttp3StreamData:
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		streamID, data, err := decodeStreamData(f)
+		if err != nil {
+			return nil, err
+		}
+		return &Http3StreamDataMessage{StreamID: streamID, Data: data}, nil
+	case MessageTypeHttp3StreamClose:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &Http3StreamCloseMessage{StreamID: uint32(streamID)}, nil
+	case MessageTypeQuicDatagram:
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		streamID, data, err := decodeStreamData(f)
+		if err != nil {
+			return nil, err
+		}
+		return &QuicDatagramMessage{StreamID: streamID, Data: data}, nil
+	case MessageTypeStreamWindowUpdate:
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		delta, err := f[1].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &StreamWindowUpdateMessage{StreamID: uint32(streamID), Delta: uint32(delta)}, nil
+	case MessageTypeStreamReset:
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		errorCode, err := f[1].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &StreamResetMessage{StreamID: uint32(streamID), ErrorCode: uint32(errorCode)}, nil
+	case MessageTypeUdpBind:
+		if err := need(3); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		remoteAddr, err := f[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		remotePort, err := f[2].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &UdpBindMessage{StreamID: uint32(streamID), RemoteAddr: remoteAddr, RemotePort: uint16(remotePort)}, nil
+	case MessageTypeUdpDatagram:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		peerAddr, err := f[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		peerPort, err := f[2].asUint()
+		if err != nil {
+			return nil, err
+		}
+		data, err := f[3].asBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &UdpDatagramMessage{StreamID: uint32(streamID), PeerAddr: peerAddr, PeerPort: uint16(peerPort), Data: data}, nil
+	case MessageTypeUdpClose:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &UdpCloseMessage{StreamID: uint32(streamID)}, nil
+	case MessageTypeHttpRequestHeaders:
+		if err := need(6); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		method, err := f[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		uri, err := f[2].asString()
+		if err != nil {
+			return nil, err
+		}
+		headers, err := f[3].asHeaders()
+		if err != nil {
+			return nil, err
+		}
+		contentLength, err := f[4].asInt()
+		if err != nil {
+			return nil, err
+		}
+		headerBlock, err := f[5].optionBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &HttpRequestHeadersMessage{
+			StreamID: uint32(streamID), Method: method, URI: uri, Headers: headers,
+			ContentLength: contentLength, HeaderBlock: headerBlock,
+		}, nil
+	case MessageTypeHttpResponseHeaders:
+		if err := need(5); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		status, err := f[1].asUint()
+		if err != nil {
+			return nil, err
+		}
+		headers, err := f[2].asHeaders()
+		if err != nil {
+			return nil, err
+		}
+		contentLength, err := f[3].asInt()
+		if err != nil {
+			return nil, err
+		}
+		headerBlock, err := f[4].optionBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &HttpResponseHeadersMessage{
+			StreamID: uint32(streamID), Status: uint16(status), Headers: headers,
+			ContentLength: contentLength, HeaderBlock: headerBlock,
+		}, nil
+	case MessageTypeHttpBodyChunk:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		streamID, data, compressed, origLen, err := decodeStreamDataCompressed(f)
+		if err != nil {
+			return nil, err
+		}
+		return &HttpBodyChunkMessage{StreamID: streamID, Data: data, Compressed: compressed, OrigLen: origLen}, nil
+	case MessageTypeHttpTrailers:
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		trailers, err := f[1].asHeaders()
+		if err != nil {
+			return nil, err
+		}
+		return &HttpTrailersMessage{StreamID: uint32(streamID), Trailers: trailers}, nil
+	case MessageTypeHttpEnd:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		streamID, err := f[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		return &HttpEndMessage{StreamID: uint32(streamID)}, nil
+	default:
+		return nil, fmt.Errorf("unknown message type: %d", variant)
+	}
+}
+
+// decodeStreamData reads the common (StreamID, Data) field pair.
+func decodeStreamData(f []wireValue) (uint32, []byte, error) {
+	streamID, err := f[0].asUint()
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := f[1].asBytes()
+	if err != nil {
+		return 0, nil, err
+	}
+	return uint32(streamID), data, nil
+}
+
+// decodeStreamDataCompressed reads the common (StreamID, Data, Compressed,
+// OrigLen) field quadruple shared by *DataMessage types.
+func decodeStreamDataCompressed(f []wireValue) (uint32, []byte, bool, uint32, error) {
+	streamID, data, err := decodeStreamData(f)
+	if err != nil {
+		return 0, nil, false, 0, err
+	}
+	compressed, err := f[2].asBool()
+	if err != nil {
+		return 0, nil, false, 0, err
+	}
+	origLen, err := f[3].asUint()
+	if err != nil {
+		return 0, nil, false, 0, err
+	}
+	return streamID, data, compressed, uint32(origLen), nil
+}
+
+// decodeStreamAddrPortBytes reads the (StreamID, RemoteAddr, RemotePort,
+// ProxyProtocolV2) field quadruple used by TcpConnectMessage.
+func decodeStreamAddrPortBytes(f []wireValue) (uint32, string, uint16, []byte, error) {
+	streamID, err := f[0].asUint()
+	if err != nil {
+		return 0, "", 0, nil, err
+	}
+	addr, err := f[1].asString()
+	if err != nil {
+		return 0, "", 0, nil, err
+	}
+	port, err := f[2].asUint()
+	if err != nil {
+		return 0, "", 0, nil, err
+	}
+	proxy, err := f[3].asBytes()
+	if err != nil {
+		return 0, "", 0, nil, err
+	}
+	return uint32(streamID), addr, uint16(port), proxy, nil
+}
+
+// protocolSpecToValue converts a ProtocolSpec to its [type, args, compression] form.
+func protocolSpecToValue(p *ProtocolSpec) wireValue {
+	var args wireValue
+	switch p.Type {
+	case "tcp":
+		args = vArray(vUint(uint64(p.Port)))
+	case "tls":
+		args = vArray(vUint(uint64(p.Port)), vString(p.SNIPattern))
+	case "http", "https":
+		args = vArray(vOptionString(p.Subdomain))
+	case "tls-terminated":
+		args = vArray(vUint(uint64(p.Port)), vString(p.CertSource), vString(p.CertBundleID))
+	case "udp":
+		args = vArray(vUint(uint64(p.Port)))
+	default:
+		args = vArray()
+	}
+	return vArray(vString(p.Type), args, vStrings(p.Compression))
+}
+
+func valueToProtocolSpec(v wireValue) (*ProtocolSpec, error) {
+	items, err := v.asArray()
+	if err != nil || len(items) != 3 {
+		return nil, fmt.Errorf("malformed protocol spec")
+	}
+	typ, err := items[0].asString()
+	if err != nil {
+		return nil, err
+	}
+	args, err := items[1].asArray()
+	if err != nil {
+		return nil, err
+	}
+	compression, err := items[2].asStrings()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ProtocolSpec{Type: typ, Compression: compression}
+	switch typ {
+	case "tcp":
+		port, err := args[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		p.Port = uint16(port)
+	case "tls":
+		port, err := args[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		sni, err := args[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		p.Port = uint16(port)
+		p.SNIPattern = sni
+	case "http", "https":
+		subdomain, err := args[0].optionString()
+		if err != nil {
+			return nil, err
+		}
+		p.Subdomain = subdomain
+	case "tls-terminated":
+		port, err := args[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		certSource, err := args[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		certBundleID, err := args[2].asString()
+		if err != nil {
+			return nil, err
+		}
+		p.Port = uint16(port)
+		p.CertSource = certSource
+		p.CertBundleID = certBundleID
+	case "udp":
+		port, err := args[0].asUint()
+		if err != nil {
+			return nil, err
+		}
+		p.Port = uint16(port)
+	}
+	return p, nil
+}
+
+func tunnelConfigToValue(cfg *TunnelConfigMsg) wireValue {
+	return vArray(
+		vString(cfg.LocalHost), vOptionU16(cfg.LocalPort), vBool(cfg.LocalHTTPS), exitNodeToValue(&cfg.ExitNode),
+		vBool(cfg.Failover), vStrings(cfg.IPAllowlist), vBool(cfg.EnableCompression), vBool(cfg.EnableMultiplexing),
+		vBool(cfg.EnableHTTP3), vUint(uint64(cfg.HTTP3IdleTimeoutSecs)), vUint(uint64(cfg.MaxConcurrentStreams)),
+		vBool(cfg.EnableHeaderCompression),
+	)
+}
+
+func valueToTunnelConfig(v wireValue) (*TunnelConfigMsg, error) {
+	items, err := v.asArray()
+	if err != nil || len(items) != 12 {
+		return nil, fmt.Errorf("malformed tunnel config")
+	}
+	localHost, err := items[0].asString()
+	if err != nil {
+		return nil, err
+	}
+	localPort, err := items[1].optionU16()
+	if err != nil {
+		return nil, err
+	}
+	localHTTPS, err := items[2].asBool()
+	if err != nil {
+		return nil, err
+	}
+	exitNode, err := valueToExitNode(items[3])
+	if err != nil {
+		return nil, err
+	}
+	failover, err := items[4].asBool()
+	if err != nil {
+		return nil, err
+	}
+	ipAllowlist, err := items[5].asStrings()
+	if err != nil {
+		return nil, err
+	}
+	enableCompression, err := items[6].asBool()
+	if err != nil {
+		return nil, err
+	}
+	enableMultiplexing, err := items[7].asBool()
+	if err != nil {
+		return nil, err
+	}
+	enableHTTP3, err := items[8].asBool()
+	if err != nil {
+		return nil, err
+	}
+	http3IdleTimeout, err := items[9].asUint()
+	if err != nil {
+		return nil, err
+	}
+	maxConcurrentStreams, err := items[10].asUint()
+	if err != nil {
+		return nil, err
+	}
+	enableHeaderCompression, err := items[11].asBool()
+	if err != nil {
+		return nil, err
+	}
+
+	return &TunnelConfigMsg{
+		LocalHost: localHost, LocalPort: localPort, LocalHTTPS: localHTTPS, ExitNode: *exitNode,
+		Failover: failover, IPAllowlist: ipAllowlist, EnableCompression: enableCompression,
+		EnableMultiplexing: enableMultiplexing, EnableHTTP3: enableHTTP3,
+		HTTP3IdleTimeoutSecs: uint32(http3IdleTimeout), MaxConcurrentStreams: uint32(maxConcurrentStreams),
+		EnableHeaderCompression: enableHeaderCompression,
+	}, nil
+}
+
+func exitNodeToValue(cfg *ExitNodeConfig) wireValue {
+	typ := cfg.Type
+	if typ == "" {
+		typ = "auto"
+	}
+	switch typ {
+	case "specific":
+		return vArray(vString(typ), vString(cfg.Region))
+	case "multi_region":
+		return vArray(vString(typ), vStrings(cfg.Regions))
+	case "custom":
+		return vArray(vString(typ), vString(cfg.Custom))
+	default:
+		return vArray(vString(typ), vNil())
+	}
+}
+
+func valueToExitNode(v wireValue) (*ExitNodeConfig, error) {
+	items, err := v.asArray()
+	if err != nil || len(items) != 2 {
+		return nil, fmt.Errorf("malformed exit node config")
+	}
+	typ, err := items[0].asString()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &ExitNodeConfig{Type: typ}
+	switch typ {
+	case "specific":
+		region, err := items[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Region = region
+	case "multi_region":
+		regions, err := items[1].asStrings()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Regions = regions
+	case "custom":
+		custom, err := items[1].asString()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Custom = custom
+	}
+	return cfg, nil
+}